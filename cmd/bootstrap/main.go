@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"library-management/internal/db"
+	"library-management/internal/handlers"
+	"library-management/internal/notify"
+	"library-management/internal/repository"
+)
+
+const usage = `Usage: bootstrap -name <name> -email <email>
+
+Creates the first librarian account. The password is read from
+BOOTSTRAP_PASSWORD so it does not end up in shell history. Once a librarian
+exists this refuses to run; promote further librarians through
+PATCH /api/users/:id/role instead.
+
+The database is selected with DB_DRIVER and DATABASE_URL, as for the server.
+`
+
+func main() {
+	name := flag.String("name", "", "librarian's name")
+	email := flag.String("email", "", "librarian's email, used to sign in")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if *name == "" || *email == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	store := repository.NewGormStore(db.ConnectDatabase())
+	h := handlers.NewHandler(store, notify.FromEnv(), handlers.ConfigFromEnv())
+
+	user, err := h.BootstrapLibrarian(*name, *email, os.Getenv("BOOTSTRAP_PASSWORD"))
+	if err != nil {
+		log.Fatalf("Failed to create librarian: %v", err)
+	}
+	fmt.Printf("Created librarian %d (%s)\n", user.ID, user.Email)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"library-management/internal/db"
+	"library-management/internal/migrations"
+	"library-management/internal/models"
+)
+
+const usage = `Usage: migrate [-dir path] <command> [args]
+
+Commands:
+  up             apply every pending migration
+  down [n]       roll back the last n applied migrations (default 1)
+  status         list migrations and whether they are applied
+  create <name>  add stub up/down files for every driver
+
+The database is selected with DB_DRIVER and DATABASE_URL, as for the server.
+`
+
+func main() {
+	dir := flag.String("dir", "internal/migrations/sql", "migrations source directory, used by create")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			log.Fatal("create needs exactly one migration name")
+		}
+		paths, err := migrations.Create(*dir, args[1])
+		if err != nil {
+			log.Fatalf("Failed to create migration: %v", err)
+		}
+		for _, path := range paths {
+			fmt.Println("Created", path)
+		}
+		return
+	}
+
+	db.LoadEnv()
+	gdb, err := db.Open(os.Getenv("DB_DRIVER"), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	migrator, err := migrations.New(gdb)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Printf("Applied %06d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+		reportInvalidISBNs(gdb)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of steps %q", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(steps)
+		for _, m := range rolledBack {
+			fmt.Printf("Rolled back %06d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%06d_%-40s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// reportInvalidISBNs lists the titles whose old ISBN could not be
+// normalised, so that a librarian can correct them.
+func reportInvalidISBNs(gdb *gorm.DB) {
+	var titles []models.Title
+	err := gdb.Unscoped().Where("invalid_isbn IS NOT NULL AND invalid_isbn <> ''").Order("id").Find(&titles).Error
+	if err != nil {
+		log.Printf("Could not check for invalid ISBNs: %v", err)
+		return
+	}
+	if len(titles) == 0 {
+		return
+	}
+	fmt.Printf("%d titles have an ISBN that failed validation and cannot be looked up by ISBN:\n", len(titles))
+	for _, t := range titles {
+		fmt.Printf("  title %d %q: %s\n", t.ID, t.Title, t.InvalidISBN)
+	}
+}
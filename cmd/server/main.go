@@ -1,26 +1,103 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"library-management/internal/db"
+	"library-management/internal/handlers"
+	"library-management/internal/notify"
+	"library-management/internal/repository"
 	"library-management/internal/routes"
+	"library-management/internal/scheduler"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors" // Middleware for Cross-Origin Resource Sharing
 )
 
 func main() {
-	db.ConnectDatabase()
+	store := repository.NewGormStore(db.ConnectDatabase())
 
-	app := fiber.New()
+	app := fiber.New(fiberConfig())
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
 		AllowHeaders: "Origin, Content-Type, Accept",
 	}))
 
-	routes.SetupRoutes(app)
+	cfg := handlers.ConfigFromEnv()
+	h := handlers.NewHandler(store, notify.FromEnv(), cfg)
+	routes.SetupRoutes(app, h)
+
+	// Access tokens cannot be signed until there is a key.
+	if _, err := h.RotateSigningKeys(time.Now()); err != nil {
+		log.Fatalf("Could not prepare signing keys: %v", err)
+	}
+	// Once every secret is sealed with KEY_ENCRYPTION_KEY, the old keys in
+	// KEY_ENCRYPTION_OLD_KEYS can be dropped.
+	if n, err := h.ResealTwoFactorSecrets(); err != nil {
+		log.Fatalf("Could not reseal two-factor secrets: %v", err)
+	} else if n > 0 {
+		log.Printf("Resealed %d two-factor secret(s) with the current key-encryption key", n)
+	}
+
+	jobs := scheduler.New()
+	jobs.Every("expire-holds", time.Minute, func(now time.Time) error {
+		n, err := h.ExpireHolds(now)
+		if n > 0 {
+			log.Printf("Expired %d hold(s)", n)
+		}
+		return err
+	})
+	jobs.Every("block-rules", time.Minute, func(now time.Time) error {
+		n, err := h.EnforceBlockRules(now)
+		if n > 0 {
+			log.Printf("Changed the block of %d user(s)", n)
+		}
+		return err
+	})
+	jobs.Every("outbox", 15*time.Second, func(now time.Time) error {
+		_, err := h.DeliverOutbox(now)
+		return err
+	})
+	jobs.Every("signing-keys", time.Hour, func(now time.Time) error {
+		key, err := h.RotateSigningKeys(now)
+		if key != nil {
+			log.Printf("Created signing key %s, active from %s", key.KID, key.ActivatesAt.Format(time.RFC3339))
+		}
+		return err
+	})
+	jobs.Daily("notices", cfg.Notices.Hour, 0, func(now time.Time) error {
+		n, err := h.SendNotices(now)
+		log.Printf("Queued %d notice(s)", n)
+		return err
+	})
+	go jobs.Run(context.Background())
 
 	log.Fatal(app.Listen(":3000"))
 }
+
+// fiberConfig trusts the X-Forwarded-For header from the proxies listed
+// in TRUSTED_PROXIES, separated by commas, so that sign-in attempts are
+// counted against the client's address rather than the proxy's.
+func fiberConfig() fiber.Config {
+	raw := os.Getenv("TRUSTED_PROXIES")
+	if raw == "" {
+		return fiber.Config{}
+	}
+	var proxies []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return fiber.Config{
+		ProxyHeader:             fiber.HeaderXForwardedFor,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          proxies,
+		EnableIPValidation:      true,
+	}
+}
@@ -1,59 +1,149 @@
 package db
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
-	"library-management/internal/models"
+	"library-management/internal/migrations"
 )
 
-var DB *gorm.DB
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// defaultSQLiteDSN is used when DB_DRIVER=sqlite and DATABASE_URL is empty.
+const defaultSQLiteDSN = "library.db"
 
 var JWTSecret string
 
-func ConnectDatabase() {
+// KeyEncryptionKeys seal the secrets kept in the database, such as private
+// signing keys. The first seals new secrets; the rest are old keys that
+// still open what was sealed before the key was rotated.
+var KeyEncryptionKeys []string
+
+// LoadEnv reads the project's .env file into the environment. A missing
+// file is not an error, so CI can configure everything through real
+// environment variables.
+func LoadEnv() {
 	_, b, _, _ := runtime.Caller(0)
 	basepath := filepath.Dir(b)
 	projectRoot := filepath.Join(basepath, "../../")
 	envPath := filepath.Join(projectRoot, ".env")
 
-	err := godotenv.Load(envPath)
-	if err != nil {
+	if err := godotenv.Load(envPath); err != nil && !errors.Is(err, os.ErrNotExist) {
 		log.Fatalf("Error loading .env file from %s: %v", envPath, err)
 	}
+}
 
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL == "" {
-		log.Fatal("DATABASE_URL not set in .env file")
+// Open connects to the database for the given driver ("postgres" or
+// "sqlite"). For SQLite the DSN is a file path or ":memory:".
+func Open(driver, dsn string) (*gorm.DB, error) {
+	switch driver {
+	case "", DriverPostgres:
+		if dsn == "" {
+			return nil, errors.New("DATABASE_URL is required for the postgres driver")
+		}
+		return gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	case DriverSQLite:
+		if dsn == "" {
+			dsn = defaultSQLiteDSN
+		}
+		db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+		if err != nil {
+			return nil, err
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		// SQLite has no row locks, and every connection to ":memory:" is a
+		// separate database. A single connection solves both: transactions
+		// are serialized and all requests see the same data.
+		sqlDB.SetMaxOpenConns(1)
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q (want %q or %q)", driver, DriverPostgres, DriverSQLite)
 	}
+}
+
+// ConnectDatabase loads .env, opens the database and checks that every
+// migration has been applied.
+// The returned handle is meant to be wrapped by repository.NewGormStore.
+func ConnectDatabase() *gorm.DB {
+	LoadEnv()
+
+	driver := os.Getenv("DB_DRIVER")
+	databaseURL := os.Getenv("DATABASE_URL")
 
 	JWTSecret = os.Getenv("JWT_SECRET")
 	if JWTSecret == "" {
 		log.Fatal("JWT_SECRET not set in .env file")
 	}
+	KeyEncryptionKeys = keyEncryptionKeys()
+	if len(KeyEncryptionKeys) == 0 {
+		log.Fatal("KEY_ENCRYPTION_KEY not set in .env file")
+	}
 
-	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{})
+	db, err := Open(driver, databaseURL)
 	if err != nil {
-		log.Fatalf("Failed to connect to database using URL '%s': %v", databaseURL, err)
+		log.Fatalf("Failed to connect to %s database: %v", driverName(driver), err)
 	}
 
-	err = db.AutoMigrate(
-		&models.User{},
-		&models.Book{},
-		&models.Borrow{},
-	)
+	migrator, err := migrations.New(db)
 	if err != nil {
-		log.Fatalf("Failed to auto-migrate models: %v", err)
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	// The schema is only changed by cmd/migrate, unless MIGRATE_ON_START is
+	// set explicitly (useful for throwaway ":memory:" SQLite databases).
+	if os.Getenv("MIGRATE_ON_START") == "true" {
+		applied, err := migrator.Up()
+		if err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+		fmt.Printf("Applied %d migration(s)\n", len(applied))
+	}
+	pending, err := migrator.Pending()
+	if err != nil {
+		log.Fatalf("Failed to check migrations: %v", err)
+	}
+	if len(pending) > 0 {
+		log.Fatalf("Database schema is out of date: %d pending migration(s). Run: go run ./cmd/migrate up", len(pending))
 	}
-	fmt.Println("Database Migrated: User, Book, and Borrow tables created/updated")
 
-	DB = db
 	fmt.Println("Connected to Database!")
+	return db
+}
+
+func driverName(driver string) string {
+	if driver == "" {
+		return DriverPostgres
+	}
+	return driver
+}
+
+// keyEncryptionKeys reads KEY_ENCRYPTION_KEY followed by the old keys in
+// KEY_ENCRYPTION_OLD_KEYS, separated by commas.
+func keyEncryptionKeys() []string {
+	current := os.Getenv("KEY_ENCRYPTION_KEY")
+	if current == "" {
+		return nil
+	}
+	keys := []string{current}
+	for _, old := range strings.Split(os.Getenv("KEY_ENCRYPTION_OLD_KEYS"), ",") {
+		if old = strings.TrimSpace(old); old != "" {
+			keys = append(keys, old)
+		}
+	}
+	return keys
 }
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"library-management/internal/db"
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+// forgotPasswordResponseTime is the least time ForgotPassword takes to
+// answer, longer than sending a reset takes, so that known and unknown
+// emails cannot be told apart by how quickly they are answered.
+const forgotPasswordResponseTime = 250 * time.Millisecond
+
+var (
+	errUserTokenInvalid = errors.New("token is invalid or already used")
+	errUserTokenExpired = errors.New("token expired")
+	errAlreadyVerified  = errors.New("email is already verified")
+	errEmailUnverified  = errors.New("email is not verified")
+)
+
+// userTokenPages maps each token purpose to the page of the web app that
+// takes the token.
+var userTokenPages = map[string]string{
+	models.TokenVerifyEmail:   "/verify-email",
+	models.TokenPasswordReset: "/reset-password",
+}
+
+type userTokenClaims struct {
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// userTokenKey derives the signing key for one token purpose from the JWT
+// secret, so these tokens can neither be used as access tokens nor for
+// another purpose.
+func userTokenKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(db.JWTSecret))
+	mac.Write([]byte("user-token:" + purpose))
+	return mac.Sum(nil)
+}
+
+// issueUserToken records a single-use token for purpose in tx and returns
+// it signed, together with when it expires.
+func issueUserToken(tx repository.Store, userID uint, purpose string, ttl time.Duration, now time.Time) (string, time.Time, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	record := &models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenID:   hex.EncodeToString(buf),
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := tx.UserTokens().Create(record); err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims := &userTokenClaims{
+		UserID:  userID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        record.TokenID,
+			ExpiresAt: jwt.NewNumericDate(record.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(userTokenKey(purpose))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, record.ExpiresAt, nil
+}
+
+// checkUserToken checks a token for purpose without using it up, and
+// returns its record locked in tx.
+func checkUserToken(tx repository.Store, raw, purpose string, now time.Time) (*models.UserToken, error) {
+	claims := &userTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return userTokenKey(purpose), nil
+	})
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, errUserTokenExpired
+		}
+		return nil, errUserTokenInvalid
+	}
+	if claims.Purpose != purpose {
+		return nil, errUserTokenInvalid
+	}
+
+	// The lock makes a second concurrent use of the same token wait, then
+	// find it used.
+	record, err := tx.UserTokens().LockByTokenID(claims.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errUserTokenInvalid
+		}
+		return nil, err
+	}
+	if record.UsedAt != nil || record.UserID != claims.UserID || record.Purpose != purpose {
+		return nil, errUserTokenInvalid
+	}
+	if now.After(record.ExpiresAt) {
+		return nil, errUserTokenExpired
+	}
+	return record, nil
+}
+
+// useUserToken checks a token for purpose and marks it used in tx. It
+// returns the user the token was issued to.
+func useUserToken(tx repository.Store, raw, purpose string, now time.Time) (uint, error) {
+	record, err := checkUserToken(tx, raw, purpose, now)
+	if err != nil {
+		return 0, err
+	}
+	record.UsedAt = &now
+	return record.UserID, tx.UserTokens().Save(record)
+}
+
+// queueTokenEmail issues a token for purpose and queues the email for
+// event that carries it.
+func (h *Handler) queueTokenEmail(tx repository.Store, event string, userID uint, purpose string, ttl time.Duration) error {
+	token, expiresAt, err := issueUserToken(tx, userID, purpose, ttl, time.Now())
+	if err != nil {
+		return err
+	}
+	link := ""
+	if h.cfg.Accounts.AppURL != "" {
+		link = h.cfg.Accounts.AppURL + userTokenPages[purpose] + "?token=" + token
+	}
+	return queueEmail(tx, event, userID, map[string]any{
+		"Token":     token,
+		"Link":      link,
+		"ExpiresAt": expiresAt,
+	})
+}
+
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+// VerifyEmail confirms the email address of the user a verification token
+// was sent to.
+func (h *Handler) VerifyEmail(c *fiber.Ctx) error {
+	var req TokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Token is required"})
+	}
+
+	err := h.store.Transaction(func(tx repository.Store) error {
+		now := time.Now()
+		userID, err := useUserToken(tx, req.Token, models.TokenVerifyEmail, now)
+		if err != nil {
+			return err
+		}
+		return tx.Users().MarkEmailVerified(userID, now)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errUserTokenInvalid):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or already used verification token"})
+		case errors.Is(err, errUserTokenExpired):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Verification token expired. Please request a new one"})
+		}
+		log.Printf("Error verifying email: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not verify email"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Email verified successfully"})
+}
+
+// ResendVerification emails the signed-in user a new verification token.
+func (h *Handler) ResendVerification(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(uint)
+
+	err := h.store.Transaction(func(tx repository.Store) error {
+		user, err := tx.Users().FindByID(userID)
+		if err != nil {
+			return err
+		}
+		if user.EmailVerified {
+			return errAlreadyVerified
+		}
+		return h.queueTokenEmail(tx, models.EventVerifyEmail, user.ID, models.TokenVerifyEmail, h.cfg.Accounts.VerifyTTL)
+	})
+	if err != nil {
+		if errors.Is(err, errAlreadyVerified) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Email is already verified"})
+		}
+		log.Printf("Error resending verification email: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not send verification email"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Verification email sent"})
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ForgotPassword emails a password reset token to the account with the
+// given email. The response is the same whether or not the account exists,
+// and takes at least forgotPasswordResponseTime either way, so it cannot be
+// used to find out who has one. Each request counts against the client
+// address like a failed sign-in, and no new token is sent while an earlier
+// one is still unused and unexpired, so the endpoint cannot flood inboxes.
+func (h *Handler) ForgotPassword(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Email is required"})
+	}
+
+	start := time.Now()
+	var wait time.Duration
+	err := h.store.Transaction(func(tx repository.Store) error {
+		ip, err := tx.LoginThrottles().Lock(models.ThrottleIP, c.IP())
+		if err != nil {
+			return err
+		}
+		if wait = retryAfter(ip, start); wait > 0 {
+			return nil
+		}
+		h.cfg.Logins.fail(ip, h.cfg.Logins.IPMaxFailures, start)
+		if err := tx.LoginThrottles().Save(ip); err != nil {
+			return err
+		}
+
+		user, err := tx.Users().FindByEmail(req.Email)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		active, err := tx.UserTokens().CountActive(user.ID, models.TokenPasswordReset, start)
+		if err != nil || active > 0 {
+			return err
+		}
+		return h.queueTokenEmail(tx, models.EventPasswordReset, user.ID, models.TokenPasswordReset, h.cfg.Accounts.ResetTTL)
+	})
+	if err != nil {
+		log.Printf("Error requesting password reset: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not request password reset"})
+	}
+	if wait > 0 {
+		return tooManyRequests(c, wait, "Too many requests from this address. Please try again later")
+	}
+
+	time.Sleep(time.Until(start.Add(forgotPasswordResponseTime)))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "If an account exists for this email, a password reset email has been sent"})
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ResetPassword sets a new password with a reset token. It also verifies
+// the email address, since the token was read from it, lifts any sign-in
+// lockout and ends every session of the user.
+func (h *Handler) ResetPassword(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Token == "" || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Token and Password are required"})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not reset password"})
+	}
+
+	err = h.store.Transaction(func(tx repository.Store) error {
+		now := time.Now()
+		userID, err := useUserToken(tx, req.Token, models.TokenPasswordReset, now)
+		if err != nil {
+			return err
+		}
+		user, err := tx.Users().FindByID(userID)
+		if err != nil {
+			return err
+		}
+		// Sign-in locks the account's throttle before the user, so do the
+		// same here.
+		if err := clearLoginFailures(tx, user.Email); err != nil {
+			return err
+		}
+		// Any other reset emails still in the patron's inbox stop working.
+		if err := tx.UserTokens().UseAll(userID, models.TokenPasswordReset, now); err != nil {
+			return err
+		}
+		if err := tx.Users().SetPassword(userID, string(hashedPassword)); err != nil {
+			return err
+		}
+		if !user.EmailVerified {
+			if err := tx.Users().MarkEmailVerified(userID, now); err != nil {
+				return err
+			}
+		}
+		return revokeSessions(tx, userID, now)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errUserTokenInvalid):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or already used reset token"})
+		case errors.Is(err, errUserTokenExpired):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Reset token expired. Please request a new one"})
+		}
+		log.Printf("Error resetting password: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not reset password"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Password reset successfully. Please sign in again"})
+}
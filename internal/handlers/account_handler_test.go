@@ -0,0 +1,60 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+)
+
+// resetEmails counts the password reset emails queued so far.
+func (s *testServer) resetEmails() int {
+	s.t.Helper()
+	msgs, err := s.store.Outbox().List("")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	var n int
+	for _, msg := range msgs {
+		if msg.Event == models.EventPasswordReset {
+			n++
+		}
+	}
+	return n
+}
+
+func TestForgotPasswordSendsOneResetAtATime(t *testing.T) {
+	forEachStoreWith(t, strictLogins(), func(t *testing.T, s *testServer) {
+		user := s.newUser(models.RoleStudent)
+		const message = "If an account exists for this email, a password reset email has been sent"
+		for _, email := range []string{user.Email, "nobody@example.com", user.Email} {
+			if resp := s.mustDo("", "POST", "/api/password/forgot", fiber.Map{"email": email}, fiber.StatusOK); resp["message"] != message {
+				t.Errorf("asking to reset %s: got %v", email, resp)
+			}
+		}
+		if n := s.resetEmails(); n != 1 {
+			t.Errorf("got %d reset emails, want 1 while the first is outstanding", n)
+		}
+	})
+}
+
+func TestForgotPasswordThrottlesClientAddress(t *testing.T) {
+	forEachStoreWith(t, strictLogins(), func(t *testing.T, s *testServer) {
+		user := s.newUser(models.RoleStudent)
+		for i := 0; i < 5; i++ {
+			s.mustDo("", "POST", "/api/password/forgot", fiber.Map{"email": "nobody@example.com"}, fiber.StatusOK)
+		}
+
+		// Requests share the address's budget with sign-ins.
+		resp := s.send("", "POST", "/api/password/forgot", fiber.Map{"email": user.Email})
+		resp.Body.Close()
+		if resp.StatusCode != fiber.StatusTooManyRequests || resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+			t.Errorf("got %d with Retry-After %q, want 429 with a wait", resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter))
+		}
+		s.wantThrottled(user.Email)
+		if n := s.resetEmails(); n != 0 {
+			t.Errorf("got %d reset emails, want none", n)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+var (
+	errAlreadyBlocked = errors.New("user is already blocked")
+	errNotBlocked     = errors.New("user is not blocked")
+	errStillBlocked   = errors.New("block rules still apply")
+)
+
+// blockReason returns why the block rules require the user to be blocked,
+// or "" if none of them applies.
+func (h *Handler) blockReason(tx repository.Store, user *models.User, now time.Time) (string, error) {
+	rules := h.cfg.Blocking
+	if rules.FineThreshold > 0 && user.Penalty >= rules.FineThreshold {
+		return fmt.Sprintf("Outstanding fines of %d cents reach the limit of %d cents", user.Penalty, rules.FineThreshold), nil
+	}
+	if rules.OverdueDays > 0 {
+		overdue, err := tx.Borrows().CountOverdueByUser(user.ID, now.AddDate(0, 0, -rules.OverdueDays))
+		if err != nil {
+			return "", err
+		}
+		if overdue > 0 {
+			return fmt.Sprintf("A loan is more than %d days overdue", rules.OverdueDays), nil
+		}
+	}
+	return "", nil
+}
+
+// applyBlockRules blocks or unblocks the user as the block rules require
+// and reports whether anything changed. Manual blocks are left alone.
+func (h *Handler) applyBlockRules(tx repository.Store, userID uint, now time.Time) (bool, error) {
+	user, err := tx.Users().Lock(userID)
+	if err != nil {
+		return false, err
+	}
+	if user.BlockedManually {
+		return false, nil
+	}
+	reason, err := h.blockReason(tx, user, now)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case reason != "" && !user.Blocked:
+		return true, setBlocked(tx, user, true, false, reason, nil)
+	case reason == "" && user.Blocked:
+		return true, setBlocked(tx, user, false, false, "Fines and overdue loans settled", nil)
+	}
+	return false, nil
+}
+
+// setBlocked changes the user's block state and records the change. A
+// manual block also ends the user's sessions. recordedByID is nil for
+// changes made by the block rules.
+func setBlocked(tx repository.Store, user *models.User, blocked, manual bool, reason string, recordedByID *uint) error {
+	user.Blocked = blocked
+	user.BlockedManually = blocked && manual
+	user.BlockReason = ""
+	if blocked {
+		user.BlockReason = reason
+	}
+	if err := tx.Users().SaveBlock(user); err != nil {
+		return err
+	}
+	if user.BlockedManually {
+		if err := revokeSessions(tx, user.ID, time.Now()); err != nil {
+			return err
+		}
+	}
+	return tx.Blocks().Create(&models.BlockEvent{
+		UserID:       user.ID,
+		Blocked:      blocked,
+		Reason:       reason,
+		RecordedByID: recordedByID,
+	})
+}
+
+// EnforceBlockRules re-evaluates the block rules for every user they could
+// affect, which catches loans that became overdue since the last run. It
+// returns the number of users blocked or unblocked.
+func (h *Handler) EnforceBlockRules(now time.Time) (int, error) {
+	rules := h.cfg.Blocking
+	review := repository.BlockReview{MinPenalty: rules.FineThreshold}
+	if rules.OverdueDays > 0 {
+		review.DueBefore = now.AddDate(0, 0, -rules.OverdueDays)
+	}
+
+	var changed int
+	err := h.store.Transaction(func(tx repository.Store) error {
+		ids, err := tx.Users().ListForBlockReview(review)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			ok, err := h.applyBlockRules(tx, id, now)
+			if err != nil {
+				return err
+			}
+			if ok {
+				changed++
+			}
+		}
+		return nil
+	})
+	return changed, err
+}
+
+type BlockRequest struct {
+	Reason string `json:"reason"`
+}
+
+// BlockUser blocks a user by hand. The block stays until a librarian lifts
+// it, whatever the user's fines and loans.
+func (h *Handler) BlockUser(c *fiber.Ctx) error {
+	return h.changeBlock(c, true)
+}
+
+// UnblockUser lifts a block. Automatic blocks can only be lifted once the
+// block rules no longer apply.
+func (h *Handler) UnblockUser(c *fiber.Ctx) error {
+	return h.changeBlock(c, false)
+}
+
+func (h *Handler) changeBlock(c *fiber.Ctx, blocked bool) error {
+	userID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || userID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	recordedByID, _ := c.Locals("userID").(uint)
+
+	var req BlockRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Reason is required"})
+	}
+
+	var user *models.User
+	var ruleReason string
+	err = h.store.Transaction(func(tx repository.Store) error {
+		var err error
+		user, err = tx.Users().Lock(uint(userID))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errUserNotFound
+			}
+			return err
+		}
+
+		if blocked {
+			if user.BlockedManually {
+				return errAlreadyBlocked
+			}
+			return setBlocked(tx, user, true, true, req.Reason, &recordedByID)
+		}
+
+		if !user.Blocked {
+			return errNotBlocked
+		}
+		if ruleReason, err = h.blockReason(tx, user, time.Now()); err != nil {
+			return err
+		}
+		if ruleReason != "" {
+			return errStillBlocked
+		}
+		return setBlocked(tx, user, false, true, req.Reason, &recordedByID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errUserNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		case errors.Is(err, errAlreadyBlocked):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User is already blocked"})
+		case errors.Is(err, errNotBlocked):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User is not blocked"})
+		case errors.Is(err, errStillBlocked):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User cannot be unblocked yet: " + ruleReason})
+		}
+		log.Printf("Error changing user block: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update user"})
+	}
+
+	message := "User unblocked successfully"
+	if blocked {
+		message = "User blocked successfully"
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":          message,
+		"user_id":          user.ID,
+		"blocked":          user.Blocked,
+		"blocked_manually": user.BlockedManually,
+		"block_reason":     user.BlockReason,
+	})
+}
+
+// GetUserBlocks lists the block history of a user.
+func (h *Handler) GetUserBlocks(c *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || userID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	user, err := h.store.Users().FindByID(uint(userID))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		log.Printf("Database error finding user: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	events, err := h.store.Blocks().ListByUser(user.ID)
+	if err != nil {
+		log.Printf("Database error listing block events: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve block history"})
+	}
+	if events == nil {
+		events = []models.BlockEvent{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":          "Block history retrieved successfully",
+		"user_id":          user.ID,
+		"blocked":          user.Blocked,
+		"blocked_manually": user.BlockedManually,
+		"block_reason":     user.BlockReason,
+		"events":           events,
+	})
+}
@@ -1,287 +1,1069 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"gorm.io/gorm"
 
-	"library-management/internal/db"
 	"library-management/internal/models"
+	"library-management/internal/repository"
 )
 
+// CreateBookRequest adds one physical copy. The copy joins the existing
+// title with the same ISBN, or a new title is created from the fields.
+// ISBN is optional; when given it is stored as an ISBN-13.
+type CreateBookRequest struct {
+	Title     string   `json:"title"`
+	Authors   []string `json:"authors"`
+	ISBN      string   `json:"isbn"`
+	Publisher string   `json:"publisher"`
+	Year      int      `json:"year"`
+	Language  string   `json:"language"`
+	Subjects  []string `json:"subjects"`
+	Genre     string   `json:"genre"`
+	Barcode   string   `json:"barcode"`
+	Location  string   `json:"location"`
+	Condition string   `json:"condition"`
+}
 
+// DonateBookRequest records a donation by the signed-in user, or by
+// OnBehalfOfID when a librarian enters it for someone else.
 type DonateBookRequest struct {
-	Title       string `json:"title"`
-	Author      string `json:"author"`
-	Number      string `json:"number"` 
-	Genre       string `json:"genre"`
-	DonatedByID uint   `json:"donated_by_id"` 
+	CreateBookRequest
+	OnBehalfOfID uint `json:"on_behalf_of_id"`
 }
 
-type CreateBookRequest struct {
-	Title  string `json:"title"`
-	Author string `json:"author"`
-	Number string `json:"number"` 
-	Genre  string `json:"genre"`
+type AddCopyRequest struct {
+	Barcode   string `json:"barcode"`
+	Location  string `json:"location"`
+	Condition string `json:"condition"`
 }
 
+// BorrowBookRequest names either a specific copy or a title, in which case
+// any available copy of it is lent. The loan is made to the signed-in user,
+// or to OnBehalfOfID when a librarian lends to someone else.
 type BorrowBookRequest struct {
-	BookID uint `json:"book_id"`
-	UserID uint `json:"user_id"`
+	CopyID       uint `json:"copy_id"`
+	TitleID      uint `json:"title_id"`
+	OnBehalfOfID uint `json:"on_behalf_of_id"`
+}
+
+const (
+	// invalidISBN answers an ISBN that fails NormalizeISBN.
+	invalidISBN = "Invalid ISBN. Must be an ISBN-10 or ISBN-13 with a valid check digit"
+	// withdrawnISBN answers a new copy whose ISBN belongs to a withdrawn
+	// title.
+	withdrawnISBN = "A withdrawn book has this ISBN. Restore it before adding copies"
+)
+
+const (
+	// catalogPageSize is the number of titles GetAllBooks returns unless
+	// asked for another.
+	catalogPageSize = 50
+	// catalogMaxPageSize caps what GetAllBooks may be asked for.
+	catalogMaxPageSize = 200
+)
+
+var (
+	errCopyUnavailable    = errors.New("copy not found or not available")
+	errUserUnavailable    = errors.New("user not found or is blocked")
+	errBorrowLimitReached = errors.New("borrowing limit reached")
+	errBorrowNotActive    = errors.New("active borrow record not found")
+	errBarcodeTaken       = errors.New("barcode already exists")
+)
+
+func titleJSON(title *models.Title) fiber.Map {
+	return fiber.Map{
+		"id":        title.ID,
+		"title":     title.Title,
+		"authors":   title.Authors,
+		"isbn":      title.ISBN,
+		"publisher": title.Publisher,
+		"year":      title.Year,
+		"language":  title.Language,
+		"subjects":  title.Subjects,
+		"genre":     title.Genre,
+	}
+}
+
+func copyJSON(cp *models.Copy) fiber.Map {
+	return fiber.Map{
+		"id":            cp.ID,
+		"title_id":      cp.TitleID,
+		"barcode":       cp.Barcode,
+		"location":      cp.Location,
+		"condition":     cp.Condition,
+		"status":        cp.Status,
+		"donated_by_id": cp.DonatedByID,
+	}
+}
+
+// validateBookRequest checks req and normalises its ISBN.
+func validateBookRequest(req *CreateBookRequest) string {
+	if req.Title == "" || len(req.Authors) == 0 || req.Genre == "" || req.Barcode == "" {
+		return "Title, Authors, Genre, and Barcode are required"
+	}
+	if req.ISBN != "" {
+		isbn, ok := models.NormalizeISBN(req.ISBN)
+		if !ok {
+			return invalidISBN
+		}
+		req.ISBN = isbn
+	}
+	if req.Condition != "" && !models.IsValidCondition(req.Condition) {
+		return "Invalid condition. Must be 'new', 'good', 'fair', or 'poor'"
+	}
+	return ""
+}
+
+// findOrCreateTitle returns the title with the ISBN from req, creating a
+// new title from req when there is none. A withdrawn title with the ISBN
+// must be restored rather than duplicated.
+func findOrCreateTitle(tx repository.Store, req *CreateBookRequest) (*models.Title, error) {
+	if req.ISBN != "" {
+		title, err := tx.Titles().FindAnyByISBN(req.ISBN)
+		if err == nil {
+			if title.DeletedAt.Valid {
+				return nil, errISBNWithdrawn
+			}
+			return title, nil
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	title := &models.Title{
+		Title:     req.Title,
+		Authors:   req.Authors,
+		ISBN:      req.ISBN,
+		Publisher: req.Publisher,
+		Year:      req.Year,
+		Language:  req.Language,
+		Subjects:  req.Subjects,
+		Genre:     req.Genre,
+	}
+	if err := tx.Titles().Create(title); err != nil {
+		return nil, err
+	}
+	return title, nil
 }
 
+// addCopy stores a new available copy after checking its barcode is free.
+func addCopy(tx repository.Store, cp *models.Copy) error {
+	if _, err := tx.Copies().FindByBarcode(cp.Barcode); err == nil {
+		return errBarcodeTaken
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
 
+	cp.Status = models.CopyStatusAvailable
+	if cp.Condition == "" {
+		cp.Condition = models.ConditionGood
+	}
+	return tx.Copies().Create(cp)
+}
 
-func DonateBook(c *fiber.Ctx) error {
+func (h *Handler) DonateBook(c *fiber.Ctx) error {
 	req := new(DonateBookRequest)
 	if err := c.BodyParser(req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON body"})
 	}
 
-	if req.Title == "" || req.Author == "" || req.Number == "" || req.Genre == "" || req.DonatedByID == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Title, Author, Number, Genre, and DonatedByID are required for donation"})
+	if msg := validateBookRequest(&req.CreateBookRequest); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	actorID, donorID, err := actingUser(c, req.OnBehalfOfID, models.PermBooksDonateAny)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not allowed to donate on behalf of another user"})
 	}
 
-	var donorUser models.User
-	if err := db.DB.First(&donorUser, req.DonatedByID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "DonatedByID does not correspond to an existing user"})
+	if _, err := h.store.Users().FindByID(donorID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "OnBehalfOfID does not correspond to an existing user"})
 		}
 		log.Printf("Database error checking donor user: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
 	}
 
-	book := models.Book{
-		Title:       req.Title,
-		Author:      req.Author,
-		Number:      req.Number,
-		Genre:       req.Genre,
-		DonatedByID: req.DonatedByID,
-		Available:   true,
+	var title *models.Title
+	var cp *models.Copy
+	err = h.store.Transaction(func(tx repository.Store) error {
+		var err error
+		if title, err = findOrCreateTitle(tx, &req.CreateBookRequest); err != nil {
+			return err
+		}
+		cp = &models.Copy{
+			TitleID:     title.ID,
+			Barcode:     req.Barcode,
+			Location:    req.Location,
+			Condition:   req.Condition,
+			DonatedByID: donorID,
+		}
+		if err := addCopy(tx, cp); err != nil {
+			return err
+		}
+		return recordDelegation(tx, actorID, donorID, models.DelegationDonate, cp.ID, nil)
+	})
+	if err != nil {
+		if errors.Is(err, errBarcodeTaken) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Copy with this barcode already exists"})
+		}
+		if errors.Is(err, errISBNWithdrawn) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": withdrawnISBN})
+		}
+		log.Printf("Error creating donated copy: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not donate book"})
 	}
 
-	var existingBook models.Book
-	if err := db.DB.Where("number = ?", book.Number).First(&existingBook).Error; err == nil {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Book with this unique number already exists"})
-	} else if err != gorm.ErrRecordNotFound {
-		log.Printf("Database error checking for existing book: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Book donated successfully",
+		"book":    titleJSON(title),
+		"copy":    copyJSON(cp),
+	})
+}
+
+func (h *Handler) CreateBook(c *fiber.Ctx) error {
+	req := new(CreateBookRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON body"})
 	}
 
-	if err := db.DB.Create(&book).Error; err != nil {
+	if msg := validateBookRequest(req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	var title *models.Title
+	var cp *models.Copy
+	err := h.store.Transaction(func(tx repository.Store) error {
+		var err error
+		if title, err = findOrCreateTitle(tx, req); err != nil {
+			return err
+		}
+		cp = &models.Copy{
+			TitleID:   title.ID,
+			Barcode:   req.Barcode,
+			Location:  req.Location,
+			Condition: req.Condition,
+		}
+		return addCopy(tx, cp)
+	})
+	if err != nil {
+		if errors.Is(err, errBarcodeTaken) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Copy with this barcode already exists"})
+		}
+		if errors.Is(err, errISBNWithdrawn) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": withdrawnISBN})
+		}
 		log.Printf("Error creating book: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not donate book"})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create book"})
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message":   "Book donated successfully",
-		"book": fiber.Map{
-			"id":          book.ID,
-			"title":       book.Title,
-			"author":      book.Author,
-			"number":      book.Number,
-			"genre":       book.Genre,
-			"donated_by_id": book.DonatedByID,
-			"available":   book.Available,
-		},
+		"message": "Book created successfully",
+		"book":    titleJSON(title),
+		"copy":    copyJSON(cp),
 	})
 }
 
+// AddCopy adds another physical copy to an existing title.
+func (h *Handler) AddCopy(c *fiber.Ctx) error {
+	titleID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || titleID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid book ID"})
+	}
 
-func CreateBook(c *fiber.Ctx) error {
-	req := new(CreateBookRequest)
+	req := new(AddCopyRequest)
 	if err := c.BodyParser(req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON body"})
 	}
-
-	if req.Title == "" || req.Author == "" || req.Number == "" || req.Genre == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Title, Author, Number, and Genre are required"})
+	if req.Barcode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Barcode is required"})
 	}
-
-	book := models.Book{
-		Title:  req.Title,
-		Author: req.Author,
-		Number: req.Number,
-		Genre:  req.Genre,
-		Available: true, 
+	if req.Condition != "" && !models.IsValidCondition(req.Condition) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid condition. Must be 'new', 'good', 'fair', or 'poor'"})
 	}
 
-	var existingBook models.Book
-	if err := db.DB.Where("number = ?", book.Number).First(&existingBook).Error; err == nil {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Book with this unique number already exists"})
-	} else if err != gorm.ErrRecordNotFound {
-		log.Printf("Database error checking for existing book: %v", err)
+	title, err := h.store.Titles().FindByID(uint(titleID))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Book not found"})
+		}
+		log.Printf("Database error finding title: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
 	}
 
-	if err := db.DB.Create(&book).Error; err != nil {
-		log.Printf("Error creating book: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create book"})
+	cp := &models.Copy{
+		TitleID:   title.ID,
+		Barcode:   req.Barcode,
+		Location:  req.Location,
+		Condition: req.Condition,
+	}
+	err = h.store.Transaction(func(tx repository.Store) error {
+		return addCopy(tx, cp)
+	})
+	if err != nil {
+		if errors.Is(err, errBarcodeTaken) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Copy with this barcode already exists"})
+		}
+		log.Printf("Error creating copy: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not add copy"})
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": "Book created successfully",
-		"book": fiber.Map{
-			"id":        book.ID,
-			"title":     book.Title,
-			"author":    book.Author,
-			"number":    book.Number,
-			"genre":     book.Genre,
-			"available": book.Available,
-		},
+		"message": "Copy added successfully",
+		"copy":    copyJSON(cp),
 	})
 }
 
+// catalogCursor is the position a next_cursor or prev_cursor stands for,
+// sent to clients as base64url JSON. It names the sort it was made for,
+// since a position in one order means nothing in another.
+type catalogCursor struct {
+	Sort   string `json:"s"`
+	Before bool   `json:"b,omitempty"`
+	Title  string `json:"t"`
+	Year   int    `json:"y"`
+	Genre  string `json:"g"`
+	ID     uint   `json:"i"`
+}
 
-func GetAllBooks(c *fiber.Ctx) error {
-	var books []models.Book
-	if err := db.DB.Order("title ASC").Find(&books).Error; err != nil {
-		log.Printf("Database error getting all books: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve books"})
-	}
+func encodeCatalogCursor(sort string, at repository.TitleSummary, before bool) string {
+	pos := repository.CursorOf(at)
+	raw, _ := json.Marshal(catalogCursor{
+		Sort:   sort,
+		Before: before,
+		Title:  pos.Title,
+		Year:   pos.Year,
+		Genre:  pos.Genre,
+		ID:     pos.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
 
-	if len(books) == 0 {
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "No books found", "books": []models.Book{}})
+func decodeCatalogCursor(s string) (*catalogCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var cursor catalogCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, err
 	}
+	return &cursor, nil
+}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Books retrieved successfully",
-		"books":   books,
-	})
+// parseCatalogSort reads a comma-separated list of sort keys, each
+// descending when prefixed with "-". It also returns the list in a
+// canonical form for cursors to be checked against.
+func parseCatalogSort(raw string) ([]repository.TitleSort, string, error) {
+	if raw == "" {
+		raw = repository.TitleSortTitle
+	}
+	var keys []repository.TitleSort
+	var canonical []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		key := repository.TitleSort{Key: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if !repository.IsValidTitleSort(key.Key) {
+			return nil, "", fmt.Errorf("unknown sort key %q", key.Key)
+		}
+		if seen[key.Key] {
+			return nil, "", fmt.Errorf("sort key %q is given twice", key.Key)
+		}
+		seen[key.Key] = true
+		keys = append(keys, key)
+		canonical = append(canonical, part)
+	}
+	return keys, strings.Join(canonical, ","), nil
 }
 
+// parseTitleFilter reads the catalog filters ?q=, ?genre=, ?available= and
+// ?donor_id=. It returns a message for the client if one is invalid.
+func parseTitleFilter(c *fiber.Ctx) (repository.TitleFilter, string) {
+	filter := repository.TitleFilter{
+		Search: strings.TrimSpace(c.Query("q")),
+		Genre:  c.Query("genre"),
+	}
+	if raw := c.Query("available"); raw != "" {
+		available, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, "available must be true or false"
+		}
+		filter.Available = &available
+	}
+	if raw := c.Query("donor_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return filter, "Invalid donor_id"
+		}
+		filter.DonorID = uint(id)
+	}
+	return filter, ""
+}
 
-func BorrowBook(c *fiber.Ctx) error {
-	req := new(BorrowBookRequest)
-	if err := c.BodyParser(req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON body"})
+// GetAllBooks lists one page of the catalog with copy counts. ?q= searches
+// titles and authors, ?genre=, ?available=true|false and ?donor_id= filter,
+// ?sort= orders by title, year, genre or added (each descending with a "-"
+// prefix), and ?limit= sets the page size. The next_cursor and prev_cursor
+// of a response are passed back as ?cursor= to move between pages.
+func (h *Handler) GetAllBooks(c *fiber.Ctx) error {
+	filter, msg := parseTitleFilter(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	query := repository.TitleQuery{TitleFilter: filter, Limit: catalogPageSize}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > catalogMaxPageSize {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and " + strconv.Itoa(catalogMaxPageSize)})
+		}
+		query.Limit = limit
+	}
+	var sort string
+	var err error
+	query.Sort, sort, err = parseCatalogSort(c.Query("sort"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid sort: " + err.Error()})
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeCatalogCursor(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid cursor"})
+		}
+		if cursor.Sort != sort {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cursor was made for another sort order"})
+		}
+		pos := &repository.TitleCursor{Title: cursor.Title, Year: cursor.Year, Genre: cursor.Genre, ID: cursor.ID}
+		if cursor.Before {
+			query.Before = pos
+		} else {
+			query.After = pos
+		}
 	}
 
-	if req.BookID == 0 || req.UserID == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "BookID and UserID are required"})
+	total, err := h.store.Titles().CountSummaries(query.TitleFilter)
+	if err != nil {
+		log.Printf("Database error counting books: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve books"})
+	}
+	// One title more than the page shows whether there is another page
+	// in the direction of travel.
+	limit := query.Limit
+	query.Limit++
+	books, err := h.store.Titles().ListSummaries(query)
+	if err != nil {
+		log.Printf("Database error listing books: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve books"})
+	}
+	more := len(books) > limit
+	if more && query.Before != nil {
+		books = books[1:]
+	} else if more {
+		books = books[:limit]
 	}
 
-	var book models.Book
-	if err := db.DB.Where("id = ? AND available = ?", req.BookID, true).First(&book).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Book not found or not available"})
+	var next, prev any
+	if len(books) > 0 {
+		if more || query.Before != nil {
+			next = encodeCatalogCursor(sort, books[len(books)-1], false)
+		}
+		if (more && query.Before != nil) || query.After != nil {
+			prev = encodeCatalogCursor(sort, books[0], true)
 		}
-		log.Printf("Database error finding book for borrowing: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
 	}
 
-	var user models.User
-	if err := db.DB.Where("id = ? AND blocked = ?", req.UserID, false).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found or is blocked"})
-		}
-		log.Printf("Database error finding user for borrowing: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	message := "Books retrieved successfully"
+	if len(books) == 0 {
+		message = "No books found"
+		books = []repository.TitleSummary{}
 	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":     message,
+		"books":       books,
+		"total":       total,
+		"next_cursor": next,
+		"prev_cursor": prev,
+	})
+}
 
-	if user.Role == models.RoleStudent {
-		var borrowedBooksCount int64
-		db.DB.Model(&models.Borrow{}).Where("user_id = ? AND returned = ?", req.UserID, false).Count(&borrowedBooksCount)
-		if borrowedBooksCount >= 3 {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Student has reached the maximum borrowing limit of 3 books"})
+// GetBookCopies lists the physical copies of a title with their status.
+func (h *Handler) GetBookCopies(c *fiber.Ctx) error {
+	titleID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || titleID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid book ID"})
+	}
+
+	if _, err := h.store.Titles().FindByID(uint(titleID)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Book not found"})
 		}
+		log.Printf("Database error finding title: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
 	}
 
-	if err := db.DB.Model(&book).Update("available", false).Error; err != nil {
-		log.Printf("Error updating book availability: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update book availability"})
+	copies, err := h.store.Copies().ListByTitle(uint(titleID))
+	if err != nil {
+		log.Printf("Database error listing copies: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve copies"})
+	}
+	if copies == nil {
+		copies = []models.Copy{}
 	}
 
-	borrowDate := time.Now()
-	dueDate := borrowDate.AddDate(0, 0, 7)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Copies retrieved successfully",
+		"copies":  copies,
+	})
+}
 
-	borrow := models.Borrow{
-		BookID:     req.BookID,
-		UserID:     req.UserID,
-		BorrowDate: borrowDate,
-		DueDate:    dueDate,
-		Returned:   false,
+func (h *Handler) BorrowBook(c *fiber.Ctx) error {
+	req := new(BorrowBookRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON body"})
 	}
 
-	if err := db.DB.Create(&borrow).Error; err != nil {
-		log.Printf("Error creating borrow record: %v", err)
-		db.DB.Model(&book).Update("available", true) 
+	if req.CopyID == 0 && req.TitleID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Either CopyID or TitleID is required"})
+	}
+	actorID, userID, err := actingUser(c, req.OnBehalfOfID, models.PermBorrowsCreateAny)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not allowed to borrow on behalf of another user"})
+	}
+
+	var borrow *models.Borrow
+	var titleID uint
+	err = h.store.Transaction(func(tx repository.Store) error {
+		// Lock the copy row first so that two requests for the same copy
+		// serialize here and the loser no longer sees it as available.
+		var cp *models.Copy
+		var err error
+		if req.CopyID != 0 {
+			cp, err = tx.Copies().LockAvailable(req.CopyID)
+		} else {
+			cp, err = tx.Copies().LockAvailableForTitle(req.TitleID)
+		}
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errCopyUnavailable
+			}
+			return err
+		}
+
+		titleID = cp.TitleID
+		if borrow, err = lend(tx, cp, userID); err != nil {
+			return err
+		}
+		return recordDelegation(tx, actorID, userID, models.DelegationBorrow, cp.ID, &borrow.ID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errCopyUnavailable):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No available copy found. Place a hold to join the queue"})
+		case errors.Is(err, errUserUnavailable):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found or is blocked"})
+		case errors.Is(err, errBorrowLimitReached):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Patron has reached the maximum number of concurrent loans"})
+		case errors.Is(err, errEmailUnverified):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Patron must verify their email address before borrowing"})
+		}
+		log.Printf("Error recording borrow transaction: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record borrow transaction"})
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message":   "Book borrowed successfully",
 		"borrow_id": borrow.ID,
-		"book_id":   borrow.BookID,
+		"copy_id":   borrow.CopyID,
+		"title_id":  titleID,
 		"user_id":   borrow.UserID,
 		"due_date":  borrow.DueDate,
 	})
 }
 
-func ReturnBook(c *fiber.Ctx) error {
-	borrowID, err := strconv.ParseUint(c.Params("id"), 10, 32) 
+// ReturnBook returns a loan. Returning someone else's loan needs the
+// borrows:return-any permission and is recorded as a delegation.
+func (h *Handler) ReturnBook(c *fiber.Ctx) error {
+	borrowID, err := strconv.ParseUint(c.Params("id"), 10, 32)
 	if err != nil || borrowID == 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid borrow ID"})
 	}
+	actorID, _ := c.Locals("userID").(uint)
+	returnAny := hasPermission(c, models.PermBorrowsReturnAny)
+
+	var borrow *models.Borrow
+	var hold *models.Hold
+	var fineAmount int64
+	err = h.store.Transaction(func(tx repository.Store) error {
+		// The row lock makes a second concurrent return of the same loan
+		// wait, then find returned = true and fail instead of fining twice.
+		var err error
+		borrow, err = tx.Borrows().LockActive(uint(borrowID))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errBorrowNotActive
+			}
+			return err
+		}
+		if borrow.UserID != actorID && !returnAny {
+			return errNotOwnLoan
+		}
+
+		cp, err := tx.Copies().FindByID(borrow.CopyID)
+		if err != nil {
+			return err
+		}
+		title, err := tx.Titles().FindByID(cp.TitleID)
+		if err != nil {
+			return err
+		}
+
+		returnDate := time.Now()
+		if returnDate.After(borrow.DueDate) {
+			overdueDuration := returnDate.Sub(borrow.DueDate)
+			overdueDays := int(overdueDuration.Hours() / 24)
+			if overdueDuration.Hours()/24 > float64(overdueDays) {
+				overdueDays++
+			}
+
+			user, err := tx.Users().FindByID(borrow.UserID)
+			if err != nil {
+				return err
+			}
+			policy, err := resolvePolicy(tx, user.Role, title.Genre)
+			if err != nil {
+				return err
+			}
+			fineAmount = policy.Fine(overdueDays)
+		}
+
+		borrow.ReturnDate = &returnDate
+		borrow.Returned = true
+		borrow.FineAmount = fineAmount
+		if err := tx.Borrows().Save(borrow); err != nil {
+			return err
+		}
+
+		if hold, err = releaseCopy(tx, cp.ID, cp.TitleID, returnDate); err != nil {
+			return err
+		}
+		if err := recordDelegation(tx, actorID, borrow.UserID, models.DelegationReturn, cp.ID, &borrow.ID); err != nil {
+			return err
+		}
 
-	var borrow models.Borrow
-	if err := db.DB.Where("id = ? AND returned = ?", borrowID, false).First(&borrow).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+		err = queueEmail(tx, models.EventReturn, borrow.UserID, map[string]any{
+			"BorrowID":   borrow.ID,
+			"Title":      title.Title,
+			"Barcode":    cp.Barcode,
+			"DueDate":    borrow.DueDate,
+			"ReturnDate": returnDate,
+			"Fine":       fineAmount,
+		})
+		if err != nil {
+			return err
+		}
+		if fineAmount > 0 {
+			if err := chargeFine(tx, borrow, title, fineAmount); err != nil {
+				return err
+			}
+		}
+		_, err = h.applyBlockRules(tx, borrow.UserID, returnDate)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errBorrowNotActive):
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Active borrow record not found for this ID"})
+		case errors.Is(err, errNotOwnLoan):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can only return your own loans"})
+		}
+		log.Printf("Error recording return transaction: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update borrow record"})
+	}
+
+	response := fiber.Map{
+		"message":       "Book returned successfully",
+		"borrow_id":     borrow.ID,
+		"copy_id":       borrow.CopyID,
+		"user_id":       borrow.UserID,
+		"fine_incurred": fineAmount,
+		"is_overdue":    fineAmount > 0,
+	}
+	if hold != nil {
+		response["set_aside_for_hold_id"] = hold.ID
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// lend checks the patron against the circulation policy for cp and records
+// cp as on loan to them. The caller must already hold the lock on cp.
+func lend(tx repository.Store, cp *models.Copy, userID uint) (*models.Borrow, error) {
+	// Locking the user row serializes concurrent borrows by the same
+	// patron, which keeps the loan count below stable until commit.
+	user, err := tx.Users().LockActive(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errUserUnavailable
+		}
+		return nil, err
+	}
+
+	if !user.EmailVerified {
+		return nil, errEmailUnverified
+	}
+
+	title, err := tx.Titles().FindByID(cp.TitleID)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := resolvePolicy(tx, user.Role, title.Genre)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.MaxLoans > 0 {
+		activeLoans, err := tx.Borrows().CountActiveByUser(user.ID, policy.Genre)
+		if err != nil {
+			return nil, err
+		}
+		if activeLoans >= int64(policy.MaxLoans) {
+			return nil, errBorrowLimitReached
+		}
+	}
+
+	if err := tx.Copies().SetStatus(cp.ID, models.CopyStatusOnLoan); err != nil {
+		return nil, err
+	}
+
+	borrowDate := time.Now()
+	borrow := &models.Borrow{
+		CopyID:     cp.ID,
+		UserID:     user.ID,
+		BorrowDate: borrowDate,
+		DueDate:    borrowDate.AddDate(0, 0, policy.LoanDays),
+		Returned:   false,
+	}
+	if err := tx.Borrows().Create(borrow); err != nil {
+		return nil, err
+	}
+	err = queueEmail(tx, models.EventBorrow, user.ID, map[string]any{
+		"BorrowID":   borrow.ID,
+		"Title":      title.Title,
+		"Barcode":    cp.Barcode,
+		"BorrowDate": borrow.BorrowDate,
+		"DueDate":    borrow.DueDate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return borrow, nil
+}
+
+// UpdateBookRequest changes the fields of a title that are present.
+type UpdateBookRequest struct {
+	Title     *string   `json:"title"`
+	Authors   *[]string `json:"authors"`
+	ISBN      *string   `json:"isbn"`
+	Publisher *string   `json:"publisher"`
+	Year      *int      `json:"year"`
+	Language  *string   `json:"language"`
+	Subjects  *[]string `json:"subjects"`
+	Genre     *string   `json:"genre"`
+}
+
+var (
+	errISBNTaken         = errors.New("another title has this ISBN")
+	errISBNWithdrawn     = errors.New("a withdrawn title has this ISBN")
+	errTitleOnLoan       = errors.New("a copy of the title is on loan")
+	errTitleHeld         = errors.New("the title has active holds")
+	errTitleWithdrawn    = errors.New("title is already withdrawn")
+	errTitleNotWithdrawn = errors.New("title is not withdrawn")
+)
+
+// bookDetailJSON describes a title for librarians: its fields, the counts
+// of its copies, whether it has been withdrawn and any ISBN that failed
+// validation.
+func bookDetailJSON(title *models.Title, copies []models.Copy) fiber.Map {
+	book := titleJSON(title)
+	var available int
+	for _, cp := range copies {
+		if cp.Status == models.CopyStatusAvailable {
+			available++
+		}
+	}
+	book["total_copies"] = len(copies)
+	book["available_copies"] = available
+	book["invalid_isbn"] = title.InvalidISBN
+	book["withdrawn"] = title.DeletedAt.Valid
+	book["withdrawn_at"] = nil
+	if title.DeletedAt.Valid {
+		book["withdrawn_at"] = title.DeletedAt.Time
+	}
+	return book
+}
+
+func bookIDParam(c *fiber.Ctx) (uint, bool) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	return uint(id), err == nil && id != 0
+}
+
+// GetBook returns a title, withdrawn or not, with its copy counts.
+func (h *Handler) GetBook(c *fiber.Ctx) error {
+	titleID, ok := bookIDParam(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid book ID"})
+	}
+
+	title, err := h.store.Titles().FindAny(titleID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Book not found"})
 		}
-		log.Printf("Database error finding borrow record for return: %v", err)
+		log.Printf("Database error finding title: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	copies, err := h.store.Copies().ListAnyByTitle(title.ID)
+	if err != nil {
+		log.Printf("Database error listing copies: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
 	}
 
-	returnDate := time.Now()
-	fineAmount := 0.0
-	if returnDate.After(borrow.DueDate) {
-		overdueDuration := returnDate.Sub(borrow.DueDate)
-		overdueDays := int(overdueDuration.Hours() / 24)
-		if overdueDuration.Hours()/24 > float64(overdueDays) { 
-			overdueDays++
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Book retrieved successfully",
+		"book":    bookDetailJSON(title, copies),
+	})
+}
+
+// UpdateBook corrects the bibliographic fields of a title. Withdrawn titles
+// can be corrected too, before they are restored.
+func (h *Handler) UpdateBook(c *fiber.Ctx) error {
+	titleID, ok := bookIDParam(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid book ID"})
+	}
+	req := new(UpdateBookRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON body"})
+	}
+	if (req.Title != nil && *req.Title == "") || (req.Authors != nil && len(*req.Authors) == 0) || (req.Genre != nil && *req.Genre == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Title, Authors and Genre cannot be empty"})
+	}
+	if req.Year != nil && *req.Year < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Year cannot be negative"})
+	}
+	if req.ISBN != nil && *req.ISBN != "" {
+		isbn, ok := models.NormalizeISBN(*req.ISBN)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": invalidISBN})
 		}
-		fineAmount = float64(overdueDays) * 1.0
+		req.ISBN = &isbn
 	}
 
-	// Update borrow record
-	borrow.ReturnDate = &returnDate 
-	borrow.Returned = true           
-	borrow.FineAmount = fineAmount   
+	var title *models.Title
+	var copies []models.Copy
+	err := h.store.Transaction(func(tx repository.Store) error {
+		var err error
+		title, err = tx.Titles().Lock(titleID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errTitleNotFound
+			}
+			return err
+		}
 
-	if err := db.DB.Save(&borrow).Error; err != nil {
-		log.Printf("Error updating borrow record for return: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update borrow record"})
+		if req.ISBN != nil && *req.ISBN != "" && *req.ISBN != title.ISBN {
+			// Withdrawn titles count too, or restoring them would fail.
+			other, err := tx.Titles().FindAnyByISBN(*req.ISBN)
+			if err == nil && other.ID != title.ID {
+				return errISBNTaken
+			} else if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+		}
+		if req.Title != nil {
+			title.Title = *req.Title
+		}
+		if req.Authors != nil {
+			title.Authors = *req.Authors
+		}
+		if req.ISBN != nil {
+			title.ISBN = *req.ISBN
+			title.InvalidISBN = ""
+		}
+		if req.Publisher != nil {
+			title.Publisher = *req.Publisher
+		}
+		if req.Year != nil {
+			title.Year = *req.Year
+		}
+		if req.Language != nil {
+			title.Language = *req.Language
+		}
+		if req.Subjects != nil {
+			title.Subjects = *req.Subjects
+		}
+		if req.Genre != nil {
+			title.Genre = *req.Genre
+		}
+		if err := tx.Titles().Update(title); err != nil {
+			return err
+		}
+		copies, err = tx.Copies().ListAnyByTitle(title.ID)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errTitleNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Book not found"})
+		case errors.Is(err, errISBNTaken):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Another book already has this ISBN"})
+		}
+		log.Printf("Error updating book: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update book"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Book updated successfully",
+		"book":    bookDetailJSON(title, copies),
+	})
+}
+
+// WithdrawBook takes a title and its copies out of the catalog. They are
+// only soft-deleted, so RestoreBook can bring them back and loan history
+// keeps pointing at them. A title with a copy on loan or with patrons
+// holding it cannot be withdrawn.
+func (h *Handler) WithdrawBook(c *fiber.Ctx) error {
+	titleID, ok := bookIDParam(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid book ID"})
 	}
 
-	var book models.Book
-	if err := db.DB.First(&book, borrow.BookID).Error; err != nil {
-		log.Printf("Error finding book to update availability after return: %v", err)
-	} else {
-		if err := db.DB.Model(&book).Update("available", true).Error; err != nil {
-			log.Printf("Error updating book availability after return: %v", err)
+	var title *models.Title
+	err := h.store.Transaction(func(tx repository.Store) error {
+		var err error
+		title, err = tx.Titles().Lock(titleID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errTitleNotFound
+			}
+			return err
+		}
+		if title.DeletedAt.Valid {
+			return errTitleWithdrawn
+		}
+		// Locking the copies makes a borrow of one of them either finish
+		// first, and be seen here, or wait and find the copy gone.
+		copies, err := tx.Copies().LockByTitle(title.ID)
+		if err != nil {
+			return err
+		}
+		for _, cp := range copies {
+			if cp.Status == models.CopyStatusOnLoan {
+				return errTitleOnLoan
+			}
+		}
+		holds, err := tx.Holds().List(repository.HoldFilter{
+			TitleID:  title.ID,
+			Statuses: []string{models.HoldStatusWaiting, models.HoldStatusReady},
+		})
+		if err != nil {
+			return err
+		}
+		if len(holds) > 0 {
+			return errTitleHeld
+		}
+
+		if err := tx.Copies().WithdrawByTitle(title.ID); err != nil {
+			return err
+		}
+		return tx.Titles().Withdraw(title.ID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errTitleNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Book not found"})
+		case errors.Is(err, errTitleWithdrawn):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Book is already withdrawn"})
+		case errors.Is(err, errTitleOnLoan):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Book cannot be withdrawn while a copy is on loan"})
+		case errors.Is(err, errTitleHeld):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Book cannot be withdrawn while patrons hold it. Cancel the holds first"})
 		}
+		log.Printf("Error withdrawing book: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not withdraw book"})
 	}
 
-	var user models.User
-	if err := db.DB.First(&user, borrow.UserID).Error; err != nil {
-		log.Printf("Error finding user to update penalty after return: %v", err)
-	} else {
-		user.Penalty += fineAmount 
-		if err := db.DB.Save(&user).Error; err != nil {
-			log.Printf("Error updating user penalty: %v", err)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Book withdrawn successfully",
+		"book_id": title.ID,
+	})
+}
+
+// RestoreBook puts a withdrawn title back in the catalog with its copies.
+func (h *Handler) RestoreBook(c *fiber.Ctx) error {
+	titleID, ok := bookIDParam(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid book ID"})
+	}
+
+	var title *models.Title
+	var copies []models.Copy
+	err := h.store.Transaction(func(tx repository.Store) error {
+		var err error
+		title, err = tx.Titles().Lock(titleID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errTitleNotFound
+			}
+			return err
+		}
+		if !title.DeletedAt.Valid {
+			return errTitleNotWithdrawn
+		}
+		// A title with the same ISBN may have been added since this one
+		// was withdrawn.
+		if title.ISBN != "" {
+			if _, err := tx.Titles().FindByISBN(title.ISBN); err == nil {
+				return errISBNTaken
+			} else if !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
 		}
+		if err := tx.Titles().Restore(title.ID); err != nil {
+			return err
+		}
+		if err := tx.Copies().RestoreByTitle(title.ID); err != nil {
+			return err
+		}
+		if title, err = tx.Titles().FindByID(title.ID); err != nil {
+			return err
+		}
+		copies, err = tx.Copies().ListAnyByTitle(title.ID)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errTitleNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Book not found"})
+		case errors.Is(err, errTitleNotWithdrawn):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Book is not withdrawn"})
+		case errors.Is(err, errISBNTaken):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Another book now has this ISBN"})
+		}
+		log.Printf("Error restoring book: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not restore book"})
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message":     "Book returned successfully",
-		"borrow_id":   borrow.ID,
-		"book_id":     borrow.BookID,
-		"user_id":     borrow.UserID,
-		"fine_incurred": fineAmount,
-		"is_overdue":  fineAmount > 0,
+		"message": "Book restored successfully",
+		"book":    bookDetailJSON(title, copies),
 	})
-}
\ No newline at end of file
+}
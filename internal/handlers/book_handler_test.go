@@ -0,0 +1,48 @@
+package handlers_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+)
+
+func TestWithdrawnISBNIsNotDuplicated(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		book := fiber.Map{"title": "Dune", "authors": []string{"Frank Herbert"}, "genre": "SF", "isbn": "0-441-01359-7", "barcode": "B1"}
+		resp := s.mustDo(librarian, "POST", "/api/books", book, fiber.StatusCreated)
+		titleID := jsonID(resp["book"].(map[string]any)["id"])
+		s.mustDo(librarian, "DELETE", fmt.Sprintf("/api/books/%d", titleID), nil, fiber.StatusOK)
+
+		book["barcode"] = "B2"
+		s.mustDo(librarian, "POST", "/api/books", book, fiber.StatusConflict)
+		otherID, _ := s.addTitle(librarian, "Children of Dune", "SF", "B3")
+		s.mustDo(librarian, "PATCH", fmt.Sprintf("/api/books/%d", otherID), fiber.Map{"isbn": "9780441013593"}, fiber.StatusConflict)
+		s.mustDo(librarian, "POST", fmt.Sprintf("/api/books/%d/restore", titleID), nil, fiber.StatusOK)
+		resp = s.mustDo(librarian, "POST", "/api/books", book, fiber.StatusCreated)
+		if id := jsonID(resp["book"].(map[string]any)["id"]); id != titleID {
+			t.Errorf("copy added to title %d, want the restored title %d", id, titleID)
+		}
+	})
+}
+
+func TestGetWithdrawnBookCountsCopies(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		titleID, _ := s.addTitle(librarian, "Dune", "SF", "B1", "B2")
+		path := fmt.Sprintf("/api/books/%d", titleID)
+		s.mustDo(librarian, "DELETE", path, nil, fiber.StatusOK)
+
+		book := s.mustDo(librarian, "GET", path, nil, fiber.StatusOK)["book"].(map[string]any)
+		if book["withdrawn"] != true || book["total_copies"] != 2.0 {
+			t.Errorf("got withdrawn %v with %v copies, want a withdrawn title with 2", book["withdrawn"], book["total_copies"])
+		}
+		book = s.mustDo(librarian, "PATCH", path, fiber.Map{"genre": "Science fiction"}, fiber.StatusOK)["book"].(map[string]any)
+		if book["total_copies"] != 2.0 {
+			t.Errorf("got %v copies after updating the withdrawn title, want 2", book["total_copies"])
+		}
+	})
+}
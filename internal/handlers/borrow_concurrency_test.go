@@ -0,0 +1,226 @@
+package handlers_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+// parallel runs n calls of fn at once and returns how many answered with
+// each status.
+func parallel(n int, fn func(i int) int) map[int]int {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	statuses := make(map[int]int)
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			status := fn(i)
+			mu.Lock()
+			statuses[status]++
+			mu.Unlock()
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return statuses
+}
+
+// setMaxLoans makes role's default circulation policy allow max loans.
+func setMaxLoans(t *testing.T, store repository.Store, role string, max int) {
+	t.Helper()
+	policy, err := store.Policies().FindExact(role, "")
+	if err == nil {
+		policy.MaxLoans = max
+		err = store.Policies().Save(policy)
+	} else {
+		err = store.Policies().Create(&models.CirculationPolicy{
+			Role: role, LoanDays: 7, MaxLoans: max, FineRate: 100, MaxRenewals: 2,
+		})
+	}
+	if err != nil {
+		t.Fatalf("setting max loans: %v", err)
+	}
+}
+
+func TestConcurrentBorrowsOfOneCopy(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		_, copyIDs := s.addTitle(librarian, "Dune", "SF", "B1")
+		const patrons = 10
+		tokens := make([]string, patrons)
+		for i := range tokens {
+			_, tokens[i] = s.user(models.RoleGeneral)
+		}
+
+		statuses := parallel(patrons, func(i int) int {
+			status, _ := s.do(tokens[i], "POST", "/api/books/borrow", fiber.Map{"copy_id": copyIDs[0]})
+			return status
+		})
+		if statuses[fiber.StatusCreated] != 1 || statuses[fiber.StatusNotFound] != patrons-1 {
+			t.Fatalf("got statuses %v, want one loan and %d refusals", statuses, patrons-1)
+		}
+		cp, err := s.store.Copies().FindByID(copyIDs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cp.Status != models.CopyStatusOnLoan {
+			t.Errorf("copy status is %q, want %q", cp.Status, models.CopyStatusOnLoan)
+		}
+	})
+}
+
+func TestConcurrentBorrowsRespectMaxLoans(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		const maxLoans, attempts = 2, 8
+		_, librarian := s.user(models.RoleLibrarian)
+		studentID, student := s.user(models.RoleStudent)
+		setMaxLoans(t, s.store, models.RoleStudent, maxLoans)
+		var copyIDs []uint
+		for i := 0; i < attempts; i++ {
+			_, ids := s.addTitle(librarian, fmt.Sprintf("Title %d", i), "SF", fmt.Sprintf("B%d", i))
+			copyIDs = append(copyIDs, ids...)
+		}
+
+		statuses := parallel(attempts, func(i int) int {
+			status, _ := s.do(student, "POST", "/api/books/borrow", fiber.Map{"copy_id": copyIDs[i]})
+			return status
+		})
+		if statuses[fiber.StatusCreated] != maxLoans || statuses[fiber.StatusForbidden] != attempts-maxLoans {
+			t.Fatalf("got statuses %v, want %d loans and %d refusals", statuses, maxLoans, attempts-maxLoans)
+		}
+		active, err := s.store.Borrows().CountActiveByUser(studentID, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active != maxLoans {
+			t.Errorf("student has %d active loans, want %d", active, maxLoans)
+		}
+	})
+}
+
+func TestConcurrentReturnsFineOnce(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		studentID, student := s.user(models.RoleStudent)
+		titleID, _ := s.addTitle(librarian, "Dune", "SF", "B1")
+		resp := s.mustDo(student, "POST", "/api/books/borrow", fiber.Map{"title_id": titleID}, fiber.StatusCreated)
+		borrowID := jsonID(resp["borrow_id"])
+
+		// Make the loan three days overdue.
+		borrow, err := s.store.Borrows().FindByID(borrowID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		borrow.DueDate = time.Now().AddDate(0, 0, -3)
+		if err := s.store.Borrows().Save(borrow); err != nil {
+			t.Fatal(err)
+		}
+
+		const returns = 10
+		path := fmt.Sprintf("/api/books/return/%d", borrowID)
+		statuses := parallel(returns, func(i int) int {
+			token := student
+			if i%2 == 1 {
+				token = librarian
+			}
+			status, _ := s.do(token, "POST", path, nil)
+			return status
+		})
+		if statuses[fiber.StatusOK] != 1 || statuses[fiber.StatusNotFound] != returns-1 {
+			t.Fatalf("got statuses %v, want one return and %d refusals", statuses, returns-1)
+		}
+
+		entries, err := s.store.Fines().ListByUser(studentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var charges int
+		for _, e := range entries {
+			if e.Kind == models.FineKindCharge {
+				charges++
+			}
+		}
+		user, err := s.store.Users().FindByID(studentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if charges != 1 || user.Penalty == 0 || user.Penalty != entries[0].Amount {
+			t.Errorf("got %d fine charges and a penalty of %d, want one charge of the penalty", charges, user.Penalty)
+		}
+	})
+}
+
+// TestConcurrentBorrowAndReturnChurn has patrons borrow and return a few
+// copies over and over at once, then checks that no copy was ever lent
+// twice and that every copy's status matches its loans.
+func TestConcurrentBorrowAndReturnChurn(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		const patrons, rounds = 8, 6
+		_, librarian := s.user(models.RoleLibrarian)
+		titleID, copyIDs := s.addTitle(librarian, "Dune", "SF", "B1", "B2", "B3")
+		ids := make([]uint, patrons)
+		tokens := make([]string, patrons)
+		for i := range tokens {
+			ids[i], tokens[i] = s.user(models.RoleStudent)
+		}
+
+		var mu sync.Mutex
+		lent := make(map[uint]uint) // copy id -> borrow id of its current loan
+		parallel(patrons, func(i int) int {
+			for r := 0; r < rounds; r++ {
+				status, resp := s.do(tokens[i], "POST", "/api/books/borrow", fiber.Map{"title_id": titleID})
+				if status != fiber.StatusCreated {
+					continue
+				}
+				copyID, borrowID := jsonID(resp["copy_id"]), jsonID(resp["borrow_id"])
+				mu.Lock()
+				if other, ok := lent[copyID]; ok {
+					t.Errorf("copy %d lent by borrow %d while borrow %d was active", copyID, borrowID, other)
+				}
+				lent[copyID] = borrowID
+				mu.Unlock()
+
+				// Keep the copy a while, then forget the loan before
+				// returning it, so that a borrow slipping in right after
+				// the return commits is not reported.
+				s.do(tokens[i], "GET", "/api/books", nil)
+				mu.Lock()
+				delete(lent, copyID)
+				mu.Unlock()
+				if status, resp := s.do(tokens[i], "POST", fmt.Sprintf("/api/books/return/%d", borrowID), nil); status != fiber.StatusOK {
+					t.Errorf("returning borrow %d: %d %v", borrowID, status, resp)
+				}
+			}
+			return 0
+		})
+
+		for _, id := range ids {
+			active, err := s.store.Borrows().CountActiveByUser(id, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if active != 0 {
+				t.Errorf("user %d still has %d active loans", id, active)
+			}
+		}
+		for _, id := range copyIDs {
+			cp, err := s.store.Copies().FindByID(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cp.Status != models.CopyStatusAvailable {
+				t.Errorf("copy %d is %q after every loan was returned", id, cp.Status)
+			}
+		}
+	})
+}
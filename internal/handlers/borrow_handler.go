@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+var (
+	errRenewalLimitReached = errors.New("renewal limit reached")
+	errRenewalHeld         = errors.New("another patron has a hold on this title")
+	errRenewalOverdue      = errors.New("loan is overdue")
+	errRenewalUnpaidFines  = errors.New("patron has unpaid fines")
+)
+
+// RenewBorrow pushes the due date of an active loan out by another loan
+// period, if the circulation policy and renewal rules allow it. Renewing
+// someone else's loan needs the borrows:create-any permission and is
+// recorded as a delegation.
+func (h *Handler) RenewBorrow(c *fiber.Ctx) error {
+	borrowID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || borrowID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid borrow ID"})
+	}
+	renewedByID, _ := c.Locals("userID").(uint)
+	renewAny := hasPermission(c, models.PermBorrowsCreateAny)
+
+	rules := h.cfg.Renewals
+	var policy *models.CirculationPolicy
+	var borrow *models.Borrow
+	var renewal *models.Renewal
+	err = h.store.Transaction(func(tx repository.Store) error {
+		var err error
+		borrow, err = tx.Borrows().LockActive(uint(borrowID))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errBorrowNotActive
+			}
+			return err
+		}
+		if borrow.UserID != renewedByID && !renewAny {
+			return errNotOwnLoan
+		}
+
+		user, err := tx.Users().FindByID(borrow.UserID)
+		if err != nil {
+			return err
+		}
+		cp, err := tx.Copies().FindByID(borrow.CopyID)
+		if err != nil {
+			return err
+		}
+		title, err := tx.Titles().FindByID(cp.TitleID)
+		if err != nil {
+			return err
+		}
+		if policy, err = resolvePolicy(tx, user.Role, title.Genre); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if borrow.RenewCount >= policy.MaxRenewals {
+			return errRenewalLimitReached
+		}
+		if rules.DenyWhenOverdue && now.After(borrow.DueDate) {
+			return errRenewalOverdue
+		}
+		if rules.DenyWithUnpaidFines && user.Penalty > 0 {
+			return errRenewalUnpaidFines
+		}
+
+		if rules.DenyWhenHeld {
+			waiting, err := tx.Holds().List(repository.HoldFilter{
+				TitleID:  cp.TitleID,
+				Statuses: []string{models.HoldStatusWaiting},
+			})
+			if err != nil {
+				return err
+			}
+			for _, hold := range waiting {
+				if hold.UserID != borrow.UserID {
+					return errRenewalHeld
+				}
+			}
+		}
+
+		renewal = &models.Renewal{
+			BorrowID:        borrow.ID,
+			RenewedByID:     renewedByID,
+			RenewedAt:       now,
+			PreviousDueDate: borrow.DueDate,
+			NewDueDate:      borrow.DueDate.AddDate(0, 0, policy.LoanDays),
+		}
+		borrow.DueDate = renewal.NewDueDate
+		borrow.RenewCount++
+		if err := tx.Borrows().Save(borrow); err != nil {
+			return err
+		}
+		if err := tx.Renewals().Create(renewal); err != nil {
+			return err
+		}
+		return recordDelegation(tx, renewedByID, borrow.UserID, models.DelegationRenew, borrow.CopyID, &borrow.ID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errBorrowNotActive):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Active borrow record not found for this ID"})
+		case errors.Is(err, errNotOwnLoan):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can only renew your own loans"})
+		case errors.Is(err, errRenewalLimitReached):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This loan has reached the maximum of " + strconv.Itoa(policy.MaxRenewals) + " renewals"})
+		case errors.Is(err, errRenewalOverdue):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Overdue loans cannot be renewed. Please return the book"})
+		case errors.Is(err, errRenewalUnpaidFines):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Loans cannot be renewed while there are unpaid fines"})
+		case errors.Is(err, errRenewalHeld):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Another patron is waiting for this book, so it cannot be renewed"})
+		}
+		log.Printf("Error renewing borrow: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not renew loan"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":           "Loan renewed successfully",
+		"borrow_id":         borrow.ID,
+		"previous_due_date": renewal.PreviousDueDate,
+		"due_date":          borrow.DueDate,
+		"renew_count":       borrow.RenewCount,
+		"renewals_left":     policy.MaxRenewals - borrow.RenewCount,
+	})
+}
+
+// GetBorrowRenewals lists the renewal history of a loan.
+func (h *Handler) GetBorrowRenewals(c *fiber.Ctx) error {
+	borrowID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || borrowID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid borrow ID"})
+	}
+
+	if _, err := h.store.Borrows().FindByID(uint(borrowID)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Borrow record not found"})
+		}
+		log.Printf("Database error finding borrow: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	renewals, err := h.store.Renewals().ListByBorrow(uint(borrowID))
+	if err != nil {
+		log.Printf("Database error listing renewals: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve renewals"})
+	}
+	if renewals == nil {
+		renewals = []models.Renewal{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Renewals retrieved successfully",
+		"renewals": renewals,
+	})
+}
@@ -0,0 +1,34 @@
+package handlers_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+)
+
+func TestRenewOwnLoanOnly(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		librarianID, librarian := s.user(models.RoleLibrarian)
+		studentID, student := s.user(models.RoleStudent)
+		_, other := s.user(models.RoleStudent)
+		titleID, _ := s.addTitle(librarian, "Dune", "SF", "B1")
+		resp := s.mustDo(student, "POST", "/api/books/borrow", fiber.Map{"title_id": titleID}, fiber.StatusCreated)
+		path := fmt.Sprintf("/api/borrows/%d/renew", jsonID(resp["borrow_id"]))
+
+		s.mustDo(other, "POST", path, nil, fiber.StatusForbidden)
+		s.mustDo(student, "POST", path, nil, fiber.StatusOK)
+		s.mustDo(librarian, "POST", path, nil, fiber.StatusOK)
+
+		delegations := s.mustDo(librarian, "GET", "/api/delegations", nil, fiber.StatusOK)["delegations"].([]any)
+		if len(delegations) != 1 {
+			t.Fatalf("got %d delegations, want only the librarian's renewal", len(delegations))
+		}
+		d := delegations[0].(map[string]any)
+		if d["action"] != models.DelegationRenew || jsonID(d["actor_id"]) != librarianID || jsonID(d["user_id"]) != studentID {
+			t.Errorf("got delegation %v, want the librarian renewing for the student", d)
+		}
+	})
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"library-management/internal/models"
+)
+
+// RenewalPolicy holds the rules applied by RenewBorrow on top of the
+// renewal limit of the loan's circulation policy.
+type RenewalPolicy struct {
+	// DenyWhenHeld refuses renewal while another patron waits for the title.
+	DenyWhenHeld bool
+	// DenyWhenOverdue refuses renewal once the due date has passed.
+	DenyWhenOverdue bool
+	// DenyWithUnpaidFines refuses renewal while the patron owes fines.
+	DenyWithUnpaidFines bool
+}
+
+// BlockingPolicy holds the rules that block a patron from borrowing
+// automatically. The block is lifted once none of them applies any more.
+// A zero field disables its rule.
+type BlockingPolicy struct {
+	// FineThreshold blocks patrons owing at least this many cents.
+	FineThreshold int64
+	// OverdueDays blocks patrons with a loan more than this many days past
+	// its due date.
+	OverdueDays int
+}
+
+// NoticePolicy controls the reminders sent by SendNotices. A zero day
+// count disables that kind of notice.
+type NoticePolicy struct {
+	// DueSoonDays sends a reminder this many days before the due date.
+	DueSoonDays int
+	// FinalNoticeDays sends the final notice, instead of the plain overdue
+	// one, once a loan is this many days overdue.
+	FinalNoticeDays int
+	// Hour is the local hour of day at which the daily scan runs.
+	Hour int
+}
+
+// OutboxPolicy controls how DeliverOutbox retries failed emails.
+type OutboxPolicy struct {
+	// MaxAttempts is the number of deliveries tried before a message is
+	// marked dead.
+	MaxAttempts int
+	// Backoff is the wait after the first failure; it doubles after each
+	// further failure up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// TokenPolicy controls the lifetime of the tokens issued at sign-in.
+type TokenPolicy struct {
+	// AccessTTL is how long an access token is accepted. It is kept short
+	// because access tokens are only checked against the token version.
+	AccessTTL time.Duration
+	// RefreshTTL is how long a refresh token can be used to get a new
+	// access token.
+	RefreshTTL time.Duration
+	// Algorithm is what new signing keys use: EdDSA or RS256. Keys made
+	// before a change keep their own algorithm until they expire.
+	Algorithm string
+	// KeyRotation is how long each signing key signs access tokens before
+	// its successor takes over.
+	KeyRotation time.Duration
+	// KeyPublishAhead is how long a new key is published before it signs
+	// anything, so that services caching the key set see it in time.
+	KeyPublishAhead time.Duration
+}
+
+// AccountPolicy controls the emailed email verification and password
+// reset tokens.
+type AccountPolicy struct {
+	VerifyTTL time.Duration
+	ResetTTL  time.Duration
+	// AppURL is the address of the web app. When set, emails link to its
+	// /verify-email and /reset-password pages with the token; otherwise
+	// they contain only the token.
+	AppURL string
+}
+
+// LoginPolicy controls how SignIn slows down password guessing. Failed
+// sign-ins are counted per account and per client address; a zero limit
+// disables its lockout.
+type LoginPolicy struct {
+	// MaxFailures locks an account for Lockout once this many sign-ins in a
+	// row have failed.
+	MaxFailures int
+	// IPMaxFailures does the same for a client address. It is set higher
+	// because several patrons may sign in from one address.
+	IPMaxFailures int
+	Lockout       time.Duration
+	// Backoff is the wait enforced after the first failure; it doubles
+	// after each further failure up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Window is how long failures are remembered. Once none has happened
+	// for this long the count starts again from zero.
+	Window time.Duration
+}
+
+// TwoFactorPolicy controls authenticator-app (TOTP) two-factor sign-in.
+type TwoFactorPolicy struct {
+	// RequiredForLibrarians makes librarians set up two-factor
+	// authentication the next time they sign in, and refuses their
+	// sessions until they have.
+	RequiredForLibrarians bool
+	// ChallengeTTL is how long the second sign-in step may take.
+	ChallengeTTL time.Duration
+	// Issuer names the library in authenticator apps.
+	Issuer string
+}
+
+// Config carries the tunable settings of the handlers.
+type Config struct {
+	Renewals  RenewalPolicy
+	Blocking  BlockingPolicy
+	Notices   NoticePolicy
+	Outbox    OutboxPolicy
+	Tokens    TokenPolicy
+	Accounts  AccountPolicy
+	Logins    LoginPolicy
+	TwoFactor TwoFactorPolicy
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Renewals: RenewalPolicy{
+			DenyWhenHeld:        true,
+			DenyWhenOverdue:     true,
+			DenyWithUnpaidFines: true,
+		},
+		Blocking: BlockingPolicy{
+			FineThreshold: 1000,
+			OverdueDays:   14,
+		},
+		Notices: NoticePolicy{
+			DueSoonDays:     2,
+			FinalNoticeDays: 10,
+			Hour:            8,
+		},
+		Outbox: OutboxPolicy{
+			MaxAttempts: 8,
+			Backoff:     time.Minute,
+			MaxBackoff:  6 * time.Hour,
+		},
+		Tokens: TokenPolicy{
+			AccessTTL:       15 * time.Minute,
+			RefreshTTL:      30 * 24 * time.Hour,
+			Algorithm:       models.KeyAlgEdDSA,
+			KeyRotation:     30 * 24 * time.Hour,
+			KeyPublishAhead: time.Hour,
+		},
+		Accounts: AccountPolicy{
+			VerifyTTL: 48 * time.Hour,
+			ResetTTL:  time.Hour,
+		},
+		Logins: LoginPolicy{
+			MaxFailures:   5,
+			IPMaxFailures: 50,
+			Lockout:       15 * time.Minute,
+			Backoff:       time.Second,
+			MaxBackoff:    time.Minute,
+			Window:        time.Hour,
+		},
+		TwoFactor: TwoFactorPolicy{
+			ChallengeTTL: 5 * time.Minute,
+			Issuer:       "Library",
+		},
+	}
+}
+
+// ConfigFromEnv starts from DefaultConfig and applies any of these that are
+// set: RENEWAL_DENY_WHEN_HELD, RENEWAL_DENY_WHEN_OVERDUE,
+// RENEWAL_DENY_WITH_UNPAID_FINES, BLOCK_FINE_THRESHOLD, BLOCK_OVERDUE_DAYS,
+// NOTICE_DUE_SOON_DAYS, NOTICE_FINAL_DAYS, NOTICE_HOUR, OUTBOX_MAX_ATTEMPTS,
+// OUTBOX_BACKOFF, OUTBOX_MAX_BACKOFF, ACCESS_TOKEN_TTL, REFRESH_TOKEN_TTL,
+// JWT_ALGORITHM, JWT_KEY_ROTATION, JWT_KEY_PUBLISH_AHEAD, EMAIL_VERIFY_TTL,
+// PASSWORD_RESET_TTL, APP_URL, LOGIN_MAX_FAILURES, LOGIN_IP_MAX_FAILURES,
+// LOGIN_LOCKOUT, LOGIN_BACKOFF, LOGIN_MAX_BACKOFF, LOGIN_FAILURE_WINDOW,
+// TOTP_REQUIRED_FOR_LIBRARIANS, TOTP_CHALLENGE_TTL and TOTP_ISSUER.
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	envBool("RENEWAL_DENY_WHEN_HELD", &cfg.Renewals.DenyWhenHeld)
+	envBool("RENEWAL_DENY_WHEN_OVERDUE", &cfg.Renewals.DenyWhenOverdue)
+	envBool("RENEWAL_DENY_WITH_UNPAID_FINES", &cfg.Renewals.DenyWithUnpaidFines)
+	envInt64("BLOCK_FINE_THRESHOLD", &cfg.Blocking.FineThreshold)
+	envInt("BLOCK_OVERDUE_DAYS", &cfg.Blocking.OverdueDays)
+	envInt("NOTICE_DUE_SOON_DAYS", &cfg.Notices.DueSoonDays)
+	envInt("NOTICE_FINAL_DAYS", &cfg.Notices.FinalNoticeDays)
+	envInt("NOTICE_HOUR", &cfg.Notices.Hour)
+	if cfg.Notices.Hour < 0 || cfg.Notices.Hour > 23 {
+		log.Fatalf("NOTICE_HOUR must be between 0 and 23, got %d", cfg.Notices.Hour)
+	}
+	envInt("OUTBOX_MAX_ATTEMPTS", &cfg.Outbox.MaxAttempts)
+	envDuration("OUTBOX_BACKOFF", &cfg.Outbox.Backoff)
+	envDuration("OUTBOX_MAX_BACKOFF", &cfg.Outbox.MaxBackoff)
+	if cfg.Outbox.MaxAttempts < 1 {
+		log.Fatalf("OUTBOX_MAX_ATTEMPTS must be at least 1, got %d", cfg.Outbox.MaxAttempts)
+	}
+	envDuration("ACCESS_TOKEN_TTL", &cfg.Tokens.AccessTTL)
+	envDuration("REFRESH_TOKEN_TTL", &cfg.Tokens.RefreshTTL)
+	if cfg.Tokens.AccessTTL <= 0 || cfg.Tokens.RefreshTTL <= 0 {
+		log.Fatalf("ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL must be positive")
+	}
+	if alg := os.Getenv("JWT_ALGORITHM"); alg != "" {
+		cfg.Tokens.Algorithm = alg
+	}
+	if !models.IsValidKeyAlgorithm(cfg.Tokens.Algorithm) {
+		log.Fatalf("JWT_ALGORITHM must be EdDSA or RS256, got %q", cfg.Tokens.Algorithm)
+	}
+	envDuration("JWT_KEY_ROTATION", &cfg.Tokens.KeyRotation)
+	envDuration("JWT_KEY_PUBLISH_AHEAD", &cfg.Tokens.KeyPublishAhead)
+	if cfg.Tokens.KeyRotation <= cfg.Tokens.KeyPublishAhead || cfg.Tokens.KeyPublishAhead < 0 {
+		log.Fatalf("JWT_KEY_ROTATION must be longer than JWT_KEY_PUBLISH_AHEAD, which must not be negative")
+	}
+	envDuration("EMAIL_VERIFY_TTL", &cfg.Accounts.VerifyTTL)
+	envDuration("PASSWORD_RESET_TTL", &cfg.Accounts.ResetTTL)
+	if cfg.Accounts.VerifyTTL <= 0 || cfg.Accounts.ResetTTL <= 0 {
+		log.Fatalf("EMAIL_VERIFY_TTL and PASSWORD_RESET_TTL must be positive")
+	}
+	cfg.Accounts.AppURL = strings.TrimSuffix(os.Getenv("APP_URL"), "/")
+	envInt("LOGIN_MAX_FAILURES", &cfg.Logins.MaxFailures)
+	envInt("LOGIN_IP_MAX_FAILURES", &cfg.Logins.IPMaxFailures)
+	envDuration("LOGIN_LOCKOUT", &cfg.Logins.Lockout)
+	envDuration("LOGIN_BACKOFF", &cfg.Logins.Backoff)
+	envDuration("LOGIN_MAX_BACKOFF", &cfg.Logins.MaxBackoff)
+	envDuration("LOGIN_FAILURE_WINDOW", &cfg.Logins.Window)
+	if cfg.Logins.MaxFailures < 0 || cfg.Logins.IPMaxFailures < 0 {
+		log.Fatalf("LOGIN_MAX_FAILURES and LOGIN_IP_MAX_FAILURES must not be negative")
+	}
+	if cfg.Logins.Window <= 0 {
+		log.Fatalf("LOGIN_FAILURE_WINDOW must be positive")
+	}
+	envBool("TOTP_REQUIRED_FOR_LIBRARIANS", &cfg.TwoFactor.RequiredForLibrarians)
+	envDuration("TOTP_CHALLENGE_TTL", &cfg.TwoFactor.ChallengeTTL)
+	if cfg.TwoFactor.ChallengeTTL <= 0 {
+		log.Fatalf("TOTP_CHALLENGE_TTL must be positive")
+	}
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		cfg.TwoFactor.Issuer = issuer
+	}
+	return cfg
+}
+
+func envInt(name string, dst *int) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Fatalf("%s must be an integer, got %q", name, raw)
+	}
+	*dst = v
+}
+
+func envInt64(name string, dst *int64) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		log.Fatalf("%s must be an integer, got %q", name, raw)
+	}
+	*dst = v
+}
+
+func envDuration(name string, dst *time.Duration) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Fatalf("%s must be a duration such as 30s or 5m, got %q", name, raw)
+	}
+	*dst = v
+}
+
+func envBool(name string, dst *bool) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Fatalf("%s must be true or false, got %q", name, raw)
+	}
+	*dst = v
+}
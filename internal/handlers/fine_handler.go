@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+var (
+	errUserNotFound       = errors.New("user not found")
+	errFineNotFound       = errors.New("no fine recorded for this loan")
+	errFineAmountTooLarge = errors.New("amount exceeds what can be settled")
+)
+
+// fineVerbs completes "Amount is more than can be ..." for each kind of
+// settlement.
+var fineVerbs = map[string]string{
+	models.FineKindPayment: "paid",
+	models.FineKindWaiver:  "waived",
+	models.FineKindRefund:  "refunded",
+}
+
+// fineSummary totals the ledger entries for one loan's fine.
+type fineSummary struct {
+	BorrowID    uint  `json:"borrow_id"`
+	Charged     int64 `json:"charged"`
+	Paid        int64 `json:"paid"`
+	Waived      int64 `json:"waived"`
+	Refunded    int64 `json:"refunded"`
+	Outstanding int64 `json:"outstanding"` // negative when money is due back to the patron
+}
+
+func (s *fineSummary) add(entry *models.FineTransaction) {
+	switch entry.Kind {
+	case models.FineKindCharge:
+		s.Charged += entry.Amount
+	case models.FineKindPayment:
+		s.Paid += entry.Amount
+	case models.FineKindWaiver:
+		s.Waived += entry.Amount
+	case models.FineKindRefund:
+		s.Refunded += entry.Amount
+	}
+	s.Outstanding += entry.Delta()
+}
+
+// summariseFines groups ledger entries by loan, oldest fine first.
+func summariseFines(entries []models.FineTransaction) []*fineSummary {
+	summaries := []*fineSummary{}
+	byBorrow := make(map[uint]*fineSummary)
+	for i := range entries {
+		s, ok := byBorrow[entries[i].BorrowID]
+		if !ok {
+			s = &fineSummary{BorrowID: entries[i].BorrowID}
+			byBorrow[s.BorrowID] = s
+			summaries = append(summaries, s)
+		}
+		s.add(&entries[i])
+	}
+	return summaries
+}
+
+// chargeFine records an overdue fine for a loan of title in the ledger,
+// adds it to the patron's outstanding balance and emails the patron.
+func chargeFine(tx repository.Store, borrow *models.Borrow, title *models.Title, amount int64) error {
+	entry := &models.FineTransaction{
+		UserID:   borrow.UserID,
+		BorrowID: borrow.ID,
+		Kind:     models.FineKindCharge,
+		Amount:   amount,
+		Reason:   "Overdue return",
+	}
+	if err := tx.Fines().Create(entry); err != nil {
+		return err
+	}
+	if err := tx.Users().AddPenalty(borrow.UserID, amount); err != nil {
+		return err
+	}
+	return queueEmail(tx, models.EventFine, borrow.UserID, map[string]any{
+		"BorrowID": borrow.ID,
+		"Title":    title.Title,
+		"DueDate":  borrow.DueDate,
+		"Amount":   amount,
+	})
+}
+
+// FineRequest is used to record payments, waivers and refunds. Amount is
+// in cents. Without a BorrowID, payments and waivers settle the oldest
+// outstanding fines first; refunds always need one.
+type FineRequest struct {
+	Amount   int64  `json:"amount"`
+	BorrowID uint   `json:"borrow_id"`
+	Reason   string `json:"reason"`
+}
+
+// settleFines writes the ledger entries for a payment, waiver or refund
+// and keeps the patron's penalty and each loan's FinePaid flag in step.
+// It returns the entries written.
+func settleFines(tx repository.Store, userID uint, kind string, req *FineRequest, recordedByID uint) ([]models.FineTransaction, error) {
+	// Locking the patron serialises concurrent settlements, so two payments
+	// cannot both be checked against the same outstanding amount.
+	if _, err := tx.Users().Lock(userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errUserNotFound
+		}
+		return nil, err
+	}
+	entries, err := tx.Fines().ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	summaries := summariseFines(entries)
+
+	type allocation struct {
+		fine   *fineSummary
+		amount int64
+	}
+	var plan []allocation
+	if req.BorrowID != 0 {
+		var fine *fineSummary
+		for _, s := range summaries {
+			if s.BorrowID == req.BorrowID {
+				fine = s
+			}
+		}
+		if fine == nil {
+			return nil, errFineNotFound
+		}
+		var limit int64
+		switch kind {
+		case models.FineKindPayment:
+			limit = fine.Outstanding
+		case models.FineKindWaiver:
+			// A fine that was already paid can still be waived; the
+			// patron is then owed a refund.
+			limit = fine.Charged - fine.Waived
+		case models.FineKindRefund:
+			limit = min(-fine.Outstanding, fine.Paid-fine.Refunded)
+		}
+		if req.Amount > limit {
+			return nil, errFineAmountTooLarge
+		}
+		plan = append(plan, allocation{fine, req.Amount})
+	} else {
+		remaining := req.Amount
+		for _, s := range summaries {
+			if remaining == 0 {
+				break
+			}
+			if s.Outstanding <= 0 {
+				continue
+			}
+			part := min(s.Outstanding, remaining)
+			plan = append(plan, allocation{s, part})
+			remaining -= part
+		}
+		if remaining > 0 {
+			return nil, errFineAmountTooLarge
+		}
+	}
+
+	recorded := make([]models.FineTransaction, 0, len(plan))
+	for _, a := range plan {
+		entry := models.FineTransaction{
+			UserID:       userID,
+			BorrowID:     a.fine.BorrowID,
+			Kind:         kind,
+			Amount:       a.amount,
+			Reason:       req.Reason,
+			RecordedByID: &recordedByID,
+		}
+		if err := tx.Fines().Create(&entry); err != nil {
+			return nil, err
+		}
+		if err := tx.Users().AddPenalty(userID, entry.Delta()); err != nil {
+			return nil, err
+		}
+		a.fine.add(&entry)
+		recorded = append(recorded, entry)
+
+		borrow, err := tx.Borrows().FindByID(a.fine.BorrowID)
+		if err != nil {
+			return nil, err
+		}
+		if paid := a.fine.Outstanding <= 0; borrow.FinePaid != paid {
+			borrow.FinePaid = paid
+			if err := tx.Borrows().Save(borrow); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return recorded, nil
+}
+
+// GetMyFines returns the signed-in patron's balance and fines ledger.
+func (h *Handler) GetMyFines(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(uint)
+	return h.fineStatement(c, userID)
+}
+
+// GetUserFines returns any patron's balance and fines ledger.
+func (h *Handler) GetUserFines(c *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || userID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	return h.fineStatement(c, uint(userID))
+}
+
+func (h *Handler) fineStatement(c *fiber.Ctx, userID uint) error {
+	user, err := h.store.Users().FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		log.Printf("Database error finding user: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	entries, err := h.store.Fines().ListByUser(userID)
+	if err != nil {
+		log.Printf("Database error listing fines: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve fines"})
+	}
+	if entries == nil {
+		entries = []models.FineTransaction{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":      "Fines retrieved successfully",
+		"user_id":      user.ID,
+		"balance":      user.Penalty,
+		"fines":        summariseFines(entries),
+		"transactions": entries,
+	})
+}
+
+// RecordFinePayment records money taken from a patron at the desk. Partial
+// payments are allowed; overpayments are not.
+func (h *Handler) RecordFinePayment(c *fiber.Ctx) error {
+	return h.settle(c, models.FineKindPayment)
+}
+
+// WaiveFine writes off some or all of a patron's fines. A reason is
+// required.
+func (h *Handler) WaiveFine(c *fiber.Ctx) error {
+	return h.settle(c, models.FineKindWaiver)
+}
+
+// RefundFine pays back money taken for a fine that was later waived.
+func (h *Handler) RefundFine(c *fiber.Ctx) error {
+	return h.settle(c, models.FineKindRefund)
+}
+
+func (h *Handler) settle(c *fiber.Ctx, kind string) error {
+	userID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || userID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	recordedByID, _ := c.Locals("userID").(uint)
+
+	var req FineRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Amount <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Amount must be a positive number of cents"})
+	}
+	if kind == models.FineKindWaiver && req.Reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A reason is required to waive a fine"})
+	}
+	if kind == models.FineKindRefund && req.BorrowID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "BorrowID is required for a refund"})
+	}
+
+	var recorded []models.FineTransaction
+	var user *models.User
+	err = h.store.Transaction(func(tx repository.Store) error {
+		var err error
+		if recorded, err = settleFines(tx, uint(userID), kind, &req, recordedByID); err != nil {
+			return err
+		}
+		if _, err = h.applyBlockRules(tx, uint(userID), time.Now()); err != nil {
+			return err
+		}
+		user, err = tx.Users().FindByID(uint(userID))
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errUserNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		case errors.Is(err, errFineNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No fine is recorded for this user and borrow"})
+		case errors.Is(err, errFineAmountTooLarge):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Amount is more than can be " + fineVerbs[kind]})
+		}
+		log.Printf("Error recording fine %s: %v", kind, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not record " + kind})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":      "Fine " + kind + " recorded successfully",
+		"transactions": recorded,
+		"balance":      user.Penalty,
+	})
+}
@@ -0,0 +1,154 @@
+package handlers_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+)
+
+// overdueFines has a new student borrow one copy of a title per entry in
+// days, returns each that many days late in order, and gives the student's
+// ID and token and the loans' IDs.
+func (s *testServer) overdueFines(librarian string, days ...int) (uint, string, []uint) {
+	s.t.Helper()
+	studentID, student := s.user(models.RoleStudent)
+	borrowIDs := make([]uint, len(days))
+	for i := range days {
+		titleID, _ := s.addTitle(librarian, fmt.Sprintf("Title %d", i), "SF", fmt.Sprintf("F%d", i))
+		resp := s.mustDo(student, "POST", "/api/books/borrow", fiber.Map{"title_id": titleID}, fiber.StatusCreated)
+		borrowIDs[i] = jsonID(resp["borrow_id"])
+	}
+	for i, id := range borrowIDs {
+		borrow, err := s.store.Borrows().FindByID(id)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		borrow.DueDate = time.Now().AddDate(0, 0, -days[i])
+		if err := s.store.Borrows().Save(borrow); err != nil {
+			s.t.Fatal(err)
+		}
+		s.mustDo(student, "POST", fmt.Sprintf("/api/books/return/%d", id), nil, fiber.StatusOK)
+	}
+	return studentID, student, borrowIDs
+}
+
+// fines returns the fine summaries for userID by loan, failing the test
+// unless the user's penalty and the balance reported both equal the sum
+// of the ledger.
+func (s *testServer) fines(librarian string, userID uint) map[uint]map[string]any {
+	s.t.Helper()
+	resp := s.mustDo(librarian, "GET", fmt.Sprintf("/api/users/%d/fines", userID), nil, fiber.StatusOK)
+	entries, err := s.store.Fines().ListByUser(userID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	var sum int64
+	for i := range entries {
+		sum += entries[i].Delta()
+	}
+	user, err := s.store.Users().FindByID(userID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if user.Penalty != sum || resp["balance"] != float64(sum) {
+		s.t.Errorf("got a penalty of %d and a balance of %v, want the ledger's %d", user.Penalty, resp["balance"], sum)
+	}
+	byBorrow := make(map[uint]map[string]any)
+	for _, f := range resp["fines"].([]any) {
+		fine := f.(map[string]any)
+		byBorrow[jsonID(fine["borrow_id"])] = fine
+	}
+	return byBorrow
+}
+
+func TestPartialPaymentSettlesOldestFineFirst(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		studentID, _, loans := s.overdueFines(librarian, 5, 3)
+		fines := s.fines(librarian, studentID)
+		oldest, newest := fines[loans[0]]["charged"].(float64), fines[loans[1]]["charged"].(float64)
+		if oldest == 0 || newest == 0 {
+			t.Fatalf("got fines %v, want both loans charged", fines)
+		}
+
+		path := fmt.Sprintf("/api/users/%d/fines/payments", studentID)
+		resp := s.mustDo(librarian, "POST", path, fiber.Map{"amount": oldest + 50}, fiber.StatusCreated)
+		recorded := resp["transactions"].([]any)
+		if len(recorded) != 2 ||
+			jsonID(recorded[0].(map[string]any)["borrow_id"]) != loans[0] || recorded[0].(map[string]any)["amount"] != oldest ||
+			jsonID(recorded[1].(map[string]any)["borrow_id"]) != loans[1] || recorded[1].(map[string]any)["amount"] != 50.0 {
+			t.Errorf("got payments %v, want the oldest fine paid off and 50 towards the next", recorded)
+		}
+		fines = s.fines(librarian, studentID)
+		if fines[loans[0]]["outstanding"] != 0.0 || fines[loans[1]]["outstanding"] != newest-50 {
+			t.Errorf("got fines %v after paying %v", fines, oldest+50)
+		}
+
+		// Paying more than is owed is refused and records nothing.
+		s.mustDo(librarian, "POST", path, fiber.Map{"amount": newest}, fiber.StatusConflict)
+		s.mustDo(librarian, "POST", path, fiber.Map{"amount": newest - 50}, fiber.StatusCreated)
+		if fines = s.fines(librarian, studentID); fines[loans[1]]["outstanding"] != 0.0 {
+			t.Errorf("got fines %v, want everything paid", fines)
+		}
+	})
+}
+
+func TestWaiverNeedsReason(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		studentID, student, loans := s.overdueFines(librarian, 3)
+		charged := s.fines(librarian, studentID)[loans[0]]["charged"].(float64)
+
+		path := fmt.Sprintf("/api/users/%d/fines/waivers", studentID)
+		s.mustDo(librarian, "POST", path, fiber.Map{"amount": charged, "borrow_id": loans[0]}, fiber.StatusBadRequest)
+		s.mustDo(student, "POST", path, fiber.Map{"amount": charged, "borrow_id": loans[0], "reason": "hospital stay"}, fiber.StatusForbidden)
+		s.mustDo(librarian, "POST", path, fiber.Map{"amount": charged + 1, "borrow_id": loans[0], "reason": "hospital stay"}, fiber.StatusConflict)
+		resp := s.mustDo(librarian, "POST", path, fiber.Map{"amount": charged, "borrow_id": loans[0], "reason": "hospital stay"}, fiber.StatusCreated)
+		waiver := resp["transactions"].([]any)[0].(map[string]any)
+		if waiver["kind"] != models.FineKindWaiver || waiver["reason"] != "hospital stay" {
+			t.Errorf("got %v, want a waiver with its reason", waiver)
+		}
+		if fine := s.fines(librarian, studentID)[loans[0]]; fine["waived"] != charged || fine["outstanding"] != 0.0 {
+			t.Errorf("got fine %v, want it waived in full", fine)
+		}
+	})
+}
+
+func TestRefundNeverExceedsAmountPaid(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		studentID, _, loans := s.overdueFines(librarian, 5, 3)
+		fines := s.fines(librarian, studentID)
+		paid, waived := fines[loans[0]]["charged"].(float64), fines[loans[1]]["charged"].(float64)
+		refunds := fmt.Sprintf("/api/users/%d/fines/refunds", studentID)
+
+		// Nothing has been paid, so nothing can be refunded.
+		s.mustDo(librarian, "POST", refunds, fiber.Map{"amount": 1, "borrow_id": loans[0]}, fiber.StatusConflict)
+		s.mustDo(librarian, "POST", refunds, fiber.Map{"amount": 1}, fiber.StatusBadRequest)
+
+		// The first fine is paid and then waived, so the patron is owed
+		// what they paid; the second is waived without being paid.
+		s.mustDo(librarian, "POST", fmt.Sprintf("/api/users/%d/fines/payments", studentID), fiber.Map{"amount": paid, "borrow_id": loans[0]}, fiber.StatusCreated)
+		s.fines(librarian, studentID)
+		for i, amount := range []float64{paid, waived} {
+			s.mustDo(librarian, "POST", fmt.Sprintf("/api/users/%d/fines/waivers", studentID), fiber.Map{"amount": amount, "borrow_id": loans[i], "reason": "system outage"}, fiber.StatusCreated)
+		}
+		if fine := s.fines(librarian, studentID)[loans[0]]; fine["outstanding"] != -paid {
+			t.Fatalf("got fine %v, want %v owed back", fine, paid)
+		}
+
+		s.mustDo(librarian, "POST", refunds, fiber.Map{"amount": 1, "borrow_id": loans[1]}, fiber.StatusConflict)
+		s.mustDo(librarian, "POST", refunds, fiber.Map{"amount": paid + 1, "borrow_id": loans[0]}, fiber.StatusConflict)
+		s.mustDo(librarian, "POST", refunds, fiber.Map{"amount": paid - 1, "borrow_id": loans[0]}, fiber.StatusCreated)
+		s.fines(librarian, studentID)
+		s.mustDo(librarian, "POST", refunds, fiber.Map{"amount": 2, "borrow_id": loans[0]}, fiber.StatusConflict)
+		s.mustDo(librarian, "POST", refunds, fiber.Map{"amount": 1, "borrow_id": loans[0]}, fiber.StatusCreated)
+		if fine := s.fines(librarian, studentID)[loans[0]]; fine["refunded"] != paid || fine["outstanding"] != 0.0 {
+			t.Errorf("got fine %v, want the payment refunded in full", fine)
+		}
+	})
+}
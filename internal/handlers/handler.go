@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"library-management/internal/notify"
+	"library-management/internal/repository"
+)
+
+// Handler carries the dependencies shared by every HTTP handler. Build one
+// with NewHandler and register its methods in routes.SetupRoutes.
+type Handler struct {
+	store    repository.Store
+	notifier notify.Notifier
+	cfg      Config
+	keys     *keyRing
+}
+
+func NewHandler(store repository.Store, notifier notify.Notifier, cfg Config) *Handler {
+	return &Handler{store: store, notifier: notifier, cfg: cfg, keys: &keyRing{}}
+}
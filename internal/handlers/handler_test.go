@@ -0,0 +1,400 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+
+	"library-management/internal/db"
+	"library-management/internal/handlers"
+	"library-management/internal/migrations"
+	"library-management/internal/models"
+	"library-management/internal/notify"
+	"library-management/internal/repository"
+	"library-management/internal/routes"
+	"library-management/internal/totp"
+)
+
+const testPassword = "password"
+
+// testStores lists the stores every handler test runs against: the
+// in-memory store and a migrated SQLite file, neither needing a server,
+// and PostgreSQL when TEST_DATABASE_URL names a database. The first two
+// run one transaction at a time, so only PostgreSQL exercises the row
+// locks that concurrent requests rely on.
+var testStores = []struct {
+	name string
+	open func(t *testing.T) repository.Store
+}{
+	{"memory", openMemoryStore},
+	{"sqlite", openSQLiteStore},
+	{"postgres", openPostgresStore},
+}
+
+func openMemoryStore(t *testing.T) repository.Store {
+	store := repository.NewMemoryStore()
+	// The memory store starts empty, without the grants the migrations
+	// give librarians.
+	if err := store.Permissions().SetForRole(models.RoleLibrarian, models.AllPermissions); err != nil {
+		t.Fatalf("granting librarian permissions: %v", err)
+	}
+	return store
+}
+
+func openSQLiteStore(t *testing.T) repository.Store {
+	gdb, err := db.Open(db.DriverSQLite, filepath.Join(t.TempDir(), "library.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	sqlDB, err := gdb.DB()
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrator, err := migrations.New(gdb)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("applying migrations: %v", err)
+	}
+	return repository.NewGormStore(gdb)
+}
+
+// openPostgresStore migrates a schema of its own in the database at
+// TEST_DATABASE_URL, dropped when the test ends. The test is skipped if
+// TEST_DATABASE_URL is not set.
+func openPostgresStore(t *testing.T) repository.Store {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	admin, err := db.Open(db.DriverPostgres, dsn)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	adminDB, err := admin.DB()
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	// The search migration creates pg_trgm unless it exists. Made once in
+	// public, it serves every test schema.
+	if err := admin.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public").Error; err != nil {
+		t.Fatalf("creating pg_trgm: %v", err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := admin.Exec("DROP SCHEMA " + schema + " CASCADE").Error; err != nil {
+			t.Errorf("dropping schema: %v", err)
+		}
+		adminDB.Close()
+	})
+
+	gdb, err := db.Open(db.DriverPostgres, withSearchPath(dsn, schema+",public"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	sqlDB, err := gdb.DB()
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrator, err := migrations.New(gdb)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("applying migrations: %v", err)
+	}
+	return repository.NewGormStore(gdb)
+}
+
+// withSearchPath adds search_path to a PostgreSQL URL or key=value DSN.
+func withSearchPath(dsn, path string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + path
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "search_path=" + url.QueryEscape(path)
+}
+
+// testServer is the API on a fresh store, called in-process.
+type testServer struct {
+	t     *testing.T
+	cfg   handlers.Config
+	h     *handlers.Handler
+	app   *fiber.App
+	store repository.Store
+	// users numbers the accounts made by user, keeping emails unique.
+	users atomic.Int32
+}
+
+// forEachStore runs test once against each of testStores.
+func forEachStore(t *testing.T, test func(t *testing.T, s *testServer)) {
+	forEachStoreWith(t, handlers.DefaultConfig(), test)
+}
+
+// forEachStoreWith is forEachStore with the API configured by cfg.
+func forEachStoreWith(t *testing.T, cfg handlers.Config, test func(t *testing.T, s *testServer)) {
+	for _, ts := range testStores {
+		t.Run(ts.name, func(t *testing.T) {
+			db.KeyEncryptionKeys = []string{"test-key"}
+			test(t, newTestServer(t, ts.open(t), cfg))
+		})
+	}
+}
+
+// newTestServer starts the API on store, as a server does: with the
+// signing keys rotated if due.
+func newTestServer(t *testing.T, store repository.Store, cfg handlers.Config) *testServer {
+	db.JWTSecret = "test-secret"
+	h := handlers.NewHandler(store, notify.NewLogNotifier(io.Discard), cfg)
+	if _, err := h.RotateSigningKeys(time.Now()); err != nil {
+		t.Fatalf("preparing signing keys: %v", err)
+	}
+	app := fiber.New()
+	routes.SetupRoutes(app, h)
+	return &testServer{t: t, cfg: cfg, h: h, app: app, store: store}
+}
+
+// restart starts another server on the same store, as after a redeploy.
+func (s *testServer) restart() *testServer {
+	s.t.Helper()
+	next := newTestServer(s.t, s.store, s.cfg)
+	next.users.Store(s.users.Load())
+	return next
+}
+
+// user creates a verified user with role and signs them in, returning
+// their id and access token.
+func (s *testServer) user(role string) (uint, string) {
+	s.t.Helper()
+	user := s.newUser(role)
+	status, body := s.do("", "POST", "/api/signin", fiber.Map{"email": user.Email, "password": testPassword})
+	if status != fiber.StatusOK {
+		s.t.Fatalf("signing in %s: %d %v", user.Email, status, body)
+	}
+	return user.ID, body["token"].(string)
+}
+
+// newUser creates a verified user with role and the password testPassword,
+// numbered in the email address user<n>@example.com.
+func (s *testServer) newUser(role string) *models.User {
+	s.t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	now := time.Now()
+	user := &models.User{
+		Name:            fmt.Sprintf("%s %d", role, s.users.Add(1)),
+		Password:        string(hash),
+		Role:            role,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	}
+	user.Email = fmt.Sprintf("user%d@example.com", s.users.Load())
+	if err := s.store.Users().Create(user); err != nil {
+		s.t.Fatalf("creating user: %v", err)
+	}
+	return user
+}
+
+// do sends a request with an optional JSON body and bearer token and
+// returns the status and decoded JSON response. It is safe to call from
+// several goroutines.
+func (s *testServer) do(token, method, path string, body any) (int, map[string]any) {
+	resp := s.send(token, method, path, body)
+	if resp == nil {
+		return 0, nil
+	}
+	defer resp.Body.Close()
+	var decoded map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil && err != io.EOF {
+		s.t.Errorf("%s %s: decoding response: %v", method, path, err)
+	}
+	return resp.StatusCode, decoded
+}
+
+// send is do returning the whole response, which the caller closes. It
+// returns nil, having failed the test, if the request could not be made.
+func (s *testServer) send(token, method, path string, body any) *http.Response {
+	var payload io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			s.t.Errorf("encoding request: %v", err)
+			return nil
+		}
+		payload = bytes.NewReader(raw)
+	}
+	req := httptest.NewRequest(method, path, payload)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		s.t.Errorf("%s %s: %v", method, path, err)
+		return nil
+	}
+	return resp
+}
+
+// mustDo is do for requests that must answer with want.
+func (s *testServer) mustDo(token, method, path string, body any, want int) map[string]any {
+	s.t.Helper()
+	status, resp := s.do(token, method, path, body)
+	if status != want {
+		s.t.Fatalf("%s %s: got %d %v, want %d", method, path, status, resp, want)
+	}
+	return resp
+}
+
+// addTitle creates a title with one copy per barcode as librarian and
+// returns the title id and the copy ids.
+func (s *testServer) addTitle(librarian, name, genre string, barcodes ...string) (uint, []uint) {
+	s.t.Helper()
+	var titleID uint
+	var copyIDs []uint
+	for i, barcode := range barcodes {
+		var resp map[string]any
+		if i == 0 {
+			resp = s.mustDo(librarian, "POST", "/api/books", fiber.Map{
+				"title": name, "authors": []string{"An Author"}, "genre": genre, "barcode": barcode,
+			}, fiber.StatusCreated)
+			titleID = jsonID(resp["book"].(map[string]any)["id"])
+		} else {
+			resp = s.mustDo(librarian, "POST", fmt.Sprintf("/api/books/%d/copies", titleID), fiber.Map{"barcode": barcode}, fiber.StatusCreated)
+		}
+		copyIDs = append(copyIDs, jsonID(resp["copy"].(map[string]any)["id"]))
+	}
+	return titleID, copyIDs
+}
+
+// enrolTOTP turns on two-factor authentication for the user signed in
+// with token and returns their TOTP secret and recovery codes.
+func (s *testServer) enrolTOTP(token string) (string, []any) {
+	s.t.Helper()
+	secret := s.mustDo(token, "POST", "/api/2fa/setup", fiber.Map{"password": testPassword}, fiber.StatusOK)["secret"].(string)
+	resp := s.mustDo(token, "POST", "/api/2fa/enable", fiber.Map{"code": totpCode(s.t, secret, 0)}, fiber.StatusOK)
+	return secret, resp["recovery_codes"].([]any)
+}
+
+// totpCode returns the code for secret offset 30-second steps from now.
+// Each code works once, so a test using several takes later steps.
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// jsonID converts an id decoded from JSON.
+func jsonID(v any) uint {
+	f, _ := v.(float64)
+	return uint(f)
+}
+
+func TestCreateAndListBooks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		_, student := s.user(models.RoleStudent)
+
+		s.mustDo(student, "POST", "/api/books", fiber.Map{
+			"title": "Dune", "authors": []string{"Frank Herbert"}, "genre": "SF", "barcode": "B1",
+		}, fiber.StatusForbidden)
+		s.addTitle(librarian, "Dune", "SF", "B1", "B2")
+		s.mustDo(librarian, "POST", "/api/books", fiber.Map{
+			"title": "Dune", "authors": []string{"Frank Herbert"}, "genre": "SF", "barcode": "B1",
+		}, fiber.StatusConflict)
+
+		resp := s.mustDo(student, "GET", "/api/books", nil, fiber.StatusOK)
+		books := resp["books"].([]any)
+		if len(books) != 1 {
+			t.Fatalf("got %d books, want 1", len(books))
+		}
+		book := books[0].(map[string]any)
+		if book["total_copies"] != 2.0 || book["available_copies"] != 2.0 {
+			t.Errorf("got %v total and %v available copies, want 2 and 2", book["total_copies"], book["available_copies"])
+		}
+	})
+}
+
+func TestBorrowAndReturn(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		studentID, student := s.user(models.RoleStudent)
+		_, other := s.user(models.RoleStudent)
+		titleID, copyIDs := s.addTitle(librarian, "Dune", "SF", "B1")
+
+		resp := s.mustDo(student, "POST", "/api/books/borrow", fiber.Map{"title_id": titleID}, fiber.StatusCreated)
+		borrowID := jsonID(resp["borrow_id"])
+		if jsonID(resp["copy_id"]) != copyIDs[0] || jsonID(resp["user_id"]) != studentID {
+			t.Errorf("got loan %v, want copy %d to user %d", resp, copyIDs[0], studentID)
+		}
+		s.mustDo(other, "POST", "/api/books/borrow", fiber.Map{"copy_id": copyIDs[0]}, fiber.StatusNotFound)
+
+		path := fmt.Sprintf("/api/books/return/%d", borrowID)
+		s.mustDo(other, "POST", path, nil, fiber.StatusForbidden)
+		resp = s.mustDo(student, "POST", path, nil, fiber.StatusOK)
+		if resp["fine_incurred"] != 0.0 {
+			t.Errorf("got fine %v for a loan returned on time", resp["fine_incurred"])
+		}
+		s.mustDo(student, "POST", path, nil, fiber.StatusNotFound)
+		s.mustDo(other, "POST", "/api/books/borrow", fiber.Map{"copy_id": copyIDs[0]}, fiber.StatusCreated)
+	})
+}
+
+func TestBorrowOnBehalfNeedsPermission(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		studentID, student := s.user(models.RoleStudent)
+		_, other := s.user(models.RoleStudent)
+		titleID, _ := s.addTitle(librarian, "Dune", "SF", "B1", "B2")
+
+		s.mustDo(other, "POST", "/api/books/borrow", fiber.Map{"title_id": titleID, "on_behalf_of_id": studentID}, fiber.StatusForbidden)
+		resp := s.mustDo(librarian, "POST", "/api/books/borrow", fiber.Map{"title_id": titleID, "on_behalf_of_id": studentID}, fiber.StatusCreated)
+		if jsonID(resp["user_id"]) != studentID {
+			t.Errorf("loan made to user %v, want %d", resp["user_id"], studentID)
+		}
+
+		delegations := s.mustDo(librarian, "GET", "/api/delegations", nil, fiber.StatusOK)["delegations"].([]any)
+		if len(delegations) != 1 {
+			t.Errorf("got %d delegations, want 1", len(delegations))
+		}
+		s.mustDo(student, "GET", "/api/delegations", nil, fiber.StatusForbidden)
+	})
+}
+
+func TestSignInRejectsWrongPassword(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		s.user(models.RoleStudent)
+		s.mustDo("", "POST", "/api/signin", fiber.Map{"email": "user1@example.com", "password": "wrong"}, fiber.StatusUnauthorized)
+		s.mustDo("", "GET", "/api/books", nil, fiber.StatusUnauthorized)
+		s.mustDo("not-a-token", "GET", "/api/books", nil, fiber.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+// holdPickupWindow is how long a copy stays on the hold shelf before the
+// hold expires and the copy passes to the next patron in the queue.
+const holdPickupWindow = 3 * 24 * time.Hour
+
+// PlaceHoldRequest queues the signed-in user for a title, or OnBehalfOfID
+// when a librarian places the hold for someone else.
+type PlaceHoldRequest struct {
+	TitleID      uint `json:"title_id"`
+	OnBehalfOfID uint `json:"on_behalf_of_id"`
+}
+
+var (
+	errTitleNotFound = errors.New("title not found")
+	errHoldExists    = errors.New("user already has an active hold on this title")
+	errCopyAvailable = errors.New("a copy of this title is available")
+	errHoldOnLoan    = errors.New("user has this title on loan")
+	errHoldNotActive = errors.New("hold is not active")
+	errHoldNotReady  = errors.New("hold is not ready for pickup")
+)
+
+// releaseCopy is called when a copy comes back into circulation. It sets the
+// copy aside for the oldest waiting hold on its title and returns that hold,
+// or makes the copy available when nobody is waiting. It locks the title,
+// as PlaceHold does, so a hold placed meanwhile is either seen here or sees
+// the copy available.
+func releaseCopy(tx repository.Store, copyID, titleID uint, now time.Time) (*models.Hold, error) {
+	if _, err := tx.Titles().Lock(titleID); err != nil {
+		return nil, err
+	}
+	hold, err := tx.Holds().LockNextWaiting(titleID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, tx.Copies().SetStatus(copyID, models.CopyStatusAvailable)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pickupBy := now.Add(holdPickupWindow)
+	hold.Status = models.HoldStatusReady
+	hold.CopyID = &copyID
+	hold.ReadyAt = &now
+	hold.PickupBy = &pickupBy
+	if err := tx.Holds().Save(hold); err != nil {
+		return nil, err
+	}
+	return hold, tx.Copies().SetStatus(copyID, models.CopyStatusOnHold)
+}
+
+// ExpireHolds expires every ready hold whose pickup deadline has passed and
+// passes its copy on to the next patron in the queue. It returns the number
+// of holds expired.
+func (h *Handler) ExpireHolds(now time.Time) (int, error) {
+	var expired int
+	err := h.store.Transaction(func(tx repository.Store) error {
+		holds, err := tx.Holds().LockExpired(now)
+		if err != nil {
+			return err
+		}
+		for i := range holds {
+			hold := &holds[i]
+			hold.Status = models.HoldStatusExpired
+			hold.ClosedAt = &now
+			if err := tx.Holds().Save(hold); err != nil {
+				return err
+			}
+			if _, err := releaseCopy(tx, *hold.CopyID, hold.TitleID, now); err != nil {
+				return err
+			}
+		}
+		expired = len(holds)
+		return nil
+	})
+	return expired, err
+}
+
+func (h *Handler) holdJSON(hold *models.Hold) (fiber.Map, error) {
+	m := fiber.Map{
+		"id":        hold.ID,
+		"title_id":  hold.TitleID,
+		"user_id":   hold.UserID,
+		"copy_id":   hold.CopyID,
+		"status":    hold.Status,
+		"placed_at": hold.PlacedAt,
+		"ready_at":  hold.ReadyAt,
+		"pickup_by": hold.PickupBy,
+		"closed_at": hold.ClosedAt,
+	}
+	if hold.Status == models.HoldStatusWaiting {
+		position, err := h.store.Holds().QueuePosition(hold)
+		if err != nil {
+			return nil, err
+		}
+		m["queue_position"] = position
+	}
+	return m, nil
+}
+
+func (h *Handler) PlaceHold(c *fiber.Ctx) error {
+	req := new(PlaceHoldRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON body"})
+	}
+
+	if req.TitleID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "TitleID is required"})
+	}
+	actorID, userID, err := actingUser(c, req.OnBehalfOfID, models.PermBorrowsCreateAny)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not allowed to place holds on behalf of another user"})
+	}
+
+	var hold *models.Hold
+	err = h.store.Transaction(func(tx repository.Store) error {
+		// Locking the title serialises this with releaseCopy, so a copy
+		// coming back cannot miss the hold or be missed by it.
+		title, err := tx.Titles().Lock(req.TitleID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errTitleNotFound
+			}
+			return err
+		}
+		if title.DeletedAt.Valid {
+			return errTitleNotFound
+		}
+
+		if _, err := tx.Users().LockActive(userID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errUserUnavailable
+			}
+			return err
+		}
+
+		if _, err := tx.Holds().FindActive(userID, req.TitleID); err == nil {
+			return errHoldExists
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		if _, err := tx.Borrows().FindActiveForTitle(userID, req.TitleID); err == nil {
+			return errHoldOnLoan
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		// A copy locked by a borrow in progress still counts as available.
+		copies, err := tx.Copies().ListByTitle(req.TitleID)
+		if err != nil {
+			return err
+		}
+		for _, cp := range copies {
+			if cp.Status == models.CopyStatusAvailable {
+				return errCopyAvailable
+			}
+		}
+
+		hold = &models.Hold{
+			TitleID:  req.TitleID,
+			UserID:   userID,
+			Status:   models.HoldStatusWaiting,
+			PlacedAt: time.Now(),
+		}
+		if err := tx.Holds().Create(hold); err != nil {
+			return err
+		}
+		return recordHoldDelegation(tx, actorID, hold, models.DelegationHold)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errTitleNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Book not found"})
+		case errors.Is(err, errUserUnavailable):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found or is blocked"})
+		case errors.Is(err, errHoldExists):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User already has an active hold on this book"})
+		case errors.Is(err, errHoldOnLoan):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User already has this book on loan"})
+		case errors.Is(err, errCopyAvailable):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A copy of this book is available. Borrow it instead"})
+		}
+		log.Printf("Error placing hold: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not place hold"})
+	}
+
+	body, err := h.holdJSON(hold)
+	if err != nil {
+		log.Printf("Database error computing queue position: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Hold placed successfully",
+		"hold":    body,
+	})
+}
+
+// ListHolds lists holds filtered by the title_id, user_id and status query
+// parameters. status takes a comma-separated list and defaults to active
+// (waiting and ready) holds. Users see only their own holds; with the
+// borrows:read permission user_id names anyone, and leaving it out with a
+// title_id lists the title's whole queue.
+func (h *Handler) ListHolds(c *fiber.Ctx) error {
+	var filter repository.HoldFilter
+	for name, dst := range map[string]*uint{"title_id": &filter.TitleID, "user_id": &filter.UserID} {
+		if raw := c.Query(name); raw != "" {
+			id, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid " + name})
+			}
+			*dst = uint(id)
+		}
+	}
+	actorID, _ := c.Locals("userID").(uint)
+	if !hasPermission(c, models.PermBorrowsRead) {
+		if filter.UserID != 0 && filter.UserID != actorID {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can only list your own holds"})
+		}
+		filter.UserID = actorID
+	} else if filter.UserID == 0 && filter.TitleID == 0 {
+		filter.UserID = actorID
+	}
+	if raw := c.Query("status"); raw != "" {
+		filter.Statuses = strings.Split(raw, ",")
+	}
+
+	holds, err := h.store.Holds().List(filter)
+	if err != nil {
+		log.Printf("Database error listing holds: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve holds"})
+	}
+
+	result := make([]fiber.Map, 0, len(holds))
+	for i := range holds {
+		body, err := h.holdJSON(&holds[i])
+		if err != nil {
+			log.Printf("Database error computing queue position: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		result = append(result, body)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Holds retrieved successfully",
+		"holds":   result,
+	})
+}
+
+// CancelHold cancels a hold, passing a copy set aside for it to the next
+// patron. Cancelling someone else's hold needs the borrows:create-any
+// permission and is recorded as a delegation.
+func (h *Handler) CancelHold(c *fiber.Ctx) error {
+	holdID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || holdID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid hold ID"})
+	}
+	actorID, _ := c.Locals("userID").(uint)
+	cancelAny := hasPermission(c, models.PermBorrowsCreateAny)
+
+	var hold *models.Hold
+	err = h.store.Transaction(func(tx repository.Store) error {
+		var err error
+		hold, err = tx.Holds().Lock(uint(holdID))
+		if err != nil {
+			return err
+		}
+		if hold.UserID != actorID && !cancelAny {
+			return errNotOwnHold
+		}
+		if !hold.IsActive() {
+			return errHoldNotActive
+		}
+
+		wasReady := hold.Status == models.HoldStatusReady
+		now := time.Now()
+		hold.Status = models.HoldStatusCancelled
+		hold.ClosedAt = &now
+		if err := tx.Holds().Save(hold); err != nil {
+			return err
+		}
+		if err := recordHoldDelegation(tx, actorID, hold, models.DelegationCancelHold); err != nil {
+			return err
+		}
+		if wasReady {
+			_, err = releaseCopy(tx, *hold.CopyID, hold.TitleID, now)
+		}
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Hold not found"})
+		case errors.Is(err, errNotOwnHold):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can only cancel your own holds"})
+		case errors.Is(err, errHoldNotActive):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Hold is no longer active"})
+		}
+		log.Printf("Error cancelling hold: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not cancel hold"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Hold cancelled successfully",
+		"hold_id": hold.ID,
+	})
+}
+
+// FulfilHold lends the copy set aside for a ready hold to its patron.
+// Picking up someone else's hold needs the borrows:create-any permission.
+func (h *Handler) FulfilHold(c *fiber.Ctx) error {
+	holdID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || holdID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid hold ID"})
+	}
+	actorID, _ := c.Locals("userID").(uint)
+	lendAny := hasPermission(c, models.PermBorrowsCreateAny)
+
+	var borrow *models.Borrow
+	err = h.store.Transaction(func(tx repository.Store) error {
+		hold, err := tx.Holds().Lock(uint(holdID))
+		if err != nil {
+			return err
+		}
+		if hold.UserID != actorID && !lendAny {
+			return errNotOwnHold
+		}
+		now := time.Now()
+		if hold.Status != models.HoldStatusReady || now.After(*hold.PickupBy) {
+			return errHoldNotReady
+		}
+
+		cp, err := tx.Copies().FindByID(*hold.CopyID)
+		if err != nil {
+			return err
+		}
+		if borrow, err = lend(tx, cp, hold.UserID); err != nil {
+			return err
+		}
+		if err := recordDelegation(tx, actorID, hold.UserID, models.DelegationBorrow, cp.ID, &borrow.ID); err != nil {
+			return err
+		}
+
+		hold.Status = models.HoldStatusFulfilled
+		hold.ClosedAt = &now
+		return tx.Holds().Save(hold)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Hold not found"})
+		case errors.Is(err, errNotOwnHold):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can only pick up your own holds"})
+		case errors.Is(err, errHoldNotReady):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Hold is not ready for pickup"})
+		case errors.Is(err, errUserUnavailable):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found or is blocked"})
+		case errors.Is(err, errBorrowLimitReached):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Patron has reached the maximum number of concurrent loans"})
+		case errors.Is(err, errEmailUnverified):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Patron must verify their email address before borrowing"})
+		}
+		log.Printf("Error fulfilling hold: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fulfil hold"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":   "Hold fulfilled and book borrowed successfully",
+		"borrow_id": borrow.ID,
+		"copy_id":   borrow.CopyID,
+		"user_id":   borrow.UserID,
+		"due_date":  borrow.DueDate,
+	})
+}
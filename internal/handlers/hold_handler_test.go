@@ -0,0 +1,108 @@
+package handlers_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+)
+
+func TestHoldsActAsSignedInUser(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		_, borrower := s.user(models.RoleStudent)
+		patronID, patron := s.user(models.RoleStudent)
+		otherID, other := s.user(models.RoleStudent)
+		titleID, _ := s.addTitle(librarian, "Dune", "SF", "B1")
+		s.mustDo(borrower, "POST", "/api/books/borrow", fiber.Map{"title_id": titleID}, fiber.StatusCreated)
+
+		s.mustDo(other, "POST", "/api/holds", fiber.Map{"title_id": titleID, "on_behalf_of_id": patronID}, fiber.StatusForbidden)
+		resp := s.mustDo(patron, "POST", "/api/holds", fiber.Map{"title_id": titleID}, fiber.StatusCreated)
+		hold := resp["hold"].(map[string]any)
+		if jsonID(hold["user_id"]) != patronID {
+			t.Errorf("hold placed for user %v, want %d", hold["user_id"], patronID)
+		}
+		holdID := jsonID(hold["id"])
+		s.mustDo(librarian, "POST", "/api/holds", fiber.Map{"title_id": titleID, "on_behalf_of_id": otherID}, fiber.StatusCreated)
+
+		// Patrons see only their own holds; staff can see anyone's.
+		s.mustDo(other, "GET", fmt.Sprintf("/api/holds?user_id=%d", patronID), nil, fiber.StatusForbidden)
+		holds := s.mustDo(other, "GET", "/api/holds", nil, fiber.StatusOK)["holds"].([]any)
+		if len(holds) != 1 || jsonID(holds[0].(map[string]any)["user_id"]) != otherID {
+			t.Errorf("got holds %v, want only the other patron's", holds)
+		}
+		holds = s.mustDo(librarian, "GET", fmt.Sprintf("/api/holds?title_id=%d", titleID), nil, fiber.StatusOK)["holds"].([]any)
+		if len(holds) != 2 {
+			t.Errorf("got %d holds on the title, want 2", len(holds))
+		}
+
+		path := fmt.Sprintf("/api/holds/%d/cancel", holdID)
+		s.mustDo(other, "POST", path, nil, fiber.StatusForbidden)
+		s.mustDo(librarian, "POST", path, nil, fiber.StatusOK)
+		s.mustDo(patron, "POST", path, nil, fiber.StatusConflict)
+
+		// Delegations are listed newest first.
+		delegations := s.mustDo(librarian, "GET", "/api/delegations", nil, fiber.StatusOK)["delegations"].([]any)
+		var actions []any
+		for _, d := range delegations {
+			actions = append(actions, d.(map[string]any)["action"])
+		}
+		if len(actions) != 2 || actions[0] != models.DelegationCancelHold || actions[1] != models.DelegationHold {
+			t.Errorf("got delegations %v, want a hold and a cancelled hold", actions)
+		}
+	})
+}
+
+func TestHoldRefusedForTitleOnLoan(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		borrowerID, borrower := s.user(models.RoleStudent)
+		titleID, _ := s.addTitle(librarian, "Dune", "SF", "B1")
+		resp := s.mustDo(borrower, "POST", "/api/books/borrow", fiber.Map{"title_id": titleID}, fiber.StatusCreated)
+
+		s.mustDo(borrower, "POST", "/api/holds", fiber.Map{"title_id": titleID}, fiber.StatusConflict)
+		s.mustDo(librarian, "POST", "/api/holds", fiber.Map{"title_id": titleID, "on_behalf_of_id": borrowerID}, fiber.StatusConflict)
+		s.mustDo(borrower, "POST", fmt.Sprintf("/api/books/return/%d", jsonID(resp["borrow_id"])), nil, fiber.StatusOK)
+		s.mustDo(borrower, "POST", "/api/holds", fiber.Map{"title_id": titleID}, fiber.StatusConflict)
+	})
+}
+
+// TestConcurrentHoldAndReturn places a hold while the only copy comes
+// back, many times over, and checks that the hold either gets the copy or
+// is refused because the copy is available, never left waiting for a copy
+// on the shelf.
+func TestConcurrentHoldAndReturn(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		_, borrower := s.user(models.RoleStudent)
+		_, patron := s.user(models.RoleStudent)
+		for round := 0; round < 10; round++ {
+			titleID, copyIDs := s.addTitle(librarian, fmt.Sprintf("Dune %d", round), "SF", fmt.Sprintf("H%d", round))
+			resp := s.mustDo(borrower, "POST", "/api/books/borrow", fiber.Map{"title_id": titleID}, fiber.StatusCreated)
+			returnPath := fmt.Sprintf("/api/books/return/%d", jsonID(resp["borrow_id"]))
+
+			var holdStatus int
+			parallel(2, func(i int) int {
+				if i == 0 {
+					status, _ := s.do(borrower, "POST", returnPath, nil)
+					return status
+				}
+				holdStatus, _ = s.do(patron, "POST", "/api/holds", fiber.Map{"title_id": titleID})
+				return holdStatus
+			})
+
+			cp, err := s.store.Copies().FindByID(copyIDs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case holdStatus == fiber.StatusCreated && cp.Status != models.CopyStatusOnHold,
+				holdStatus == fiber.StatusConflict && cp.Status != models.CopyStatusAvailable,
+				holdStatus != fiber.StatusCreated && holdStatus != fiber.StatusConflict:
+				t.Fatalf("round %d: hold got %d and the copy is %s", round, holdStatus, cp.Status)
+			}
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+const (
+	// loginAttemptsLimit is the number of attempts ListLoginAttempts
+	// returns unless asked for another.
+	loginAttemptsLimit = 100
+	// loginAttemptsMaxLimit caps what ListLoginAttempts may be asked for.
+	loginAttemptsMaxLimit = 1000
+)
+
+// backoff returns the wait after the given number of failed sign-ins.
+func (p LoginPolicy) backoff(failures int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < failures && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, p.MaxBackoff)
+}
+
+// fail counts a failed sign-in against throttle, which locks out after
+// limit failures in a row, and sets when the next attempt is allowed. It
+// reports whether this failure started the lockout.
+func (p LoginPolicy) fail(throttle *models.LoginThrottle, limit int, now time.Time) bool {
+	if throttle.LastFailureAt != nil && now.Sub(*throttle.LastFailureAt) >= p.Window {
+		throttle.Failures = 0
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = &now
+
+	// Past the limit every further failure locks out again, so a locked
+	// out account gets one guess per lockout until the window runs out.
+	wait := p.backoff(throttle.Failures)
+	locked := limit > 0 && throttle.Failures >= limit
+	if locked {
+		wait = max(wait, p.Lockout)
+	}
+	retryAt := now.Add(wait)
+	throttle.RetryAt = &retryAt
+	return locked && throttle.Failures == limit
+}
+
+// retryAfter returns how much longer throttle holds off sign-ins.
+func retryAfter(throttle *models.LoginThrottle, now time.Time) time.Duration {
+	if throttle.RetryAt == nil || !now.Before(*throttle.RetryAt) {
+		return 0
+	}
+	return throttle.RetryAt.Sub(now)
+}
+
+// tooManySignIns answers a sign-in attempt that came before the throttles
+// allow another, saying how long to wait.
+func tooManySignIns(c *fiber.Ctx, wait time.Duration) error {
+	return tooManyRequests(c, wait, "Too many failed sign-in attempts. Please try again later")
+}
+
+// tooManyRequests answers with 429 and how long to wait in seconds, both
+// in the Retry-After header and the body.
+func tooManyRequests(c *fiber.Ctx, wait time.Duration, message string) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":       message,
+		"retry_after": seconds,
+	})
+}
+
+// recordLoginFailure counts a failed sign-in against the account and the
+// client address, and emails user, if there is one, when the failure
+// locks their account.
+func (h *Handler) recordLoginFailure(tx repository.Store, account, ip *models.LoginThrottle, user *models.User, now time.Time) error {
+	locked := h.cfg.Logins.fail(account, h.cfg.Logins.MaxFailures, now)
+	h.cfg.Logins.fail(ip, h.cfg.Logins.IPMaxFailures, now)
+	if err := tx.LoginThrottles().Save(account); err != nil {
+		return err
+	}
+	if err := tx.LoginThrottles().Save(ip); err != nil {
+		return err
+	}
+	if !locked || user == nil {
+		return nil
+	}
+	return queueEmail(tx, models.EventAccountLocked, user.ID, map[string]any{
+		"Failures": account.Failures,
+		"Until":    *account.RetryAt,
+		"IP":       ip.Value,
+	})
+}
+
+// clearLoginFailures forgets the failed sign-ins of the account with
+// email and lifts any lockout on it. Failures from the client address are
+// kept, so one known password does not reset the count for guesses at
+// other accounts.
+func clearLoginFailures(tx repository.Store, email string) error {
+	throttle, err := tx.LoginThrottles().Lock(models.ThrottleAccount, email)
+	if err != nil {
+		return err
+	}
+	if throttle.Failures == 0 && throttle.RetryAt == nil {
+		return nil
+	}
+	throttle.Failures = 0
+	throttle.LastFailureAt = nil
+	throttle.RetryAt = nil
+	return tx.LoginThrottles().Save(throttle)
+}
+
+// ListLoginAttempts lists sign-in attempts, newest first, filtered by
+// ?user_id=, ?email=, ?ip= and ?failed=true and capped by ?limit=.
+func (h *Handler) ListLoginAttempts(c *fiber.Ctx) error {
+	filter := repository.LoginAttemptFilter{
+		Email:      c.Query("email"),
+		IP:         c.Query("ip"),
+		FailedOnly: c.QueryBool("failed"),
+		Limit:      loginAttemptsLimit,
+	}
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user_id"})
+		}
+		filter.UserID = uint(id)
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > loginAttemptsMaxLimit {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and " + strconv.Itoa(loginAttemptsMaxLimit)})
+		}
+		filter.Limit = limit
+	}
+
+	attempts, err := h.store.LoginAttempts().List(filter)
+	if err != nil {
+		log.Printf("Database error listing login attempts: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve login attempts"})
+	}
+	if attempts == nil {
+		attempts = []models.LoginAttempt{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":        "Login attempts retrieved successfully",
+		"login_attempts": attempts,
+	})
+}
@@ -0,0 +1,119 @@
+package handlers_test
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/handlers"
+	"library-management/internal/models"
+)
+
+// strictLogins locks an account after three failed sign-ins in a row and
+// a client address after five, with no backoff before that.
+func strictLogins() handlers.Config {
+	cfg := handlers.DefaultConfig()
+	cfg.Logins.MaxFailures = 3
+	cfg.Logins.IPMaxFailures = 5
+	cfg.Logins.Backoff = 0
+	cfg.Logins.MaxBackoff = 0
+	cfg.Logins.Lockout = 15 * time.Minute
+	return cfg
+}
+
+// signInAs attempts a sign-in and returns the status and the Retry-After
+// header.
+func (s *testServer) signInAs(email, password string) (int, string) {
+	s.t.Helper()
+	resp := s.send("", "POST", "/api/signin", fiber.Map{"email": email, "password": password})
+	if resp == nil {
+		return 0, ""
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter)
+}
+
+// wantThrottled fails the test unless a sign-in as email is refused with a
+// Retry-After of about the lockout.
+func (s *testServer) wantThrottled(email string) {
+	s.t.Helper()
+	status, retry := s.signInAs(email, testPassword)
+	seconds, _ := strconv.Atoi(retry)
+	if status != fiber.StatusTooManyRequests || seconds < 14*60 || seconds > 15*60 {
+		s.t.Errorf("signing in as %s: got %d with Retry-After %q, want 429 for the 15 minute lockout", email, status, retry)
+	}
+}
+
+func TestSignInLocksAccountAfterFailures(t *testing.T) {
+	forEachStoreWith(t, strictLogins(), func(t *testing.T, s *testServer) {
+		user := s.newUser(models.RoleStudent)
+		other := s.newUser(models.RoleStudent)
+		for i := 0; i < 3; i++ {
+			if status, _ := s.signInAs(user.Email, "wrong"); status != fiber.StatusUnauthorized {
+				t.Fatalf("failed sign-in %d: got %d, want 401", i+1, status)
+			}
+		}
+
+		// Even the right password waits out the lockout, which a restart
+		// does not lift, while other accounts are unaffected.
+		s.wantThrottled(user.Email)
+		s = s.restart()
+		s.wantThrottled(user.Email)
+		s.signIn(other.Email)
+	})
+}
+
+func TestSignInSuccessClearsAccountFailures(t *testing.T) {
+	forEachStoreWith(t, strictLogins(), func(t *testing.T, s *testServer) {
+		user := s.newUser(models.RoleStudent)
+		for round := 0; round < 2; round++ {
+			for i := 0; i < 2; i++ {
+				if status, _ := s.signInAs(user.Email, "wrong"); status != fiber.StatusUnauthorized {
+					t.Fatalf("round %d, failed sign-in %d: got %d, want 401", round, i+1, status)
+				}
+			}
+			s.signIn(user.Email)
+		}
+	})
+}
+
+func TestSignInLocksClientAddressAcrossAccounts(t *testing.T) {
+	forEachStoreWith(t, strictLogins(), func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		user := s.newUser(models.RoleStudent)
+		for i := 0; i < 5; i++ {
+			email := fmt.Sprintf("guess%d@example.com", i)
+			if status, _ := s.signInAs(email, "wrong"); status != fiber.StatusUnauthorized {
+				t.Fatalf("guess %d: got %d, want 401", i+1, status)
+			}
+		}
+		s.wantThrottled(user.Email)
+
+		attempts := s.mustDo(librarian, "GET", "/api/login-attempts?failed=true", nil, fiber.StatusOK)["login_attempts"].([]any)
+		if len(attempts) != 6 {
+			t.Fatalf("got %d failed attempts, want 6", len(attempts))
+		}
+		if outcome := attempts[0].(map[string]any)["outcome"]; outcome != models.LoginThrottled {
+			t.Errorf("latest attempt's outcome is %v, want %q", outcome, models.LoginThrottled)
+		}
+	})
+}
+
+func TestSignInRefusesBlockedUser(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		user := s.newUser(models.RoleStudent)
+		s.mustDo(librarian, "POST", fmt.Sprintf("/api/users/%d/block", user.ID), fiber.Map{"reason": "lost books"}, fiber.StatusOK)
+
+		if status, _ := s.signInAs(user.Email, testPassword); status != fiber.StatusForbidden {
+			t.Errorf("blocked user signing in: got %d, want 403", status)
+		}
+		attempts := s.mustDo(librarian, "GET", fmt.Sprintf("/api/login-attempts?user_id=%d", user.ID), nil, fiber.StatusOK)["login_attempts"].([]any)
+		if len(attempts) != 1 || attempts[0].(map[string]any)["outcome"] != models.LoginBlocked {
+			t.Errorf("got attempts %v, want one refused as blocked", attempts)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+// noticeKind returns the notice a loan due at due is ready for at now, or
+// "" if none.
+func (p NoticePolicy) noticeKind(due, now time.Time) string {
+	if !now.After(due) {
+		if p.DueSoonDays > 0 && due.Before(now.AddDate(0, 0, p.DueSoonDays)) {
+			return models.NoticeDueSoon
+		}
+		return ""
+	}
+	if p.FinalNoticeDays > 0 && !now.Before(due.AddDate(0, 0, p.FinalNoticeDays)) {
+		return models.NoticeFinal
+	}
+	return models.NoticeOverdue
+}
+
+// SendNotices queues due-soon, overdue and final notices for active loans
+// in the email outbox. Each kind is queued at most once per loan and due
+// date, in the same transaction that records it. It returns the number of
+// notices queued.
+func (h *Handler) SendNotices(now time.Time) (int, error) {
+	borrows, err := h.store.Borrows().ListActiveDueBefore(now.AddDate(0, 0, max(h.cfg.Notices.DueSoonDays, 0)))
+	if err != nil {
+		return 0, err
+	}
+
+	var sent int
+	for i := range borrows {
+		ok, err := h.sendNotice(borrows[i].ID, now)
+		if err != nil {
+			// Keep going: one broken loan should not hold up everyone
+			// else's reminders.
+			log.Printf("Error sending notice for borrow %d: %v", borrows[i].ID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendNotice queues the notice the loan is due for, if it has not been
+// sent already, and reports whether it queued one.
+func (h *Handler) sendNotice(borrowID uint, now time.Time) (bool, error) {
+	var sent bool
+	err := h.store.Transaction(func(tx repository.Store) error {
+		// The lock keeps a concurrent run from sending the same notice and
+		// a concurrent return from racing with the reminder.
+		borrow, err := tx.Borrows().LockActive(borrowID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		kind := h.cfg.Notices.noticeKind(borrow.DueDate, now)
+		if kind == "" {
+			return nil
+		}
+		exists, err := tx.Notices().Exists(borrow.ID, kind, borrow.RenewCount)
+		if err != nil || exists {
+			return err
+		}
+
+		cp, err := tx.Copies().FindByID(borrow.CopyID)
+		if err != nil {
+			return err
+		}
+		title, err := tx.Titles().FindByID(cp.TitleID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Notices().Create(&models.Notice{
+			BorrowID:   borrow.ID,
+			UserID:     borrow.UserID,
+			Kind:       kind,
+			RenewCount: borrow.RenewCount,
+			SentAt:     now,
+		}); err != nil {
+			return err
+		}
+		err = queueEmail(tx, kind, borrow.UserID, map[string]any{
+			"BorrowID":    borrow.ID,
+			"Title":       title.Title,
+			"Barcode":     cp.Barcode,
+			"DueDate":     borrow.DueDate,
+			"OverdueDays": int(math.Ceil(now.Sub(borrow.DueDate).Hours() / 24)),
+		})
+		if err != nil {
+			return err
+		}
+		sent = true
+		return nil
+	})
+	return sent, err
+}
+
+// GetBorrowNotices lists the reminders sent for a loan.
+func (h *Handler) GetBorrowNotices(c *fiber.Ctx) error {
+	borrowID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || borrowID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid borrow ID"})
+	}
+
+	if _, err := h.store.Borrows().FindByID(uint(borrowID)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Borrow record not found"})
+		}
+		log.Printf("Database error finding borrow: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	notices, err := h.store.Notices().ListByBorrow(uint(borrowID))
+	if err != nil {
+		log.Printf("Database error listing notices: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve notices"})
+	}
+	if notices == nil {
+		notices = []models.Notice{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Notices retrieved successfully",
+		"notices": notices,
+	})
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+	"library-management/internal/notify"
+	"library-management/internal/repository"
+)
+
+const (
+	// outboxBatchSize caps the messages claimed by one DeliverOutbox run.
+	outboxBatchSize = 50
+	// outboxLease is how long a claimed message is left alone before
+	// another run may try it again, in case the sender died mid-delivery.
+	outboxLease = 5 * time.Minute
+)
+
+// queueEmail renders the template for event and adds the message to the
+// outbox in tx, so it is only sent if the surrounding change commits. The
+// recipient's Name, Email and Balance are added to data.
+func queueEmail(tx repository.Store, event string, userID uint, data map[string]any) error {
+	user, err := tx.Users().FindByID(userID)
+	if err != nil {
+		return err
+	}
+	data["Name"] = user.Name
+	data["Email"] = user.Email
+	data["Balance"] = user.Penalty
+
+	subject, body, err := notify.Render(event, data)
+	if err != nil {
+		return err
+	}
+	return tx.Outbox().Create(&models.OutboxMessage{
+		Event:         event,
+		UserID:        &user.ID,
+		Recipient:     user.Email,
+		Subject:       subject,
+		Body:          body,
+		Status:        models.OutboxPending,
+		NextAttemptAt: time.Now(),
+	})
+}
+
+// redactOutbox hides the body of emails that carry a secret, such as a
+// password reset token, from whoever reads the outbox.
+func redactOutbox(msg *models.OutboxMessage) {
+	if models.IsSensitiveEvent(msg.Event) {
+		msg.Body = "[redacted]"
+	}
+}
+
+// DeliverOutbox sends the outbox messages that are due. Each message is
+// claimed in a short transaction and sent outside it; a failed delivery is
+// retried with exponential backoff until the message is marked dead. It
+// returns the number of messages sent.
+func (h *Handler) DeliverOutbox(now time.Time) (int, error) {
+	var claimed []models.OutboxMessage
+	err := h.store.Transaction(func(tx repository.Store) error {
+		var err error
+		if claimed, err = tx.Outbox().LockDue(now, outboxBatchSize); err != nil {
+			return err
+		}
+		for i := range claimed {
+			claimed[i].Attempts++
+			claimed[i].NextAttemptAt = now.Add(outboxLease)
+			if err := tx.Outbox().Save(&claimed[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var sent int
+	for i := range claimed {
+		msg := &claimed[i]
+		sendErr := h.notifier.Notify(notify.Message{To: msg.Recipient, Subject: msg.Subject, Body: msg.Body})
+		if sendErr == nil {
+			sentAt := time.Now()
+			msg.Status = models.OutboxSent
+			msg.SentAt = &sentAt
+			msg.LastError = ""
+			sent++
+		} else {
+			msg.LastError = sendErr.Error()
+			if msg.Attempts >= h.cfg.Outbox.MaxAttempts {
+				msg.Status = models.OutboxDead
+				log.Printf("Giving up on outbox message %d after %d attempts: %v", msg.ID, msg.Attempts, sendErr)
+			} else {
+				msg.NextAttemptAt = time.Now().Add(h.cfg.Outbox.backoff(msg.Attempts))
+			}
+		}
+		if err := h.store.Outbox().Save(msg); err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (p OutboxPolicy) backoff(attempts int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < attempts && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, p.MaxBackoff)
+}
+
+// ListOutbox lists outbox messages, filtered by ?status=pending|sent|dead.
+func (h *Handler) ListOutbox(c *fiber.Ctx) error {
+	status := c.Query("status")
+	switch status {
+	case "", models.OutboxPending, models.OutboxSent, models.OutboxDead:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid status. Must be 'pending', 'sent', or 'dead'"})
+	}
+
+	msgs, err := h.store.Outbox().List(status)
+	if err != nil {
+		log.Printf("Database error listing outbox: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve outbox"})
+	}
+	if msgs == nil {
+		msgs = []models.OutboxMessage{}
+	}
+	for i := range msgs {
+		redactOutbox(&msgs[i])
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Outbox retrieved successfully",
+		"messages": msgs,
+	})
+}
+
+// RetryOutboxMessage puts a dead message back in the queue with a fresh
+// set of attempts.
+func (h *Handler) RetryOutboxMessage(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || id == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid message ID"})
+	}
+
+	msg, err := h.store.Outbox().FindByID(uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Outbox message not found"})
+		}
+		log.Printf("Database error finding outbox message: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	if msg.Status != models.OutboxDead {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Only dead messages can be retried"})
+	}
+
+	msg.Status = models.OutboxPending
+	msg.Attempts = 0
+	msg.NextAttemptAt = time.Now()
+	if err := h.store.Outbox().Save(msg); err != nil {
+		log.Printf("Database error retrying outbox message: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retry message"})
+	}
+	redactOutbox(msg)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":        "Message queued for delivery",
+		"outbox_message": msg,
+	})
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+var errLastRoleManager = errors.New("no user would be left who can manage roles")
+
+// roleNamePattern keeps role names safe to use in URLs and JWT claims.
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// RolePermissions returns the permissions granted to role. It is used by
+// middleware.LoadPermissions on every authenticated request.
+func (h *Handler) RolePermissions(role string) (models.PermissionSet, error) {
+	permissions, err := h.store.Permissions().ListByRole(role)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewPermissionSet(permissions), nil
+}
+
+// hasPermission reports whether the signed-in user's role holds any of
+// permissions.
+func hasPermission(c *fiber.Ctx, permissions ...string) bool {
+	granted, _ := c.Locals("permissions").(models.PermissionSet)
+	return granted.Has(permissions...)
+}
+
+// knownRole reports whether role is built in or has been granted any
+// permissions, which is how new staff roles are defined.
+func knownRole(tx repository.Store, role string) (bool, error) {
+	if models.IsValidRole(role) {
+		return true, nil
+	}
+	permissions, err := tx.Permissions().ListByRole(role)
+	return len(permissions) > 0, err
+}
+
+// countRoleManagers returns the number of users whose role can manage
+// roles. The users are locked so that two concurrent changes cannot both
+// rely on the other one's user.
+func countRoleManagers(tx repository.Store) (int, error) {
+	grants, err := tx.Permissions().List()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, g := range grants {
+		if g.Permission != models.PermRolesManage {
+			continue
+		}
+		users, err := tx.Users().LockByRole(g.Role)
+		if err != nil {
+			return 0, err
+		}
+		n += len(users)
+	}
+	return n, nil
+}
+
+// ListRoles returns the permissions granted to each role, along with every
+// permission that can be granted.
+func (h *Handler) ListRoles(c *fiber.Ctx) error {
+	grants, err := h.store.Permissions().List()
+	if err != nil {
+		log.Printf("Database error listing role permissions: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve roles"})
+	}
+
+	roles := map[string][]string{
+		models.RoleLibrarian: {},
+		models.RoleStudent:   {},
+		models.RoleGeneral:   {},
+	}
+	for _, g := range grants {
+		roles[g.Role] = append(roles[g.Role], g.Permission)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":     "Roles retrieved successfully",
+		"roles":       roles,
+		"permissions": models.AllPermissions,
+	})
+}
+
+type RolePermissionsRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+// SetRolePermissions replaces the permissions of a role, creating the role
+// if it is new. The change applies to the role's users at their next
+// request.
+func (h *Handler) SetRolePermissions(c *fiber.Ctx) error {
+	// Params are only valid during the request, and the role outlives it
+	// in the memory store.
+	role := utils.CopyString(c.Params("role"))
+	if !roleNamePattern.MatchString(role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid role name. Use lowercase letters, digits, '-' and '_'"})
+	}
+
+	var req RolePermissionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	for _, p := range req.Permissions {
+		if !models.IsValidPermission(p) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown permission: " + p})
+		}
+	}
+	slices.Sort(req.Permissions)
+	req.Permissions = slices.Compact(req.Permissions)
+
+	err := h.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Permissions().SetForRole(role, req.Permissions); err != nil {
+			return err
+		}
+		managers, err := countRoleManagers(tx)
+		if err != nil {
+			return err
+		}
+		if managers == 0 {
+			return errLastRoleManager
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errLastRoleManager) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This change would leave no user who can manage roles"})
+		}
+		log.Printf("Error setting role permissions: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update role"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":     "Role permissions updated successfully",
+		"role":        role,
+		"permissions": req.Permissions,
+	})
+}
@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+)
+
+// rolePermissions returns the permissions granted to role.
+func (s *testServer) rolePermissions(token, role string) []any {
+	s.t.Helper()
+	roles := s.mustDo(token, "GET", "/api/roles", nil, fiber.StatusOK)["roles"].(map[string]any)
+	permissions, _ := roles[role].([]any)
+	return permissions
+}
+
+func TestRouteDeniesRoleWithoutPermission(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		studentID, student := s.user(models.RoleStudent)
+		if slices.Contains(s.rolePermissions(librarian, models.RoleStudent), any(models.PermFinesRead)) {
+			t.Fatalf("students are granted %s, want them without it", models.PermFinesRead)
+		}
+
+		path := fmt.Sprintf("/api/users/%d/fines", studentID)
+		s.mustDo(student, "GET", path, nil, fiber.StatusForbidden)
+		s.mustDo(student, "GET", "/api/roles", nil, fiber.StatusForbidden)
+		s.mustDo(student, "PUT", "/api/roles/student/permissions", fiber.Map{"permissions": []string{models.PermFinesRead}}, fiber.StatusForbidden)
+		s.mustDo(librarian, "GET", path, nil, fiber.StatusOK)
+	})
+}
+
+func TestRolePermissionChangesApplyAtOnce(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		studentID, student := s.user(models.RoleStudent)
+		path := fmt.Sprintf("/api/users/%d/fines", studentID)
+		granted := s.rolePermissions(librarian, models.RoleStudent)
+
+		// Granting a permission lets a student who is already signed in
+		// use it on their next request, and taking it away stops them.
+		s.mustDo(librarian, "PUT", "/api/roles/student/permissions", fiber.Map{"permissions": append(granted, models.PermFinesRead)}, fiber.StatusOK)
+		s.mustDo(student, "GET", path, nil, fiber.StatusOK)
+		s.mustDo(librarian, "PUT", "/api/roles/student/permissions", fiber.Map{"permissions": granted}, fiber.StatusOK)
+		s.mustDo(student, "GET", path, nil, fiber.StatusForbidden)
+
+		// The same goes for a librarian losing one.
+		var kept []any
+		for _, p := range s.rolePermissions(librarian, models.RoleLibrarian) {
+			if p != models.PermFinesRead {
+				kept = append(kept, p)
+			}
+		}
+		s.mustDo(librarian, "PUT", "/api/roles/librarian/permissions", fiber.Map{"permissions": kept}, fiber.StatusOK)
+		s.mustDo(librarian, "GET", path, nil, fiber.StatusForbidden)
+
+		s.mustDo(librarian, "PUT", "/api/roles/librarian/permissions", fiber.Map{"permissions": []string{models.PermFinesRead}}, fiber.StatusConflict)
+		s.mustDo(librarian, "PUT", "/api/roles/student/permissions", fiber.Map{"permissions": []string{"books:burn"}}, fiber.StatusBadRequest)
+		s.mustDo(librarian, "GET", "/api/roles", nil, fiber.StatusOK)
+	})
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+// fallbackPolicy applies when no stored policy matches, so lending keeps
+// working with an empty policy table.
+var fallbackPolicy = models.CirculationPolicy{
+	LoanDays:    7,
+	FineRate:    100,
+	MaxRenewals: 2,
+}
+
+// resolvePolicy returns the circulation policy for a patron role and item
+// genre, read from the store on every call so changes apply immediately.
+func resolvePolicy(tx repository.Store, role, genre string) (*models.CirculationPolicy, error) {
+	policy, err := tx.Policies().Resolve(role, genre)
+	if errors.Is(err, repository.ErrNotFound) {
+		p := fallbackPolicy
+		return &p, nil
+	}
+	return policy, err
+}
+
+// PolicyRequest is used to create and update policies. Fields left out of
+// an update keep their value.
+type PolicyRequest struct {
+	Role        *string `json:"role"`
+	Genre       *string `json:"genre"`
+	LoanDays    *int    `json:"loan_days"`
+	MaxLoans    *int    `json:"max_loans"`
+	FineRate    *int64  `json:"fine_rate"`
+	FineCap     *int64  `json:"fine_cap"`
+	GraceDays   *int    `json:"grace_days"`
+	MaxRenewals *int    `json:"max_renewals"`
+}
+
+func (req *PolicyRequest) apply(policy *models.CirculationPolicy) {
+	if req.Role != nil {
+		policy.Role = *req.Role
+	}
+	if req.Genre != nil {
+		policy.Genre = *req.Genre
+	}
+	if req.LoanDays != nil {
+		policy.LoanDays = *req.LoanDays
+	}
+	if req.MaxLoans != nil {
+		policy.MaxLoans = *req.MaxLoans
+	}
+	if req.FineRate != nil {
+		policy.FineRate = *req.FineRate
+	}
+	if req.FineCap != nil {
+		policy.FineCap = *req.FineCap
+	}
+	if req.GraceDays != nil {
+		policy.GraceDays = *req.GraceDays
+	}
+	if req.MaxRenewals != nil {
+		policy.MaxRenewals = *req.MaxRenewals
+	}
+}
+
+func validatePolicy(tx repository.Store, policy *models.CirculationPolicy) (string, error) {
+	if policy.Role != "" {
+		known, err := knownRole(tx, policy.Role)
+		if err != nil {
+			return "", err
+		}
+		if !known {
+			return "Unknown role. Must be empty (any role), 'librarian', 'student', 'general', or a role with permissions", nil
+		}
+	}
+	if policy.LoanDays <= 0 {
+		return "LoanDays must be greater than zero", nil
+	}
+	if policy.MaxLoans < 0 || policy.GraceDays < 0 || policy.MaxRenewals < 0 || policy.FineRate < 0 || policy.FineCap < 0 {
+		return "MaxLoans, GraceDays, MaxRenewals, FineRate, and FineCap cannot be negative", nil
+	}
+	return "", nil
+}
+
+func (h *Handler) ListPolicies(c *fiber.Ctx) error {
+	policies, err := h.store.Policies().List()
+	if err != nil {
+		log.Printf("Database error listing policies: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve policies"})
+	}
+	if policies == nil {
+		policies = []models.CirculationPolicy{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Policies retrieved successfully",
+		"policies": policies,
+		"fallback": fallbackPolicy,
+	})
+}
+
+func (h *Handler) CreatePolicy(c *fiber.Ctx) error {
+	req := new(PolicyRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON body"})
+	}
+
+	policy := fallbackPolicy
+	req.apply(&policy)
+	if msg, err := validatePolicy(h.store, &policy); err != nil {
+		log.Printf("Database error validating policy: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	} else if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if _, err := h.store.Policies().FindExact(policy.Role, policy.Genre); err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A policy for this role and genre already exists"})
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		log.Printf("Database error checking for existing policy: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if err := h.store.Policies().Create(&policy); err != nil {
+		log.Printf("Error creating policy: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create policy"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Policy created successfully",
+		"policy":  policy,
+	})
+}
+
+func (h *Handler) UpdatePolicy(c *fiber.Ctx) error {
+	policyID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || policyID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid policy ID"})
+	}
+
+	req := new(PolicyRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON body"})
+	}
+
+	policy, err := h.store.Policies().FindByID(uint(policyID))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Policy not found"})
+		}
+		log.Printf("Database error finding policy: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	req.apply(policy)
+	if msg, err := validatePolicy(h.store, policy); err != nil {
+		log.Printf("Database error validating policy: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	} else if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if existing, err := h.store.Policies().FindExact(policy.Role, policy.Genre); err == nil && existing.ID != policy.ID {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A policy for this role and genre already exists"})
+	} else if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Printf("Database error checking for existing policy: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if err := h.store.Policies().Save(policy); err != nil {
+		log.Printf("Error updating policy: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update policy"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Policy updated successfully",
+		"policy":  policy,
+	})
+}
+
+func (h *Handler) DeletePolicy(c *fiber.Ctx) error {
+	policyID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || policyID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid policy ID"})
+	}
+
+	if _, err := h.store.Policies().FindByID(uint(policyID)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Policy not found"})
+		}
+		log.Printf("Database error finding policy: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if err := h.store.Policies().Delete(uint(policyID)); err != nil {
+		log.Printf("Error deleting policy: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete policy"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Policy deleted successfully"})
+}
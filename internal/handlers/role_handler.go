@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+var (
+	errLibrarianExists = errors.New("a librarian already exists")
+	errRoleUnchanged   = errors.New("user already has this role")
+	errUnknownRole     = errors.New("role is not defined")
+)
+
+// BootstrapLibrarian creates the first librarian account. It fails once
+// any librarian exists; further librarians are made by promoting users
+// through ChangeUserRole.
+func (h *Handler) BootstrapLibrarian(name, email, password string) (*models.User, error) {
+	if name == "" || email == "" || password == "" {
+		return nil, errors.New("name, email and password are required")
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	// The address was given by whoever runs the server, so it is taken as
+	// verified.
+	now := time.Now()
+	user := &models.User{
+		Name:            name,
+		Email:           email,
+		Password:        string(hashedPassword),
+		Role:            models.RoleLibrarian,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	}
+
+	err = h.store.Transaction(func(tx repository.Store) error {
+		librarians, err := tx.Users().LockByRole(models.RoleLibrarian)
+		if err != nil {
+			return err
+		}
+		if len(librarians) > 0 {
+			return errLibrarianExists
+		}
+		if _, err := tx.Users().FindByEmail(email); err == nil {
+			return fmt.Errorf("a user with email %s already exists", email)
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		if err := tx.Users().Create(user); err != nil {
+			return err
+		}
+		err = tx.RoleChanges().Create(&models.RoleChange{
+			UserID:  user.ID,
+			NewRole: models.RoleLibrarian,
+			Reason:  "Bootstrap librarian",
+		})
+		if err != nil {
+			return err
+		}
+		return queueEmail(tx, models.EventSignup, user.ID, map[string]any{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+type RoleChangeRequest struct {
+	Role   string `json:"role"`
+	Reason string `json:"reason"`
+}
+
+// ChangeUserRole moves a user to another role. The last user who can
+// manage roles cannot be moved out of them, so nobody is locked out of the
+// permission table.
+func (h *Handler) ChangeUserRole(c *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || userID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	changedByID, _ := c.Locals("userID").(uint)
+
+	var req RoleChangeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Role == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Role is required"})
+	}
+	if req.Reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Reason is required"})
+	}
+
+	var change *models.RoleChange
+	err = h.store.Transaction(func(tx repository.Store) error {
+		user, err := tx.Users().Lock(uint(userID))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errUserNotFound
+			}
+			return err
+		}
+		if user.Role == req.Role {
+			return errRoleUnchanged
+		}
+		known, err := knownRole(tx, req.Role)
+		if err != nil {
+			return err
+		}
+		if !known {
+			return errUnknownRole
+		}
+
+		oldPermissions, err := tx.Permissions().ListByRole(user.Role)
+		if err != nil {
+			return err
+		}
+		newPermissions, err := tx.Permissions().ListByRole(req.Role)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(oldPermissions, models.PermRolesManage) && !slices.Contains(newPermissions, models.PermRolesManage) {
+			managers, err := countRoleManagers(tx)
+			if err != nil {
+				return err
+			}
+			if managers <= 1 {
+				return errLastRoleManager
+			}
+		}
+
+		if err := tx.Users().SetRole(user.ID, req.Role); err != nil {
+			return err
+		}
+		// Access tokens carry the role, so retire them; the next refresh
+		// issues one with the new role.
+		if err := tx.Users().BumpTokenVersion(user.ID); err != nil {
+			return err
+		}
+		change = &models.RoleChange{
+			UserID:      user.ID,
+			OldRole:     user.Role,
+			NewRole:     req.Role,
+			Reason:      req.Reason,
+			ChangedByID: &changedByID,
+		}
+		return tx.RoleChanges().Create(change)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errUserNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		case errors.Is(err, errRoleUnchanged):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User already has this role"})
+		case errors.Is(err, errUnknownRole):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown role. Grant it permissions before assigning it"})
+		case errors.Is(err, errLastRoleManager):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The last user who can manage roles cannot be moved out of them"})
+		}
+		log.Printf("Error changing user role: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not change role"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":     "Role changed successfully",
+		"role_change": change,
+	})
+}
+
+// GetUserRoleChanges lists the role history of a user.
+func (h *Handler) GetUserRoleChanges(c *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || userID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	user, err := h.store.Users().FindByID(uint(userID))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		log.Printf("Database error finding user: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	changes, err := h.store.RoleChanges().ListByUser(user.ID)
+	if err != nil {
+		log.Printf("Database error listing role changes: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve role history"})
+	}
+	if changes == nil {
+		changes = []models.RoleChange{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":      "Role history retrieved successfully",
+		"user_id":      user.ID,
+		"role":         user.Role,
+		"role_changes": changes,
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"library-management/internal/db"
+)
+
+var (
+	errNoKeyEncryptionKey = errors.New("no key-encryption key is set")
+	errSecretUnreadable   = errors.New("secret does not open with any key-encryption key")
+)
+
+// secretCipher returns the cipher secrets for purpose are stored under with
+// the key-encryption key kek, so that a copy of the database alone does not
+// give them away.
+func secretCipher(kek, purpose string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, []byte(kek))
+	mac.Write([]byte(purpose))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSecret encrypts secret for storage with the current key-encryption
+// key.
+func sealSecret(purpose string, secret []byte) (string, error) {
+	if len(db.KeyEncryptionKeys) == 0 {
+		return "", errNoKeyEncryptionKey
+	}
+	aead, err := secretCipher(db.KeyEncryptionKeys[0], purpose)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(aead.Seal(nonce, nonce, secret, nil)), nil
+}
+
+// openSecret decrypts a secret sealed by sealSecret for the same purpose,
+// trying the current key-encryption key and then the old ones. current
+// reports whether it opened with the current key.
+func openSecret(purpose, sealed string) (secret []byte, current bool, err error) {
+	raw, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, false, err
+	}
+	for i, kek := range db.KeyEncryptionKeys {
+		aead, err := secretCipher(kek, purpose)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(raw) < aead.NonceSize() {
+			return nil, false, errors.New("sealed secret is too short")
+		}
+		secret, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+		if err == nil {
+			return secret, i == 0, nil
+		}
+	}
+	return nil, false, errSecretUnreadable
+}
+
+// resealSecret seals again with the current key-encryption key a secret
+// that was sealed with an old one. It returns "" if sealed is already
+// under the current key.
+func resealSecret(purpose, sealed string) (string, error) {
+	secret, current, err := openSecret(purpose, sealed)
+	if err != nil || current {
+		return "", err
+	}
+	return sealSecret(purpose, secret)
+}
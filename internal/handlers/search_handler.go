@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+const (
+	// searchLimit is the number of hits SearchBooks returns unless asked
+	// for another.
+	searchLimit = 20
+	// searchMaxLimit caps what SearchBooks may be asked for.
+	searchMaxLimit = 100
+	// searchMaxQuery is the longest query SearchBooks takes, in
+	// characters.
+	searchMaxQuery = 200
+	// facetLimit is the number of values GetBookFacets returns for each
+	// facet unless asked for another.
+	facetLimit = 20
+	// facetMaxLimit caps what GetBookFacets may be asked for.
+	facetMaxLimit = 100
+)
+
+// SearchBooks searches the titles and authors of the catalog for ?q=,
+// forgiving small misspellings, and returns the best ?limit= titles with
+// the matching words highlighted.
+func (h *Handler) SearchBooks(c *fiber.Ctx) error {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "q is required"})
+	}
+	if utf8.RuneCountInString(query) > searchMaxQuery {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "q must be at most " + strconv.Itoa(searchMaxQuery) + " characters"})
+	}
+	limit := searchLimit
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > searchMaxLimit {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and " + strconv.Itoa(searchMaxLimit)})
+		}
+	}
+
+	hits, err := h.store.Titles().Search(query, limit)
+	if err != nil {
+		log.Printf("Database error searching books: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not search books"})
+	}
+	if hits == nil {
+		hits = []repository.TitleHit{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Books searched successfully",
+		"query":   query,
+		"results": hits,
+	})
+}
+
+// GetBookFacets counts the titles that GetAllBooks would list for the same
+// ?q=, ?genre=, ?available= and ?donor_id= by genre, author, decade of
+// publication and donor, with how many of each have a copy available. Each
+// facet keeps its ?limit= most common values.
+func (h *Handler) GetBookFacets(c *fiber.Ctx) error {
+	filter, msg := parseTitleFilter(c)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	limit := facetLimit
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > facetMaxLimit {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and " + strconv.Itoa(facetMaxLimit)})
+		}
+	}
+
+	facets, err := h.store.Titles().Facets(filter)
+	if err != nil {
+		log.Printf("Database error counting book facets: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve book facets"})
+	}
+	facets.Genres = facets.Genres[:min(limit, len(facets.Genres))]
+	facets.Authors = facets.Authors[:min(limit, len(facets.Authors))]
+	facets.Decades = facets.Decades[:min(limit, len(facets.Decades))]
+	facets.Donors = facets.Donors[:min(limit, len(facets.Donors))]
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Book facets retrieved successfully",
+		"facets":  facets,
+	})
+}
+
+// GetBooksByISBN resolves a scanned ISBN, ISBN-10 or ISBN-13, to the titles
+// in the catalog that carry it, with their copy counts.
+func (h *Handler) GetBooksByISBN(c *fiber.Ctx) error {
+	isbn, ok := models.NormalizeISBN(c.Params("isbn"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": invalidISBN})
+	}
+
+	books, err := h.store.Titles().ListSummaries(repository.TitleQuery{
+		TitleFilter: repository.TitleFilter{ISBN: isbn},
+		Sort:        []repository.TitleSort{{Key: repository.TitleSortTitle}},
+	})
+	if err != nil {
+		log.Printf("Database error finding books by ISBN: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve books"})
+	}
+	if len(books) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No book has this ISBN", "isbn": isbn})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Books retrieved successfully",
+		"isbn":    isbn,
+		"books":   books,
+	})
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+// ErrSessionRevoked is returned by CheckSession for an access token that was
+// valid when issued but has since been revoked.
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+var (
+	errRefreshTokenInvalid = errors.New("refresh token not found")
+	errRefreshTokenExpired = errors.New("refresh token expired")
+	errRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+// tokenPair is what SignIn and RefreshToken hand out.
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int // seconds until the access token expires
+}
+
+func (p *tokenPair) json() fiber.Map {
+	return fiber.Map{
+		"token":         p.AccessToken,
+		"refresh_token": p.RefreshToken,
+		"expires_in":    p.ExpiresIn,
+	}
+}
+
+// hashToken returns the form a refresh token is stored in.
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens signs an access token for user and stores a new refresh token
+// in tx. It returns the pair and the stored refresh token.
+func (h *Handler) issueTokens(tx repository.Store, user *models.User, now time.Time) (*tokenPair, *models.RefreshToken, error) {
+	claims := &Claims{
+		UserID:       user.ID,
+		Email:        user.Email,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(h.cfg.Tokens.AccessTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+	accessToken, err := h.signAccessToken(tx, claims, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, nil, err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+	stored := &models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: now.Add(h.cfg.Tokens.RefreshTTL),
+	}
+	if err := tx.RefreshTokens().Create(stored); err != nil {
+		return nil, nil, err
+	}
+
+	return &tokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: raw,
+		ExpiresIn:    int(h.cfg.Tokens.AccessTTL.Seconds()),
+	}, stored, nil
+}
+
+// revokeSessions ends every session of the user: access tokens stop
+// working at the next request, and refresh tokens and half-finished
+// two-factor sign-ins can no longer be used.
+func revokeSessions(tx repository.Store, userID uint, now time.Time) error {
+	if err := tx.Users().BumpTokenVersion(userID); err != nil {
+		return err
+	}
+	if err := tx.UserTokens().UseAll(userID, models.TokenTwoFactor, now); err != nil {
+		return err
+	}
+	return tx.RefreshTokens().RevokeAllByUser(userID, now)
+}
+
+// CheckSession rejects access tokens issued before the user's sessions
+// were revoked, and those of users who must set up two-factor
+// authentication first. middleware.Authenticate calls it on every request.
+func (h *Handler) CheckSession(claims *Claims) error {
+	user, err := h.store.Users().FindByID(claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+	if user.TokenVersion != claims.TokenVersion || user.BlockedManually || h.needsTwoFactorSetup(user) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Each refresh token works once; presenting one that was
+// already used ends all of the user's sessions, since it means the token
+// was stolen or leaked.
+func (h *Handler) RefreshToken(c *fiber.Ctx) error {
+	var req RefreshTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "refresh_token is required"})
+	}
+
+	var pair *tokenPair
+	var reused bool
+	err := h.store.Transaction(func(tx repository.Store) error {
+		// The lock makes a second concurrent refresh with the same token
+		// wait, then find it revoked.
+		token, err := tx.RefreshTokens().LockByHash(hashToken(req.RefreshToken))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errRefreshTokenInvalid
+			}
+			return err
+		}
+		now := time.Now()
+		if token.RevokedAt != nil {
+			if token.ReplacedByID != nil {
+				// Commit the revocation rather than rolling it back with
+				// an error.
+				reused = true
+				return revokeSessions(tx, token.UserID, now)
+			}
+			return errRefreshTokenInvalid
+		}
+		if now.After(token.ExpiresAt) {
+			return errRefreshTokenExpired
+		}
+
+		user, err := tx.Users().FindByID(token.UserID)
+		if err != nil {
+			return err
+		}
+		if user.BlockedManually || h.needsTwoFactorSetup(user) {
+			return errRefreshTokenInvalid
+		}
+
+		var next *models.RefreshToken
+		if pair, next, err = h.issueTokens(tx, user, now); err != nil {
+			return err
+		}
+		token.RevokedAt = &now
+		token.ReplacedByID = &next.ID
+		return tx.RefreshTokens().Save(token)
+	})
+	if err == nil && reused {
+		err = errRefreshTokenReused
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, errRefreshTokenInvalid):
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+		case errors.Is(err, errRefreshTokenExpired):
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Refresh token expired. Please sign in again"})
+		case errors.Is(err, errRefreshTokenReused):
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Refresh token was already used. All sessions have been signed out"})
+		}
+		log.Printf("Error refreshing token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not refresh token"})
+	}
+
+	body := pair.json()
+	body["message"] = "Token refreshed successfully"
+	return c.Status(fiber.StatusOK).JSON(body)
+}
+
+type SignOutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	// All signs out every session of the user, not just this one.
+	All bool `json:"all"`
+}
+
+// SignOut revokes a refresh token, or with "all" every session of its user.
+// Only a refresh token still in use can sign out every session, so an old
+// one turning up in a log cannot. Access tokens from a single-session
+// sign-out stay valid until they expire, which ACCESS_TOKEN_TTL keeps
+// short.
+func (h *Handler) SignOut(c *fiber.Ctx) error {
+	var req SignOutRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "refresh_token is required"})
+	}
+
+	err := h.store.Transaction(func(tx repository.Store) error {
+		token, err := tx.RefreshTokens().LockByHash(hashToken(req.RefreshToken))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return errRefreshTokenInvalid
+			}
+			return err
+		}
+		now := time.Now()
+		if token.RevokedAt != nil || now.After(token.ExpiresAt) {
+			if req.All {
+				return errRefreshTokenInvalid
+			}
+			return nil
+		}
+		if req.All {
+			return revokeSessions(tx, token.UserID, now)
+		}
+		token.RevokedAt = &now
+		return tx.RefreshTokens().Save(token)
+	})
+	if err != nil {
+		if errors.Is(err, errRefreshTokenInvalid) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+		}
+		log.Printf("Error signing out: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not sign out"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Signed out successfully"})
+}
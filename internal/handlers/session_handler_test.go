@@ -0,0 +1,83 @@
+package handlers_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/models"
+)
+
+// session signs in the user with email and returns the access and refresh
+// tokens.
+func (s *testServer) session(email string) (string, string) {
+	s.t.Helper()
+	resp := s.mustDo("", "POST", "/api/signin", fiber.Map{"email": email, "password": testPassword}, fiber.StatusOK)
+	return resp["token"].(string), resp["refresh_token"].(string)
+}
+
+// refresh exchanges a refresh token for a new pair.
+func (s *testServer) refresh(refreshToken string) (string, string) {
+	s.t.Helper()
+	resp := s.mustDo("", "POST", "/api/token/refresh", fiber.Map{"refresh_token": refreshToken}, fiber.StatusOK)
+	return resp["token"].(string), resp["refresh_token"].(string)
+}
+
+func TestRefreshTokenReuseRevokesSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		user := s.newUser(models.RoleStudent)
+		access, first := s.session(user.Email)
+		otherAccess, otherRefresh := s.session(user.Email)
+		rotatedAccess, rotated := s.refresh(first)
+		s.mustDo(rotatedAccess, "GET", "/api/books", nil, fiber.StatusOK)
+
+		// Replaying the rotated token means it leaked: every session ends.
+		s.mustDo("", "POST", "/api/token/refresh", fiber.Map{"refresh_token": first}, fiber.StatusUnauthorized)
+		for _, token := range []string{access, otherAccess, rotatedAccess} {
+			s.mustDo(token, "GET", "/api/books", nil, fiber.StatusUnauthorized)
+		}
+		for _, token := range []string{rotated, otherRefresh} {
+			s.mustDo("", "POST", "/api/token/refresh", fiber.Map{"refresh_token": token}, fiber.StatusUnauthorized)
+		}
+		s.session(user.Email)
+	})
+}
+
+func TestRoleChangeAndBlockEndSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		studentID, student := s.user(models.RoleStudent)
+		generalID, general := s.user(models.RoleGeneral)
+		s.mustDo(student, "GET", "/api/books", nil, fiber.StatusOK)
+		s.mustDo(general, "GET", "/api/books", nil, fiber.StatusOK)
+
+		s.mustDo(librarian, "PATCH", fmt.Sprintf("/api/users/%d/role", studentID), fiber.Map{"role": models.RoleGeneral, "reason": "graduated"}, fiber.StatusOK)
+		s.mustDo(student, "GET", "/api/books", nil, fiber.StatusUnauthorized)
+
+		s.mustDo(librarian, "POST", fmt.Sprintf("/api/users/%d/block", generalID), fiber.Map{"reason": "lost books"}, fiber.StatusOK)
+		s.mustDo(general, "GET", "/api/books", nil, fiber.StatusUnauthorized)
+		s.mustDo(librarian, "GET", "/api/books", nil, fiber.StatusOK)
+	})
+}
+
+func TestSignOut(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		user := s.newUser(models.RoleStudent)
+		_, first := s.session(user.Email)
+		access, second := s.session(user.Email)
+
+		s.mustDo("", "POST", "/api/signout", fiber.Map{"refresh_token": first}, fiber.StatusOK)
+		s.mustDo("", "POST", "/api/token/refresh", fiber.Map{"refresh_token": first}, fiber.StatusUnauthorized)
+		s.mustDo("", "POST", "/api/signout", fiber.Map{"refresh_token": first}, fiber.StatusOK)
+
+		// A token already revoked cannot end the other sessions.
+		s.mustDo("", "POST", "/api/signout", fiber.Map{"refresh_token": first, "all": true}, fiber.StatusUnauthorized)
+		s.mustDo(access, "GET", "/api/books", nil, fiber.StatusOK)
+
+		s.mustDo("", "POST", "/api/signout", fiber.Map{"refresh_token": second, "all": true}, fiber.StatusOK)
+		s.mustDo(access, "GET", "/api/books", nil, fiber.StatusUnauthorized)
+		s.mustDo("", "POST", "/api/token/refresh", fiber.Map{"refresh_token": second}, fiber.StatusUnauthorized)
+		s.mustDo("", "POST", "/api/signout", fiber.Map{"refresh_token": "not-a-token"}, fiber.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+)
+
+const (
+	// keyRingRefresh is how long the key ring is used before the signing
+	// keys are read again, which is how keys rotated by another server
+	// are picked up.
+	keyRingRefresh = time.Minute
+	// keyRingMissRefresh is how soon a token naming an unknown key may
+	// have the keys read again. Anyone can send such a token, so this
+	// stops them from costing a query each.
+	keyRingMissRefresh = 5 * time.Second
+	// rsaKeyBits is the size of new RS256 keys.
+	rsaKeyBits = 2048
+	// signingKeyPurpose labels the cipher private keys are stored under.
+	signingKeyPurpose = "signing-key"
+)
+
+var (
+	errNoSigningKey      = errors.New("no signing key is active")
+	errUnknownSigningKey = errors.New("token is signed with an unknown key")
+)
+
+// signingKey is a stored signing key with its key pair decoded. private
+// is nil if it no longer opens with any key-encryption key; the key then
+// only verifies tokens.
+type signingKey struct {
+	models.SigningKey
+	method  jwt.SigningMethod
+	public  crypto.PublicKey
+	private crypto.PrivateKey
+}
+
+// usable reports whether the key may still verify tokens at now.
+func (k *signingKey) usable(now time.Time) bool {
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// keyRing caches the signing keys, which are needed on every request but
+// change only when they rotate.
+type keyRing struct {
+	mu       sync.Mutex
+	keys     []*signingKey // oldest first
+	loadedAt time.Time
+}
+
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case models.KeyAlgEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	case models.KeyAlgRS256:
+		return jwt.SigningMethodRS256, nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+}
+
+// newSigningKey generates a key pair for alg that signs from activatesAt.
+func newSigningKey(alg string, activatesAt time.Time) (*models.SigningKey, error) {
+	var public, private any
+	switch alg {
+	case models.KeyAlgEdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		public, private = pub, priv
+	case models.KeyAlgRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		public, private = &priv.PublicKey, priv
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealSecret(signingKeyPurpose, privateDER)
+	if err != nil {
+		return nil, err
+	}
+	kid := make([]byte, 12)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	}
+	return &models.SigningKey{
+		KID:         base64.RawURLEncoding.EncodeToString(kid),
+		Algorithm:   alg,
+		PublicKey:   base64.StdEncoding.EncodeToString(publicDER),
+		PrivateKey:  sealed,
+		ActivatesAt: activatesAt,
+	}, nil
+}
+
+// decodeSigningKey decodes and decrypts the key pair of a stored key. A
+// private key that cannot be decrypted is logged and left out, since the
+// public key still verifies the tokens it signed.
+func decodeSigningKey(stored models.SigningKey) (*signingKey, error) {
+	method, err := signingMethod(stored.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := base64.StdEncoding.DecodeString(stored.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.ParsePKIXPublicKey(publicDER)
+	if err != nil {
+		return nil, err
+	}
+	key := &signingKey{SigningKey: stored, method: method, public: public}
+	privateDER, _, err := openSecret(signingKeyPurpose, stored.PrivateKey)
+	if err != nil {
+		log.Printf("Signing key %s can only verify tokens: %v", stored.KID, err)
+		return key, nil
+	}
+	if key.private, err = x509.ParsePKCS8PrivateKey(privateDER); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// signingKeys returns the signing keys, reading them from store again if
+// the key ring was loaded more than maxAge ago.
+func (h *Handler) signingKeys(store repository.Store, now time.Time, maxAge time.Duration) ([]*signingKey, error) {
+	h.keys.mu.Lock()
+	defer h.keys.mu.Unlock()
+	if !h.keys.loadedAt.IsZero() && time.Since(h.keys.loadedAt) < maxAge {
+		return h.keys.keys, nil
+	}
+
+	stored, err := store.SigningKeys().List(now)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*signingKey, 0, len(stored))
+	for _, s := range stored {
+		// One broken key must not take the others down with it.
+		key, err := decodeSigningKey(s)
+		if err != nil {
+			log.Printf("Skipping signing key %s: %v", s.KID, err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	h.keys.keys = keys
+	h.keys.loadedAt = time.Now()
+	return keys, nil
+}
+
+// forgetSigningKeys makes the next use of the key ring read the keys
+// again.
+func (h *Handler) forgetSigningKeys() {
+	h.keys.mu.Lock()
+	h.keys.loadedAt = time.Time{}
+	h.keys.mu.Unlock()
+}
+
+// currentSigningKey returns the key access tokens are signed with at now:
+// the newest one that has activated and whose private key can be read.
+func (h *Handler) currentSigningKey(tx repository.Store, now time.Time) (*signingKey, error) {
+	keys, err := h.signingKeys(tx, now, keyRingRefresh)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		if !keys[i].ActivatesAt.After(now) && keys[i].usable(now) && keys[i].private != nil {
+			return keys[i], nil
+		}
+	}
+	return nil, errNoSigningKey
+}
+
+// signAccessToken signs claims with the current key, which it names in
+// the kid header.
+func (h *Handler) signAccessToken(tx repository.Store, claims *Claims, now time.Time) (string, error) {
+	key, err := h.currentSigningKey(tx, now)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.private)
+}
+
+// AccessTokenKey returns the key that verifies token, found by its kid
+// header. A token is only accepted with the algorithm of its key, so a
+// public key can never be passed off as an HMAC secret. It is the
+// jwt.Keyfunc that middleware.Authenticate parses tokens with.
+func (h *Handler) AccessTokenKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no key ID")
+	}
+	now := time.Now()
+	key, err := h.findSigningKey(kid, now, keyRingRefresh)
+	if errors.Is(err, errUnknownSigningKey) {
+		// The key may have been created by another server since the
+		// key ring was loaded.
+		key, err = h.findSigningKey(kid, now, keyRingMissRefresh)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("token is signed with %s but its key is for %s", token.Method.Alg(), key.Algorithm)
+	}
+	return key.public, nil
+}
+
+func (h *Handler) findSigningKey(kid string, now time.Time, maxAge time.Duration) (*signingKey, error) {
+	keys, err := h.signingKeys(h.store, now, maxAge)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.KID == kid && key.usable(now) {
+			return key, nil
+		}
+	}
+	return nil, errUnknownSigningKey
+}
+
+// RotateSigningKeys creates the next signing key once the current one has
+// signed for nearly KeyRotation. The new key is published KeyPublishAhead
+// before it activates, and the keys before it expire once every token they
+// may have signed has. With no key that can sign, one that is active at
+// once is created. Keys sealed with an old key-encryption key are sealed
+// again with the current one. It returns the key created, if any.
+func (h *Handler) RotateSigningKeys(now time.Time) (*models.SigningKey, error) {
+	return h.rotateSigningKeys(now, false, false)
+}
+
+// rotateSigningKeys creates a signing key, which activates at once if
+// immediate is set. retire expires the older keys at once, which ends
+// every session's access token and sends clients to refresh.
+func (h *Handler) rotateSigningKeys(now time.Time, immediate, retire bool) (*models.SigningKey, error) {
+	policy := h.cfg.Tokens
+	var created *models.SigningKey
+	err := h.store.Transaction(func(tx repository.Store) error {
+		if err := tx.SigningKeys().DeleteExpired(now); err != nil {
+			return err
+		}
+		keys, err := tx.SigningKeys().LockAll(now)
+		if err != nil {
+			return err
+		}
+		canSign, err := resealSigningKeys(tx, keys, now)
+		if err != nil {
+			return err
+		}
+
+		activatesAt := now
+		if canSign && !immediate {
+			latest := keys[len(keys)-1]
+			due := latest.ActivatesAt.Add(policy.KeyRotation)
+			if now.Before(due.Add(-policy.KeyPublishAhead)) {
+				return nil
+			}
+			activatesAt = maxTime(due, now.Add(policy.KeyPublishAhead))
+		}
+
+		key, err := newSigningKey(policy.Algorithm, activatesAt)
+		if err != nil {
+			return err
+		}
+		// An older key signs until the new one activates, and other
+		// servers may keep signing with it until their key ring is next
+		// read; its tokens must verify for as long as they last.
+		expiresAt := activatesAt.Add(policy.AccessTTL + keyRingRefresh)
+		if retire {
+			expiresAt = now
+		}
+		for i := range keys {
+			if keys[i].ExpiresAt != nil && !keys[i].ExpiresAt.After(expiresAt) {
+				continue
+			}
+			keys[i].ExpiresAt = &expiresAt
+			if err := tx.SigningKeys().Save(&keys[i]); err != nil {
+				return err
+			}
+		}
+		created = key
+		return tx.SigningKeys().Create(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if created != nil {
+		h.forgetSigningKeys()
+	}
+	return created, nil
+}
+
+// resealSigningKeys seals again with the current key-encryption key the
+// private keys sealed with an old one. It reports whether any key that has
+// activated at now can still sign, which it cannot if its private key
+// opens with no key-encryption key.
+func resealSigningKeys(tx repository.Store, keys []models.SigningKey, now time.Time) (bool, error) {
+	canSign := false
+	for i := range keys {
+		sealed, err := resealSecret(signingKeyPurpose, keys[i].PrivateKey)
+		if errors.Is(err, errSecretUnreadable) {
+			log.Printf("Signing key %s can only verify tokens: %v", keys[i].KID, err)
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		if !keys[i].ActivatesAt.After(now) {
+			canSign = true
+		}
+		if sealed != "" {
+			keys[i].PrivateKey = sealed
+			if err := tx.SigningKeys().Save(&keys[i]); err != nil {
+				return false, err
+			}
+		}
+	}
+	return canSign, nil
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// jwk returns the public half of key as a JSON Web Key (RFC 7517).
+func (k *signingKey) jwk() (fiber.Map, error) {
+	jwk := fiber.Map{"kid": k.KID, "use": "sig", "alg": k.Algorithm}
+	switch pub := k.public.(type) {
+	case ed25519.PublicKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = "Ed25519"
+		jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", k.public)
+	}
+	return jwk, nil
+}
+
+// JWKS publishes the public keys access tokens are verified with, including
+// the next key before it activates, so that other services can verify
+// tokens without sharing a secret.
+func (h *Handler) JWKS(c *fiber.Ctx) error {
+	now := time.Now()
+	keys, err := h.signingKeys(h.store, now, keyRingRefresh)
+	if err != nil {
+		log.Printf("Error loading signing keys: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve signing keys"})
+	}
+	set := make([]fiber.Map, 0, len(keys))
+	for _, key := range keys {
+		if !key.usable(now) {
+			continue
+		}
+		jwk, err := key.jwk()
+		if err != nil {
+			log.Printf("Error encoding signing key %s: %v", key.KID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve signing keys"})
+		}
+		set = append(set, jwk)
+	}
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"keys": set})
+}
+
+// ListSigningKeys lists the signing keys that have not expired, oldest
+// first.
+func (h *Handler) ListSigningKeys(c *fiber.Ctx) error {
+	keys, err := h.store.SigningKeys().List(time.Now())
+	if err != nil {
+		log.Printf("Database error listing signing keys: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve signing keys"})
+	}
+	if keys == nil {
+		keys = []models.SigningKey{}
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":      "Signing keys retrieved successfully",
+		"signing_keys": keys,
+	})
+}
+
+type RotateSigningKeyRequest struct {
+	// RetirePrevious expires the older keys at once, for when one may have
+	// leaked. Access tokens signed with them stop working and clients
+	// must refresh.
+	RetirePrevious bool `json:"retire_previous"`
+}
+
+// RotateSigningKey creates a signing key that signs from now on, ahead of
+// the schedule.
+func (h *Handler) RotateSigningKey(c *fiber.Ctx) error {
+	var req RotateSigningKeyRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+		}
+	}
+
+	key, err := h.rotateSigningKeys(time.Now(), true, req.RetirePrevious)
+	if err != nil {
+		log.Printf("Error rotating signing keys: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not rotate signing keys"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":     "Signing key rotated successfully",
+		"signing_key": key,
+	})
+}
@@ -0,0 +1,64 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/db"
+	"library-management/internal/models"
+)
+
+// signIn signs in a user without two-factor authentication.
+func (s *testServer) signIn(email string) {
+	s.t.Helper()
+	s.mustDo("", "POST", "/api/signin", fiber.Map{"email": email, "password": testPassword}, fiber.StatusOK)
+}
+
+// signInTOTP signs in a user with two-factor authentication, using the code
+// offset steps from now.
+func (s *testServer) signInTOTP(email, secret string, offset int64) {
+	s.t.Helper()
+	challenge := s.mustDo("", "POST", "/api/signin", fiber.Map{"email": email, "password": testPassword}, fiber.StatusOK)["challenge"].(string)
+	s.mustDo("", "POST", "/api/signin/2fa", fiber.Map{"challenge": challenge, "code": totpCode(s.t, secret, offset)}, fiber.StatusOK)
+}
+
+func TestRotateKeyEncryptionKey(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, student := s.user(models.RoleStudent)
+		_, librarian := s.user(models.RoleLibrarian)
+		secret, _ := s.enrolTOTP(librarian)
+
+		// The new key seals; the old one still opens what it sealed, and
+		// start-up seals it all again with the new key.
+		db.KeyEncryptionKeys = []string{"new-key", "test-key"}
+		s = s.restart()
+		if n, err := s.h.ResealTwoFactorSecrets(); err != nil || n != 1 {
+			t.Fatalf("resealed %d two-factor secrets (%v), want 1", n, err)
+		}
+		s.mustDo(student, "GET", "/api/books", nil, fiber.StatusOK)
+
+		db.KeyEncryptionKeys = []string{"new-key"}
+		s = s.restart()
+		s.mustDo(student, "GET", "/api/books", nil, fiber.StatusOK)
+		s.signIn("user1@example.com")
+		s.signInTOTP("user2@example.com", secret, 1)
+		keys := s.mustDo(librarian, "GET", "/api/signing-keys", nil, fiber.StatusOK)["signing_keys"].([]any)
+		if len(keys) != 1 {
+			t.Errorf("got %d signing keys, want the original one resealed", len(keys))
+		}
+	})
+}
+
+func TestLostKeyEncryptionKey(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, student := s.user(models.RoleStudent)
+
+		// Without the key that sealed it, the signing key can still verify
+		// the tokens it signed, and a new one takes over signing.
+		db.KeyEncryptionKeys = []string{"other-key"}
+		s = s.restart()
+		s.mustDo(student, "GET", "/api/books", nil, fiber.StatusOK)
+		s.signIn("user1@example.com")
+	})
+}
@@ -0,0 +1,559 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+
+	"library-management/internal/models"
+	"library-management/internal/repository"
+	"library-management/internal/totp"
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes handed out at a
+	// time.
+	recoveryCodeCount = 10
+	// totpSkew is the number of 30-second steps a code may be early or
+	// late by.
+	totpSkew = 1
+)
+
+var (
+	errTwoFactorCode       = errors.New("two-factor code is wrong or already used")
+	errTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	errTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	errTwoFactorNotStarted = errors.New("two-factor setup has not been started")
+	errTwoFactorRequired   = errors.New("two-factor authentication is required for this role")
+	errWrongPassword       = errors.New("password is incorrect")
+)
+
+// twoFactorRequired reports whether user's role must use two-factor
+// authentication.
+func (h *Handler) twoFactorRequired(user *models.User) bool {
+	return h.cfg.TwoFactor.RequiredForLibrarians && user.Role == models.RoleLibrarian
+}
+
+// needsTwoFactorSetup reports whether user must set up two-factor
+// authentication before they may have a session.
+func (h *Handler) needsTwoFactorSetup(user *models.User) bool {
+	return h.twoFactorRequired(user) && !user.TOTPEnabled
+}
+
+// totpSecretPurpose labels the cipher TOTP secrets are stored under.
+const totpSecretPurpose = "totp-secret"
+
+func sealTOTPSecret(secret string) (string, error) {
+	return sealSecret(totpSecretPurpose, []byte(secret))
+}
+
+// ResealTwoFactorSecrets seals again with the current key-encryption key
+// the TOTP secrets sealed with an old one, so that the old key can be
+// dropped. Secrets that open with no key are logged and left alone. It
+// returns how many were sealed again.
+func (h *Handler) ResealTwoFactorSecrets() (int, error) {
+	ids, err := h.store.Users().ListWithTOTPSecret()
+	if err != nil {
+		return 0, err
+	}
+	resealed := 0
+	for _, id := range ids {
+		err := h.store.Transaction(func(tx repository.Store) error {
+			user, err := tx.Users().Lock(id)
+			if err != nil {
+				return err
+			}
+			sealed, err := resealSecret(totpSecretPurpose, user.TOTPSecret)
+			if err != nil || sealed == "" {
+				return err
+			}
+			user.TOTPSecret = sealed
+			resealed++
+			return tx.Users().SaveTwoFactor(user)
+		})
+		if errors.Is(err, errSecretUnreadable) {
+			log.Printf("TOTP secret of user %d does not open with any key-encryption key", id)
+		} else if err != nil {
+			return resealed, err
+		}
+	}
+	return resealed, nil
+}
+
+// startTOTPSetup gives user a new secret, which takes effect once a code
+// from it is confirmed by enableTOTP. It returns what the user's
+// authenticator app needs.
+func (h *Handler) startTOTPSetup(tx repository.Store, user *models.User) (fiber.Map, error) {
+	if user.TOTPEnabled {
+		return nil, errTwoFactorEnabled
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPSecret, err = sealTOTPSecret(secret); err != nil {
+		return nil, err
+	}
+	user.TOTPLastStep = 0
+	if err := tx.Users().SaveTwoFactor(user); err != nil {
+		return nil, err
+	}
+	return fiber.Map{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(h.cfg.TwoFactor.Issuer, user.Email, secret),
+	}, nil
+}
+
+// checkTOTP checks a code from user's authenticator app and records its
+// time step, so that the code cannot be used again.
+func checkTOTP(tx repository.Store, user *models.User, code string, now time.Time) error {
+	if user.TOTPSecret == "" {
+		return errTwoFactorNotStarted
+	}
+	secret, current, err := openSecret(totpSecretPurpose, user.TOTPSecret)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Validate(string(secret), code, now, totpSkew)
+	if !ok || step <= user.TOTPLastStep {
+		return errTwoFactorCode
+	}
+	user.TOTPLastStep = step
+	if !current {
+		if user.TOTPSecret, err = sealTOTPSecret(string(secret)); err != nil {
+			return err
+		}
+	}
+	return tx.Users().SaveTwoFactor(user)
+}
+
+// normaliseRecoveryCode lets recovery codes be typed with or without
+// dashes and in either case.
+func normaliseRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// newRecoveryCodes replaces the user's recovery codes and returns the new
+// ones, which are not stored anywhere in readable form.
+func newRecoveryCodes(tx repository.Store, userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 10)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		codes[i] = raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16]
+		hashes[i] = hashToken(raw)
+	}
+	if err := tx.RecoveryCodes().Replace(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifySecondFactor accepts a code from user's authenticator app or, if
+// code is empty, one of their unused recovery codes.
+func verifySecondFactor(tx repository.Store, user *models.User, code, recoveryCode string, now time.Time) error {
+	if !user.TOTPEnabled {
+		return errTwoFactorNotEnabled
+	}
+	if code != "" {
+		return checkTOTP(tx, user, code, now)
+	}
+	used, err := tx.RecoveryCodes().Use(user.ID, hashToken(normaliseRecoveryCode(recoveryCode)), now)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errTwoFactorCode
+	}
+	return nil
+}
+
+// enableTOTP finishes setup once the user shows a first code from their
+// authenticator, and returns their recovery codes.
+func enableTOTP(tx repository.Store, user *models.User, code string, now time.Time) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, errTwoFactorEnabled
+	}
+	if err := checkTOTP(tx, user, code, now); err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled = true
+	if err := tx.Users().SaveTwoFactor(user); err != nil {
+		return nil, err
+	}
+	return newRecoveryCodes(tx, user.ID)
+}
+
+// twoFactorError answers the errors of the two-factor handlers that are
+// the caller's fault, and logs and hides the rest.
+func twoFactorError(c *fiber.Ctx, err error, action string) error {
+	switch {
+	case errors.Is(err, errUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	case errors.Is(err, errWrongPassword):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Password is incorrect"})
+	case errors.Is(err, errTwoFactorCode):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or already used code"})
+	case errors.Is(err, errTwoFactorEnabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is already enabled"})
+	case errors.Is(err, errTwoFactorNotEnabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is not enabled"})
+	case errors.Is(err, errTwoFactorNotStarted):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Start two-factor setup first"})
+	case errors.Is(err, errTwoFactorRequired):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is required for your role"})
+	case errors.Is(err, errUserTokenInvalid):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid sign-in challenge. Please sign in again"})
+	case errors.Is(err, errUserTokenExpired):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Sign-in challenge expired. Please sign in again"})
+	}
+	log.Printf("Error %s: %v", action, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not complete two-factor request"})
+}
+
+// lockSignedInUser locks the signed-in user in tx, checking their password
+// first if one is given.
+func lockSignedInUser(c *fiber.Ctx, tx repository.Store, password *string) (*models.User, error) {
+	userID, _ := c.Locals("userID").(uint)
+	user, err := tx.Users().Lock(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errUserNotFound
+		}
+		return nil, err
+	}
+	if password != nil && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(*password)) != nil {
+		return nil, errWrongPassword
+	}
+	return user, nil
+}
+
+// GetTwoFactor reports whether the signed-in user has two-factor
+// authentication and how many recovery codes they have left.
+func (h *Handler) GetTwoFactor(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(uint)
+	user, err := h.store.Users().FindByID(userID)
+	if err != nil {
+		return twoFactorError(c, err, "reading two-factor status")
+	}
+	left, err := h.store.RecoveryCodes().CountUnused(user.ID)
+	if err != nil {
+		return twoFactorError(c, err, "counting recovery codes")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":             "Two-factor status retrieved successfully",
+		"enabled":             user.TOTPEnabled,
+		"required":            h.twoFactorRequired(user),
+		"recovery_codes_left": left,
+	})
+}
+
+type TwoFactorSetupRequest struct {
+	Password string `json:"password"`
+}
+
+// SetupTwoFactor starts two-factor setup for the signed-in user. It
+// returns the secret and an otpauth:// URI to show as a QR code; setup is
+// finished by EnableTwoFactor.
+func (h *Handler) SetupTwoFactor(c *fiber.Ctx) error {
+	var req TwoFactorSetupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Password is required"})
+	}
+
+	var body fiber.Map
+	err := h.store.Transaction(func(tx repository.Store) error {
+		user, err := lockSignedInUser(c, tx, &req.Password)
+		if err != nil {
+			return err
+		}
+		body, err = h.startTOTPSetup(tx, user)
+		return err
+	})
+	if err != nil {
+		return twoFactorError(c, err, "starting two-factor setup")
+	}
+
+	body["message"] = "Add the secret to your authenticator app, then confirm with a code"
+	return c.Status(fiber.StatusOK).JSON(body)
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// EnableTwoFactor finishes setup with a first code from the authenticator
+// app and returns the user's recovery codes, which are shown only once.
+func (h *Handler) EnableTwoFactor(c *fiber.Ctx) error {
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Code is required"})
+	}
+
+	var codes []string
+	err := h.store.Transaction(func(tx repository.Store) error {
+		user, err := lockSignedInUser(c, tx, nil)
+		if err != nil {
+			return err
+		}
+		codes, err = enableTOTP(tx, user, req.Code, time.Now())
+		return err
+	})
+	if err != nil {
+		return twoFactorError(c, err, "enabling two-factor authentication")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":        "Two-factor authentication enabled. Keep the recovery codes somewhere safe",
+		"recovery_codes": codes,
+	})
+}
+
+type TwoFactorDisableRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// DisableTwoFactor turns two-factor authentication off for the signed-in
+// user, unless their role requires it.
+func (h *Handler) DisableTwoFactor(c *fiber.Ctx) error {
+	var req TwoFactorDisableRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Password == "" || (req.Code == "" && req.RecoveryCode == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Password and a code or recovery code are required"})
+	}
+
+	err := h.store.Transaction(func(tx repository.Store) error {
+		user, err := lockSignedInUser(c, tx, &req.Password)
+		if err != nil {
+			return err
+		}
+		if h.twoFactorRequired(user) {
+			return errTwoFactorRequired
+		}
+		if err := verifySecondFactor(tx, user, req.Code, req.RecoveryCode, time.Now()); err != nil {
+			return err
+		}
+		user.TOTPSecret = ""
+		user.TOTPEnabled = false
+		user.TOTPLastStep = 0
+		if err := tx.Users().SaveTwoFactor(user); err != nil {
+			return err
+		}
+		return tx.RecoveryCodes().Replace(user.ID, nil)
+	})
+	if err != nil {
+		return twoFactorError(c, err, "disabling two-factor authentication")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the signed-in user's recovery codes,
+// given a code from their authenticator app.
+func (h *Handler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Code is required"})
+	}
+
+	var codes []string
+	err := h.store.Transaction(func(tx repository.Store) error {
+		user, err := lockSignedInUser(c, tx, nil)
+		if err != nil {
+			return err
+		}
+		if err := verifySecondFactor(tx, user, req.Code, "", time.Now()); err != nil {
+			return err
+		}
+		codes, err = newRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return twoFactorError(c, err, "regenerating recovery codes")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":        "New recovery codes issued. The old ones no longer work",
+		"recovery_codes": codes,
+	})
+}
+
+type TwoFactorChallengeRequest struct {
+	Challenge string `json:"challenge"`
+}
+
+// SetupTwoFactorAtSignIn starts two-factor setup for a user whose role
+// requires it, with the challenge SignIn gave them instead of a session.
+func (h *Handler) SetupTwoFactorAtSignIn(c *fiber.Ctx) error {
+	var req TwoFactorChallengeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Challenge == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Challenge is required"})
+	}
+
+	var body fiber.Map
+	err := h.store.Transaction(func(tx repository.Store) error {
+		challenge, err := checkUserToken(tx, req.Challenge, models.TokenTwoFactor, time.Now())
+		if err != nil {
+			return err
+		}
+		user, err := tx.Users().Lock(challenge.UserID)
+		if err != nil {
+			return err
+		}
+		body, err = h.startTOTPSetup(tx, user)
+		return err
+	})
+	if err != nil {
+		return twoFactorError(c, err, "starting two-factor setup at sign-in")
+	}
+
+	body["message"] = "Add the secret to your authenticator app, then finish signing in with a code"
+	return c.Status(fiber.StatusOK).JSON(body)
+}
+
+type TwoFactorSignInRequest struct {
+	Challenge    string `json:"challenge"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// SignInTwoFactor is the second sign-in step: it takes the challenge from
+// SignIn and a code from the authenticator app, or a recovery code, and
+// only then issues the token pair. A user finishing required setup gets
+// their recovery codes here too. Wrong codes count as failed sign-ins.
+func (h *Handler) SignInTwoFactor(c *fiber.Ctx) error {
+	var req TwoFactorSignInRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Challenge == "" || (req.Code == "" && req.RecoveryCode == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Challenge and a code or recovery code are required"})
+	}
+
+	attempt := &models.LoginAttempt{
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+	var user *models.User
+	var pair *tokenPair
+	var recoveryCodes []string
+	var wait time.Duration
+	err := h.store.Transaction(func(tx repository.Store) error {
+		now := time.Now()
+		challenge, err := checkUserToken(tx, req.Challenge, models.TokenTwoFactor, now)
+		if err != nil {
+			return err
+		}
+		if user, err = tx.Users().FindByID(challenge.UserID); err != nil {
+			return err
+		}
+		attempt.Email = user.Email
+		attempt.UserID = &user.ID
+		account, err := tx.LoginThrottles().Lock(models.ThrottleAccount, user.Email)
+		if err != nil {
+			return err
+		}
+		ip, err := tx.LoginThrottles().Lock(models.ThrottleIP, attempt.IP)
+		if err != nil {
+			return err
+		}
+		// Read the user again now that the throttles are held, so that of
+		// two concurrent uses of one code the second finds it used.
+		if user, err = tx.Users().FindByID(challenge.UserID); err != nil {
+			return err
+		}
+
+		// As in SignIn, failed attempts return nil so their counts commit.
+		if wait = max(retryAfter(account, now), retryAfter(ip, now)); wait > 0 {
+			attempt.Outcome = models.LoginThrottled
+			return tx.LoginAttempts().Create(attempt)
+		}
+		if user.BlockedManually {
+			attempt.Outcome = models.LoginBlocked
+			return tx.LoginAttempts().Create(attempt)
+		}
+
+		if user.TOTPEnabled {
+			err = verifySecondFactor(tx, user, req.Code, req.RecoveryCode, now)
+		} else if req.Code != "" {
+			recoveryCodes, err = enableTOTP(tx, user, req.Code, now)
+		} else {
+			err = errTwoFactorCode
+		}
+		if errors.Is(err, errTwoFactorCode) {
+			attempt.Outcome = models.LoginBadSecondFactor
+			if err := h.recordLoginFailure(tx, account, ip, user, now); err != nil {
+				return err
+			}
+			return tx.LoginAttempts().Create(attempt)
+		} else if err != nil {
+			return err
+		}
+
+		challenge.UsedAt = &now
+		if err := tx.UserTokens().Save(challenge); err != nil {
+			return err
+		}
+		attempt.Success = true
+		attempt.Outcome = models.LoginSucceeded
+		if err := clearLoginFailures(tx, user.Email); err != nil {
+			return err
+		}
+		if err := tx.LoginAttempts().Create(attempt); err != nil {
+			return err
+		}
+		pair, _, err = h.issueTokens(tx, user, now)
+		return err
+	})
+	if err != nil {
+		return twoFactorError(c, err, "signing in with two-factor authentication")
+	}
+
+	switch attempt.Outcome {
+	case models.LoginThrottled:
+		return tooManySignIns(c, wait)
+	case models.LoginBlocked:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Your account is blocked. Please contact the librarian."})
+	case models.LoginBadSecondFactor:
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or already used code"})
+	}
+
+	body := pair.json()
+	body["message"] = "Login successful"
+	body["user_id"] = user.ID
+	body["user_name"] = user.Name
+	body["user_email"] = user.Email
+	body["user_role"] = user.Role
+	if recoveryCodes != nil {
+		body["recovery_codes"] = recoveryCodes
+	}
+	return c.Status(fiber.StatusOK).JSON(body)
+}
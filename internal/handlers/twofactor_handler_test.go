@@ -0,0 +1,120 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"library-management/internal/handlers"
+	"library-management/internal/models"
+)
+
+// noBackoff lets a test follow a failed sign-in with another at once.
+func noBackoff() handlers.Config {
+	cfg := handlers.DefaultConfig()
+	cfg.Logins.Backoff = 0
+	cfg.Logins.MaxBackoff = 0
+	return cfg
+}
+
+// challenge signs in with the password of the user with email and returns
+// the two-factor challenge SignIn answers with.
+func (s *testServer) challenge(email string) map[string]any {
+	s.t.Helper()
+	resp := s.mustDo("", "POST", "/api/signin", fiber.Map{"email": email, "password": testPassword}, fiber.StatusOK)
+	if resp["two_factor_required"] != true || resp["token"] != nil {
+		s.t.Fatalf("signing in %s: got %v, want a two-factor challenge", email, resp)
+	}
+	return resp
+}
+
+func TestTwoFactorEnrolAndSignIn(t *testing.T) {
+	forEachStoreWith(t, noBackoff(), func(t *testing.T, s *testServer) {
+		user := s.newUser(models.RoleStudent)
+		_, token := s.user(models.RoleStudent)
+		s.mustDo(token, "POST", "/api/2fa/setup", fiber.Map{"password": "wrong"}, fiber.StatusForbidden)
+		s.mustDo(token, "POST", "/api/2fa/enable", fiber.Map{"code": "123456"}, fiber.StatusConflict)
+		secret, codes := s.enrolTOTP(token)
+		if len(codes) != 10 {
+			t.Errorf("got %d recovery codes, want 10", len(codes))
+		}
+		status := s.mustDo(token, "GET", "/api/2fa", nil, fiber.StatusOK)
+		if status["enabled"] != true || status["recovery_codes_left"] != 10.0 {
+			t.Errorf("got two-factor status %v, want enabled with 10 recovery codes", status)
+		}
+		s.mustDo(token, "POST", "/api/2fa/setup", fiber.Map{"password": testPassword}, fiber.StatusConflict)
+
+		// The user made by s.user is user2; user1 has no second factor.
+		s.signIn(user.Email)
+		challenge := s.challenge("user2@example.com")["challenge"]
+		s.mustDo("", "POST", "/api/signin/2fa", fiber.Map{"challenge": challenge, "code": "000000"}, fiber.StatusUnauthorized)
+		s.mustDo("", "POST", "/api/signin/2fa", fiber.Map{"challenge": "not-a-challenge", "code": totpCode(t, secret, 1)}, fiber.StatusUnauthorized)
+		code := totpCode(t, secret, 1)
+		resp := s.mustDo("", "POST", "/api/signin/2fa", fiber.Map{"challenge": challenge, "code": code}, fiber.StatusOK)
+		if resp["token"] == nil {
+			t.Errorf("got %v, want a session", resp)
+		}
+
+		// A challenge works once, and so does a code.
+		s.mustDo("", "POST", "/api/signin/2fa", fiber.Map{"challenge": challenge, "code": code}, fiber.StatusUnauthorized)
+		challenge = s.challenge("user2@example.com")["challenge"]
+		s.mustDo("", "POST", "/api/signin/2fa", fiber.Map{"challenge": challenge, "code": code}, fiber.StatusUnauthorized)
+	})
+}
+
+func TestRecoveryCodeWorksOnce(t *testing.T) {
+	forEachStoreWith(t, noBackoff(), func(t *testing.T, s *testServer) {
+		_, token := s.user(models.RoleStudent)
+		_, codes := s.enrolTOTP(token)
+		recovery := codes[0].(string)
+
+		challenge := s.challenge("user1@example.com")["challenge"]
+		s.mustDo("", "POST", "/api/signin/2fa", fiber.Map{"challenge": challenge, "recovery_code": recovery}, fiber.StatusOK)
+		challenge = s.challenge("user1@example.com")["challenge"]
+		s.mustDo("", "POST", "/api/signin/2fa", fiber.Map{"challenge": challenge, "recovery_code": recovery}, fiber.StatusUnauthorized)
+		s.mustDo("", "POST", "/api/signin/2fa", fiber.Map{"challenge": challenge, "recovery_code": codes[1]}, fiber.StatusOK)
+
+		status := s.mustDo(token, "GET", "/api/2fa", nil, fiber.StatusOK)
+		if status["recovery_codes_left"] != 8.0 {
+			t.Errorf("got %v recovery codes left, want 8", status["recovery_codes_left"])
+		}
+	})
+}
+
+func TestTwoFactorRequiredForLibrarians(t *testing.T) {
+	cfg := noBackoff()
+	cfg.TwoFactor.RequiredForLibrarians = true
+	forEachStoreWith(t, cfg, func(t *testing.T, s *testServer) {
+		librarian := s.newUser(models.RoleLibrarian)
+		_, student := s.user(models.RoleStudent)
+		s.mustDo(student, "GET", "/api/books", nil, fiber.StatusOK)
+
+		// Signing in gives the librarian no session until they have set
+		// up two-factor authentication.
+		resp := s.challenge(librarian.Email)
+		if resp["two_factor_setup_required"] != true {
+			t.Fatalf("got %v, want two-factor setup to be required", resp)
+		}
+		challenge := resp["challenge"]
+		s.mustDo("", "POST", "/api/signin/2fa", fiber.Map{"challenge": challenge, "code": "123456"}, fiber.StatusConflict)
+		secret := s.mustDo("", "POST", "/api/signin/2fa/setup", fiber.Map{"challenge": challenge}, fiber.StatusOK)["secret"].(string)
+		resp = s.mustDo("", "POST", "/api/signin/2fa", fiber.Map{"challenge": challenge, "code": totpCode(t, secret, 0)}, fiber.StatusOK)
+		if codes, _ := resp["recovery_codes"].([]any); len(codes) != 10 {
+			t.Errorf("got recovery codes %v, want 10 at the end of required setup", resp["recovery_codes"])
+		}
+		token := resp["token"].(string)
+		s.mustDo(token, "GET", "/api/books", nil, fiber.StatusOK)
+		s.mustDo(token, "POST", "/api/2fa/disable", fiber.Map{"password": testPassword, "code": totpCode(t, secret, 1)}, fiber.StatusConflict)
+	})
+}
+
+func TestTwoFactorRequirementEndsSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		_, librarian := s.user(models.RoleLibrarian)
+		s.mustDo(librarian, "GET", "/api/books", nil, fiber.StatusOK)
+
+		s.cfg.TwoFactor.RequiredForLibrarians = true
+		s = s.restart()
+		s.mustDo(librarian, "GET", "/api/books", nil, fiber.StatusUnauthorized)
+	})
+}
@@ -1,23 +1,23 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5" 
+	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 
-	"library-management/internal/db"
 	"library-management/internal/models"
+	"library-management/internal/repository"
 )
 
 type SignUpRequest struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
-	Role     string `json:"role"` 
+	Role     string `json:"role"`
 }
 
 type SignInRequest struct {
@@ -26,31 +26,35 @@ type SignInRequest struct {
 }
 
 type Claims struct {
-	UserID               uint   `json:"user_id"`
-	Email                string `json:"email"`
-	Role                 string `json:"role"`
-	jwt.RegisteredClaims        
+	UserID       uint   `json:"user_id"`
+	Email        string `json:"email"`
+	Role         string `json:"role"`
+	TokenVersion int    `json:"ver"`
+	jwt.RegisteredClaims
 }
 
-
-func SignUp(c *fiber.Ctx) error {
+func (h *Handler) SignUp(c *fiber.Ctx) error {
 	req := new(SignUpRequest)
 	if err := c.BodyParser(req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
 	}
 
-	if req.Name == "" || req.Email == "" || req.Password == "" || req.Role == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Name, Email, Password, and Role are required"})
+	if req.Name == "" || req.Email == "" || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Name, Email, and Password are required"})
 	}
 
-	if !models.IsValidRole(req.Role) {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid role. Must be 'librarian', 'student', or 'general'"})
+	// Librarians are only made by another librarian (or by cmd/bootstrap
+	// for the first one), never by registering.
+	if req.Role == "" {
+		req.Role = models.RoleGeneral
+	}
+	if !models.IsPatronRole(req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid role. Must be 'student' or 'general'"})
 	}
 
-	var existingUser models.User
-	if err := db.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
+	if _, err := h.store.Users().FindByEmail(req.Email); err == nil {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User with this email already exists"})
-	} else if err != gorm.ErrRecordNotFound {
+	} else if !errors.Is(err, repository.ErrNotFound) {
 		log.Printf("Database error checking for existing user: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
 	}
@@ -68,7 +72,21 @@ func SignUp(c *fiber.Ctx) error {
 		Role:     req.Role,
 	}
 
-	if err := db.DB.Create(&user).Error; err != nil {
+	err = h.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Users().Create(&user); err != nil {
+			return err
+		}
+		err := tx.RoleChanges().Create(&models.RoleChange{
+			UserID:  user.ID,
+			NewRole: user.Role,
+			Reason:  "Self-registration",
+		})
+		if err != nil {
+			return err
+		}
+		return h.queueTokenEmail(tx, models.EventSignup, user.ID, models.TokenVerifyEmail, h.cfg.Accounts.VerifyTTL)
+	})
+	if err != nil {
 		log.Printf("Error creating user: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not register user"})
 	}
@@ -81,10 +99,16 @@ func SignUp(c *fiber.Ctx) error {
 			"email": user.Email,
 			"role":  user.Role,
 		},
+		"email_verified": user.EmailVerified,
 	})
 }
 
-func SignIn(c *fiber.Ctx) error {
+// SignIn checks a user's password and issues a token pair, or for users
+// with two-factor authentication a challenge for SignInTwoFactor. Failed
+// attempts are counted per account and per client address, with a
+// growing wait between attempts and a lockout after too many; every
+// attempt is recorded for review.
+func (h *Handler) SignIn(c *fiber.Ctx) error {
 	req := new(SignInRequest)
 	if err := c.BodyParser(req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
@@ -94,47 +118,115 @@ func SignIn(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Email and password are required"})
 	}
 
-	var user models.User
-	if err := db.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
-		}
-		log.Printf("Database error finding user for login: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	attempt := &models.LoginAttempt{
+		Email:     req.Email,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
 	}
+	var user *models.User
+	var pair *tokenPair
+	var challenge string
+	var wait time.Duration
+	err := h.store.Transaction(func(tx repository.Store) error {
+		now := time.Now()
+		// Holding both throttles until the attempt is counted makes
+		// concurrent guesses take turns instead of all getting in before
+		// the first failure is recorded. The account is always locked
+		// first, so two sign-ins cannot deadlock.
+		account, err := tx.LoginThrottles().Lock(models.ThrottleAccount, attempt.Email)
+		if err != nil {
+			return err
+		}
+		ip, err := tx.LoginThrottles().Lock(models.ThrottleIP, attempt.IP)
+		if err != nil {
+			return err
+		}
 
-	if user.Blocked {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Your account is blocked. Please contact the librarian."})
-	}
+		// Failed attempts return nil so their counts commit.
+		if wait = max(retryAfter(account, now), retryAfter(ip, now)); wait > 0 {
+			attempt.Outcome = models.LoginThrottled
+			return tx.LoginAttempts().Create(attempt)
+		}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
-	}
+		user, err = tx.Users().FindByEmail(req.Email)
+		if errors.Is(err, repository.ErrNotFound) {
+			attempt.Outcome = models.LoginUnknownAccount
+			if err := h.recordLoginFailure(tx, account, ip, nil, now); err != nil {
+				return err
+			}
+			return tx.LoginAttempts().Create(attempt)
+		} else if err != nil {
+			return err
+		}
+		attempt.UserID = &user.ID
 
-	claims := &Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Role:   user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)), // Token expires in 24 hours
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
-	}
+		// Automatic blocks only stop borrowing, so the patron can still
+		// sign in and see what they owe.
+		if user.BlockedManually {
+			attempt.Outcome = models.LoginBlocked
+			return tx.LoginAttempts().Create(attempt)
+		}
+
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+			attempt.Outcome = models.LoginBadCredentials
+			if err := h.recordLoginFailure(tx, account, ip, user, now); err != nil {
+				return err
+			}
+			return tx.LoginAttempts().Create(attempt)
+		}
+
+		// The failure count is left alone until the second step succeeds,
+		// or a known password would buy unlimited guesses at the code.
+		if user.TOTPEnabled || h.twoFactorRequired(user) {
+			attempt.Outcome = models.LoginSecondFactor
+			if challenge, _, err = issueUserToken(tx, user.ID, models.TokenTwoFactor, h.cfg.TwoFactor.ChallengeTTL, now); err != nil {
+				return err
+			}
+			return tx.LoginAttempts().Create(attempt)
+		}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(db.JWTSecret)) // Use the secret from db package
+		attempt.Success = true
+		attempt.Outcome = models.LoginSucceeded
+		if err := clearLoginFailures(tx, user.Email); err != nil {
+			return err
+		}
+		if err := tx.LoginAttempts().Create(attempt); err != nil {
+			return err
+		}
+		pair, _, err = h.issueTokens(tx, user, now)
+		return err
+	})
 	if err != nil {
-		log.Printf("Error signing JWT token: %v", err)
+		log.Printf("Error signing in: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not login"})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message":    "Login successful",
-		"token":      tokenString, 
-		"user_id":    user.ID,
-		"user_name":  user.Name,
-		"user_email": user.Email,
-		"user_role":  user.Role,
-	})
+	switch attempt.Outcome {
+	case models.LoginThrottled:
+		return tooManySignIns(c, wait)
+	case models.LoginBlocked:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Your account is blocked. Please contact the librarian."})
+	case models.LoginUnknownAccount, models.LoginBadCredentials:
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+	case models.LoginSecondFactor:
+		message := "Enter the code from your authenticator app at /api/signin/2fa"
+		if !user.TOTPEnabled {
+			message = "Your role requires two-factor authentication. Set it up at /api/signin/2fa/setup"
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":                   message,
+			"two_factor_required":       true,
+			"two_factor_setup_required": !user.TOTPEnabled,
+			"challenge":                 challenge,
+			"expires_in":                int(h.cfg.TwoFactor.ChallengeTTL.Seconds()),
+		})
+	}
+
+	body := pair.json()
+	body["message"] = "Login successful"
+	body["user_id"] = user.ID
+	body["user_name"] = user.Name
+	body["user_email"] = user.Email
+	body["user_role"] = user.Role
+	return c.Status(fiber.StatusOK).JSON(body)
 }
@@ -2,16 +2,19 @@ package middleware
 
 import (
 	"errors" 
-	"fmt"
 	"strings"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 
-	"library-management/internal/db"
 	"library-management/internal/handlers" 
+	"library-management/internal/models"
 )
 
-func Authenticate() fiber.Handler {
+// Authenticate checks the bearer access token against the key that key
+// returns for it and stores its claims in the request locals. check is then
+// asked whether the session is still valid, which lets revoked sessions end
+// before their tokens expire.
+func Authenticate(key jwt.Keyfunc, check func(claims *handlers.Claims) error) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -26,12 +29,8 @@ func Authenticate() fiber.Handler {
 		tokenString := parts[1]
 
 		claims := &handlers.Claims{} 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(db.JWTSecret), nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, claims, key,
+			jwt.WithValidMethods([]string{models.KeyAlgEdDSA, models.KeyAlgRS256}))
 
 		if err != nil {
 			if errors.Is(err, jwt.ErrSignatureInvalid) {
@@ -50,6 +49,13 @@ func Authenticate() fiber.Handler {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
 		}
 
+		if err := check(claims); err != nil {
+			if errors.Is(err, handlers.ErrSessionRevoked) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Session has been revoked. Please sign in again"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not check session"})
+		}
+
 		c.Locals("userID", claims.UserID)
 		c.Locals("userEmail", claims.Email)
 		c.Locals("userRole", claims.Role)
@@ -73,3 +79,34 @@ func Authorize(requiredRoles ...string) fiber.Handler {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied. Insufficient permissions."})
 	}
 }
+
+// LoadPermissions looks up the permissions of the signed-in user's role with
+// resolve and stores them for RequirePermission and the handlers. It must
+// run after Authenticate. Permissions are read on every request, so changes
+// to the role_permissions table apply at once.
+func LoadPermissions(resolve func(role string) (models.PermissionSet, error)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("userRole").(string)
+		permissions, err := resolve(role)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not load permissions"})
+		}
+		c.Locals("permissions", permissions)
+		return c.Next()
+	}
+}
+
+// RequirePermission lets the request through if the user's role holds any
+// of the given permissions.
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		granted, ok := c.Locals("permissions").(models.PermissionSet)
+		if !ok {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "User permissions not found in context"})
+		}
+		if granted.Has(permissions...) {
+			return c.Next()
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied. Insufficient permissions."})
+	}
+}
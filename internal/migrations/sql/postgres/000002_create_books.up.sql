@@ -0,0 +1,17 @@
+-- Books added through POST /api/books store donated_by_id = 0, so the
+-- column deliberately has no foreign key to users.
+CREATE TABLE IF NOT EXISTS books (
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ,
+    deleted_at    TIMESTAMPTZ,
+    title         TEXT,
+    author        TEXT,
+    number        TEXT,
+    genre         TEXT,
+    donated_by_id BIGINT,
+    available     BOOLEAN DEFAULT true,
+    CONSTRAINT uni_books_number UNIQUE (number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_books_deleted_at ON books (deleted_at);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS borrows (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    book_id     BIGINT NOT NULL,
+    user_id     BIGINT NOT NULL,
+    borrow_date TIMESTAMPTZ,
+    return_date TIMESTAMPTZ,
+    due_date    TIMESTAMPTZ,
+    returned    BOOLEAN DEFAULT false,
+    fine_amount NUMERIC DEFAULT 0.0,
+    fine_paid   BOOLEAN DEFAULT false,
+    CONSTRAINT fk_borrows_book FOREIGN KEY (book_id) REFERENCES books (id),
+    CONSTRAINT fk_borrows_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_borrows_deleted_at ON borrows (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_borrows_user_returned ON borrows (user_id, returned);
@@ -0,0 +1,32 @@
+-- Copies become books again. Only the first author survives, and the
+-- extra title fields (ISBN, publisher, ...) are lost.
+CREATE TABLE books (
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ,
+    deleted_at    TIMESTAMPTZ,
+    title         TEXT,
+    author        TEXT,
+    number        TEXT,
+    genre         TEXT,
+    donated_by_id BIGINT,
+    available     BOOLEAN DEFAULT true,
+    CONSTRAINT uni_books_number UNIQUE (number)
+);
+
+CREATE INDEX idx_books_deleted_at ON books (deleted_at);
+
+INSERT INTO books (id, created_at, updated_at, deleted_at, title, author, number, genre, donated_by_id, available)
+SELECT c.id, c.created_at, c.updated_at, c.deleted_at, t.title, COALESCE(t.authors::json->>0, ''),
+       c.barcode, t.genre, c.donated_by_id, c.status = 'available'
+FROM copies c
+JOIN titles t ON t.id = c.title_id;
+
+SELECT setval(pg_get_serial_sequence('books', 'id'), COALESCE((SELECT MAX(id) FROM books), 0) + 1, false);
+
+ALTER TABLE borrows DROP CONSTRAINT IF EXISTS fk_borrows_copy;
+ALTER TABLE borrows RENAME COLUMN copy_id TO book_id;
+ALTER TABLE borrows ADD CONSTRAINT fk_borrows_book FOREIGN KEY (book_id) REFERENCES books (id);
+
+DROP TABLE copies;
+DROP TABLE titles;
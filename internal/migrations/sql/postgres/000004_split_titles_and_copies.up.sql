@@ -0,0 +1,68 @@
+CREATE TABLE titles (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    title      TEXT,
+    authors    TEXT,
+    isbn       TEXT,
+    publisher  TEXT,
+    year       BIGINT,
+    language   TEXT,
+    subjects   TEXT,
+    genre      TEXT
+);
+
+CREATE INDEX idx_titles_deleted_at ON titles (deleted_at);
+CREATE INDEX idx_titles_isbn ON titles (isbn);
+
+CREATE TABLE copies (
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ,
+    deleted_at    TIMESTAMPTZ,
+    title_id      BIGINT NOT NULL,
+    barcode       TEXT,
+    location      TEXT,
+    condition     TEXT DEFAULT 'good',
+    status        TEXT DEFAULT 'available',
+    donated_by_id BIGINT,
+    CONSTRAINT uni_copies_barcode UNIQUE (barcode),
+    CONSTRAINT fk_copies_title FOREIGN KEY (title_id) REFERENCES titles (id)
+);
+
+CREATE INDEX idx_copies_deleted_at ON copies (deleted_at);
+CREATE INDEX idx_copies_title_status ON copies (title_id, status);
+
+-- Every distinct (title, author, genre) becomes one title, deleted only if
+-- every book it is made from was.
+INSERT INTO titles (created_at, updated_at, deleted_at, title, authors, subjects, genre)
+SELECT MIN(created_at), MAX(updated_at), CASE WHEN bool_and(deleted_at IS NOT NULL) THEN MAX(deleted_at) END, title, authors, '[]', genre
+FROM (
+    SELECT created_at, updated_at, deleted_at,
+           COALESCE(title, '') AS title,
+           CASE WHEN COALESCE(author, '') = '' THEN '[]' ELSE json_build_array(author)::text END AS authors,
+           COALESCE(genre, '') AS genre
+    FROM books
+) b
+GROUP BY title, authors, genre;
+
+-- Every book row becomes a copy with the same id, so borrows.book_id can
+-- be reused as copy_id unchanged.
+INSERT INTO copies (id, created_at, updated_at, deleted_at, title_id, barcode, condition, status, donated_by_id)
+SELECT b.id, b.created_at, b.updated_at, b.deleted_at, t.id, b.number, 'good',
+       CASE WHEN b.available THEN 'available' ELSE 'on_loan' END,
+       b.donated_by_id
+FROM books b
+JOIN titles t
+  ON t.title = COALESCE(b.title, '')
+ AND t.genre = COALESCE(b.genre, '')
+ AND t.authors = CASE WHEN COALESCE(b.author, '') = '' THEN '[]' ELSE json_build_array(b.author)::text END;
+
+SELECT setval(pg_get_serial_sequence('copies', 'id'), COALESCE((SELECT MAX(id) FROM copies), 0) + 1, false);
+
+ALTER TABLE borrows DROP CONSTRAINT IF EXISTS fk_borrows_book;
+ALTER TABLE borrows RENAME COLUMN book_id TO copy_id;
+ALTER TABLE borrows ADD CONSTRAINT fk_borrows_copy FOREIGN KEY (copy_id) REFERENCES copies (id);
+
+DROP TABLE books;
@@ -0,0 +1,21 @@
+CREATE TABLE holds (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    title_id   BIGINT NOT NULL,
+    user_id    BIGINT NOT NULL,
+    copy_id    BIGINT,
+    status     TEXT DEFAULT 'waiting',
+    placed_at  TIMESTAMPTZ,
+    ready_at   TIMESTAMPTZ,
+    pickup_by  TIMESTAMPTZ,
+    closed_at  TIMESTAMPTZ,
+    CONSTRAINT fk_holds_title FOREIGN KEY (title_id) REFERENCES titles (id),
+    CONSTRAINT fk_holds_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_holds_copy FOREIGN KEY (copy_id) REFERENCES copies (id)
+);
+
+CREATE INDEX idx_holds_deleted_at ON holds (deleted_at);
+CREATE INDEX idx_holds_title_status ON holds (title_id, status);
+CREATE INDEX idx_holds_user_status ON holds (user_id, status);
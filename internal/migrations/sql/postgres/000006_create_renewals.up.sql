@@ -0,0 +1,17 @@
+ALTER TABLE borrows ADD COLUMN renew_count BIGINT DEFAULT 0;
+
+CREATE TABLE renewals (
+    id                BIGSERIAL PRIMARY KEY,
+    created_at        TIMESTAMPTZ,
+    updated_at        TIMESTAMPTZ,
+    deleted_at        TIMESTAMPTZ,
+    borrow_id         BIGINT NOT NULL,
+    renewed_by_id     BIGINT,
+    renewed_at        TIMESTAMPTZ,
+    previous_due_date TIMESTAMPTZ,
+    new_due_date      TIMESTAMPTZ,
+    CONSTRAINT fk_renewals_borrow FOREIGN KEY (borrow_id) REFERENCES borrows (id)
+);
+
+CREATE INDEX idx_renewals_deleted_at ON renewals (deleted_at);
+CREATE INDEX idx_renewals_borrow_id ON renewals (borrow_id);
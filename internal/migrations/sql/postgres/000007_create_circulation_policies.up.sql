@@ -0,0 +1,22 @@
+CREATE TABLE circulation_policies (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    deleted_at   TIMESTAMPTZ,
+    role         TEXT NOT NULL DEFAULT '',
+    genre        TEXT NOT NULL DEFAULT '',
+    loan_days    BIGINT NOT NULL,
+    max_loans    BIGINT NOT NULL DEFAULT 0,
+    fine_rate    NUMERIC NOT NULL DEFAULT 0,
+    fine_cap     NUMERIC NOT NULL DEFAULT 0,
+    grace_days   BIGINT NOT NULL DEFAULT 0,
+    max_renewals BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_circulation_policies_deleted_at ON circulation_policies (deleted_at);
+CREATE UNIQUE INDEX idx_policies_role_genre ON circulation_policies (role, genre);
+
+-- The rules that used to be hard-coded in BorrowBook and ReturnBook.
+INSERT INTO circulation_policies (created_at, updated_at, role, genre, loan_days, max_loans, fine_rate, fine_cap, grace_days, max_renewals)
+VALUES (NOW(), NOW(), '', '', 7, 0, 1.0, 0, 0, 2),
+       (NOW(), NOW(), 'student', '', 7, 3, 1.0, 0, 0, 2);
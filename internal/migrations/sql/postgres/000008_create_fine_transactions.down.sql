@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS fine_transactions;
+
+ALTER TABLE users ALTER COLUMN penalty DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN penalty TYPE NUMERIC USING penalty / 100.0;
+ALTER TABLE users ALTER COLUMN penalty SET DEFAULT 0.0;
+
+ALTER TABLE borrows ALTER COLUMN fine_amount DROP DEFAULT;
+ALTER TABLE borrows ALTER COLUMN fine_amount TYPE NUMERIC USING fine_amount / 100.0;
+ALTER TABLE borrows ALTER COLUMN fine_amount SET DEFAULT 0.0;
+
+ALTER TABLE circulation_policies ALTER COLUMN fine_rate DROP DEFAULT;
+ALTER TABLE circulation_policies ALTER COLUMN fine_rate TYPE NUMERIC USING fine_rate / 100.0;
+ALTER TABLE circulation_policies ALTER COLUMN fine_rate SET DEFAULT 0;
+ALTER TABLE circulation_policies ALTER COLUMN fine_cap DROP DEFAULT;
+ALTER TABLE circulation_policies ALTER COLUMN fine_cap TYPE NUMERIC USING fine_cap / 100.0;
+ALTER TABLE circulation_policies ALTER COLUMN fine_cap SET DEFAULT 0;
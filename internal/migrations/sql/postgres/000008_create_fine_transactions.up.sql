@@ -0,0 +1,47 @@
+-- Money moves from floating point to integer minor units (cents).
+ALTER TABLE users ALTER COLUMN penalty DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN penalty TYPE BIGINT USING ROUND(penalty * 100);
+ALTER TABLE users ALTER COLUMN penalty SET DEFAULT 0;
+
+ALTER TABLE borrows ALTER COLUMN fine_amount DROP DEFAULT;
+ALTER TABLE borrows ALTER COLUMN fine_amount TYPE BIGINT USING ROUND(fine_amount * 100);
+ALTER TABLE borrows ALTER COLUMN fine_amount SET DEFAULT 0;
+
+ALTER TABLE circulation_policies ALTER COLUMN fine_rate DROP DEFAULT;
+ALTER TABLE circulation_policies ALTER COLUMN fine_rate TYPE BIGINT USING ROUND(fine_rate * 100);
+ALTER TABLE circulation_policies ALTER COLUMN fine_rate SET DEFAULT 0;
+ALTER TABLE circulation_policies ALTER COLUMN fine_cap DROP DEFAULT;
+ALTER TABLE circulation_policies ALTER COLUMN fine_cap TYPE BIGINT USING ROUND(fine_cap * 100);
+ALTER TABLE circulation_policies ALTER COLUMN fine_cap SET DEFAULT 0;
+
+CREATE TABLE fine_transactions (
+    id             BIGSERIAL PRIMARY KEY,
+    created_at     TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ,
+    deleted_at     TIMESTAMPTZ,
+    user_id        BIGINT NOT NULL,
+    borrow_id      BIGINT NOT NULL,
+    kind           TEXT NOT NULL,
+    amount         BIGINT NOT NULL,
+    reason         TEXT NOT NULL DEFAULT '',
+    recorded_by_id BIGINT,
+    CONSTRAINT fk_fine_transactions_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_fine_transactions_borrow FOREIGN KEY (borrow_id) REFERENCES borrows (id),
+    CONSTRAINT fk_fine_transactions_recorded_by FOREIGN KEY (recorded_by_id) REFERENCES users (id),
+    CONSTRAINT chk_fine_transactions_amount CHECK (amount > 0)
+);
+
+CREATE INDEX idx_fine_transactions_deleted_at ON fine_transactions (deleted_at);
+CREATE INDEX idx_fine_transactions_user_id ON fine_transactions (user_id);
+CREATE INDEX idx_fine_transactions_borrow_id ON fine_transactions (borrow_id);
+
+-- Nothing could reduce a fine before the ledger existed, so every fine
+-- recorded so far becomes an unpaid charge and the penalty column is
+-- rebuilt from the ledger.
+INSERT INTO fine_transactions (created_at, updated_at, user_id, borrow_id, kind, amount, reason)
+SELECT COALESCE(return_date, NOW()), NOW(), user_id, id, 'charge', fine_amount, 'Overdue return'
+FROM borrows
+WHERE fine_amount > 0;
+
+UPDATE borrows SET fine_paid = false WHERE fine_amount > 0;
+UPDATE users SET penalty = COALESCE((SELECT SUM(amount) FROM fine_transactions WHERE fine_transactions.user_id = users.id), 0);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS block_events;
+
+ALTER TABLE users DROP COLUMN block_reason;
+ALTER TABLE users DROP COLUMN blocked_manually;
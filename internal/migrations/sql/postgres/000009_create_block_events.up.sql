@@ -0,0 +1,22 @@
+ALTER TABLE users ADD COLUMN blocked_manually BOOLEAN DEFAULT false;
+ALTER TABLE users ADD COLUMN block_reason TEXT DEFAULT '';
+
+-- Blocks that existed before the block rules could only have been set by
+-- hand, so keep them from being lifted automatically.
+UPDATE users SET blocked_manually = true WHERE blocked = true;
+
+CREATE TABLE block_events (
+    id             BIGSERIAL PRIMARY KEY,
+    created_at     TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ,
+    deleted_at     TIMESTAMPTZ,
+    user_id        BIGINT NOT NULL,
+    blocked        BOOLEAN NOT NULL,
+    reason         TEXT NOT NULL DEFAULT '',
+    recorded_by_id BIGINT,
+    CONSTRAINT fk_block_events_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_block_events_recorded_by FOREIGN KEY (recorded_by_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_block_events_deleted_at ON block_events (deleted_at);
+CREATE INDEX idx_block_events_user_id ON block_events (user_id);
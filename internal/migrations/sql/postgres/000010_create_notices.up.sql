@@ -0,0 +1,16 @@
+CREATE TABLE notices (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    borrow_id   BIGINT NOT NULL,
+    user_id     BIGINT NOT NULL,
+    kind        TEXT NOT NULL,
+    renew_count BIGINT NOT NULL DEFAULT 0,
+    sent_at     TIMESTAMPTZ,
+    CONSTRAINT fk_notices_borrow FOREIGN KEY (borrow_id) REFERENCES borrows (id),
+    CONSTRAINT fk_notices_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_notices_deleted_at ON notices (deleted_at);
+CREATE UNIQUE INDEX idx_notices_borrow_kind ON notices (borrow_id, kind, renew_count);
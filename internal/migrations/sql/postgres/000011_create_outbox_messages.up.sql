@@ -0,0 +1,20 @@
+CREATE TABLE outbox_messages (
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    deleted_at      TIMESTAMPTZ,
+    event           TEXT NOT NULL,
+    user_id         BIGINT,
+    recipient       TEXT NOT NULL,
+    subject         TEXT NOT NULL,
+    body            TEXT NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    attempts        BIGINT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_error      TEXT NOT NULL DEFAULT '',
+    sent_at         TIMESTAMPTZ,
+    CONSTRAINT fk_outbox_messages_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_outbox_messages_deleted_at ON outbox_messages (deleted_at);
+CREATE INDEX idx_outbox_messages_status_next ON outbox_messages (status, next_attempt_at);
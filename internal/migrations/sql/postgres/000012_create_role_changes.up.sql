@@ -0,0 +1,16 @@
+CREATE TABLE role_changes (
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ,
+    deleted_at    TIMESTAMPTZ,
+    user_id       BIGINT NOT NULL,
+    old_role      TEXT NOT NULL DEFAULT '',
+    new_role      TEXT NOT NULL,
+    reason        TEXT NOT NULL DEFAULT '',
+    changed_by_id BIGINT,
+    CONSTRAINT fk_role_changes_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_role_changes_changed_by FOREIGN KEY (changed_by_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_role_changes_deleted_at ON role_changes (deleted_at);
+CREATE INDEX idx_role_changes_user_id ON role_changes (user_id);
@@ -0,0 +1,19 @@
+CREATE TABLE delegations (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    actor_id   BIGINT NOT NULL,
+    user_id    BIGINT NOT NULL,
+    action     TEXT NOT NULL,
+    copy_id    BIGINT NOT NULL,
+    borrow_id  BIGINT,
+    CONSTRAINT fk_delegations_actor FOREIGN KEY (actor_id) REFERENCES users (id),
+    CONSTRAINT fk_delegations_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_delegations_copy FOREIGN KEY (copy_id) REFERENCES copies (id),
+    CONSTRAINT fk_delegations_borrow FOREIGN KEY (borrow_id) REFERENCES borrows (id)
+);
+
+CREATE INDEX idx_delegations_deleted_at ON delegations (deleted_at);
+CREATE INDEX idx_delegations_user_id ON delegations (user_id);
+CREATE INDEX idx_delegations_actor_id ON delegations (actor_id);
@@ -0,0 +1,30 @@
+CREATE TABLE role_permissions (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    role       TEXT NOT NULL,
+    permission TEXT NOT NULL
+);
+
+CREATE INDEX idx_role_permissions_deleted_at ON role_permissions (deleted_at);
+CREATE UNIQUE INDEX idx_role_permissions_role_permission ON role_permissions (role, permission);
+
+-- Librarians keep everything they could do when routes were guarded by role.
+INSERT INTO role_permissions (created_at, updated_at, role, permission)
+VALUES (NOW(), NOW(), 'librarian', 'books:create'),
+       (NOW(), NOW(), 'librarian', 'books:donate-any'),
+       (NOW(), NOW(), 'librarian', 'borrows:create-any'),
+       (NOW(), NOW(), 'librarian', 'borrows:return-any'),
+       (NOW(), NOW(), 'librarian', 'borrows:read'),
+       (NOW(), NOW(), 'librarian', 'policies:manage'),
+       (NOW(), NOW(), 'librarian', 'fines:read'),
+       (NOW(), NOW(), 'librarian', 'fines:collect'),
+       (NOW(), NOW(), 'librarian', 'fines:waive'),
+       (NOW(), NOW(), 'librarian', 'fines:refund'),
+       (NOW(), NOW(), 'librarian', 'users:read'),
+       (NOW(), NOW(), 'librarian', 'users:block'),
+       (NOW(), NOW(), 'librarian', 'users:change-role'),
+       (NOW(), NOW(), 'librarian', 'delegations:read'),
+       (NOW(), NOW(), 'librarian', 'outbox:manage'),
+       (NOW(), NOW(), 'librarian', 'roles:manage');
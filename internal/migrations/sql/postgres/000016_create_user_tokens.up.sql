@@ -0,0 +1,22 @@
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN DEFAULT false;
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- Accounts created before verification existed keep borrowing.
+UPDATE users SET email_verified = true;
+
+CREATE TABLE user_tokens (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    user_id    BIGINT NOT NULL,
+    purpose    TEXT NOT NULL,
+    token_id   TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    CONSTRAINT fk_user_tokens_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_user_tokens_deleted_at ON user_tokens (deleted_at);
+CREATE UNIQUE INDEX idx_user_tokens_token_id ON user_tokens (token_id);
+CREATE INDEX idx_user_tokens_user_purpose ON user_tokens (user_id, purpose);
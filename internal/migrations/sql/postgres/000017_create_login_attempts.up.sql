@@ -0,0 +1,36 @@
+CREATE TABLE login_attempts (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    email      TEXT NOT NULL,
+    user_id    BIGINT,
+    ip         TEXT NOT NULL,
+    user_agent TEXT,
+    success    BOOLEAN NOT NULL,
+    outcome    TEXT NOT NULL,
+    CONSTRAINT fk_login_attempts_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_login_attempts_deleted_at ON login_attempts (deleted_at);
+CREATE INDEX idx_login_attempts_user_id ON login_attempts (user_id);
+CREATE INDEX idx_login_attempts_email ON login_attempts (email);
+CREATE INDEX idx_login_attempts_ip ON login_attempts (ip);
+
+CREATE TABLE login_throttles (
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    deleted_at      TIMESTAMPTZ,
+    kind            TEXT NOT NULL,
+    value           TEXT NOT NULL,
+    failures        BIGINT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ,
+    retry_at        TIMESTAMPTZ
+);
+
+CREATE INDEX idx_login_throttles_deleted_at ON login_throttles (deleted_at);
+CREATE UNIQUE INDEX idx_login_throttles_kind_value ON login_throttles (kind, value);
+
+INSERT INTO role_permissions (created_at, updated_at, role, permission)
+VALUES (NOW(), NOW(), 'librarian', 'logins:read');
@@ -0,0 +1,3 @@
+DELETE FROM role_permissions WHERE permission = 'keys:manage';
+
+DROP TABLE IF EXISTS signing_keys;
@@ -0,0 +1,18 @@
+CREATE TABLE signing_keys (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    deleted_at   TIMESTAMPTZ,
+    kid          TEXT NOT NULL,
+    algorithm    TEXT NOT NULL,
+    public_key   TEXT NOT NULL,
+    private_key  TEXT NOT NULL,
+    activates_at TIMESTAMPTZ NOT NULL,
+    expires_at   TIMESTAMPTZ
+);
+
+CREATE INDEX idx_signing_keys_deleted_at ON signing_keys (deleted_at);
+CREATE UNIQUE INDEX idx_signing_keys_kid ON signing_keys (kid);
+
+INSERT INTO role_permissions (created_at, updated_at, role, permission)
+VALUES (NOW(), NOW(), 'librarian', 'keys:manage');
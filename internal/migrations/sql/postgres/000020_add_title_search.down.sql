@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_titles_authors_trgm;
+DROP INDEX IF EXISTS idx_titles_title_trgm;
+DROP INDEX IF EXISTS idx_titles_search_vector;
+
+ALTER TABLE titles DROP COLUMN IF EXISTS search_vector;
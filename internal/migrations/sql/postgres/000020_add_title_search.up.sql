@@ -0,0 +1,13 @@
+-- pg_trgm is a trusted extension from PostgreSQL 13, so the database owner
+-- can create it.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE titles ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(authors, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(genre, '')), 'C')
+) STORED;
+
+CREATE INDEX idx_titles_search_vector ON titles USING GIN (search_vector);
+CREATE INDEX idx_titles_title_trgm ON titles USING GIN (title gin_trgm_ops);
+CREATE INDEX idx_titles_authors_trgm ON titles USING GIN (authors gin_trgm_ops);
@@ -0,0 +1,2 @@
+INSERT INTO role_permissions (created_at, updated_at, role, permission)
+VALUES (NOW(), NOW(), 'librarian', 'books:manage');
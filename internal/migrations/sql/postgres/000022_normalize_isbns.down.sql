@@ -0,0 +1,3 @@
+-- This migration is irreversible: the ISBNs as they were written before
+-- normalisation are not kept, so rolling back leaves them as ISBN-13s.
+SELECT 1;
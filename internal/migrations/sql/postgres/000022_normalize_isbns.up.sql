@@ -0,0 +1,25 @@
+-- ISBNs are now stored as bare ISBN-13s. Existing ones lose their hyphens
+-- and spaces, and ISBN-10s gain the 978 prefix and a new check digit.
+-- Only ISBN-10s whose own check digit is right are converted; the rest are
+-- left for 000024 to flag. The check digit is only summed once the ISBN is
+-- known to be ten characters.
+UPDATE titles SET isbn = UPPER(REPLACE(REPLACE(isbn, '-', ''), ' ', ''))
+WHERE isbn IS NOT NULL;
+
+UPDATE titles SET isbn = '978' || SUBSTR(isbn, 1, 9) || CAST((10 - (38
+        + 3 * CAST(SUBSTR(isbn, 1, 1) AS INTEGER) + CAST(SUBSTR(isbn, 2, 1) AS INTEGER)
+        + 3 * CAST(SUBSTR(isbn, 3, 1) AS INTEGER) + CAST(SUBSTR(isbn, 4, 1) AS INTEGER)
+        + 3 * CAST(SUBSTR(isbn, 5, 1) AS INTEGER) + CAST(SUBSTR(isbn, 6, 1) AS INTEGER)
+        + 3 * CAST(SUBSTR(isbn, 7, 1) AS INTEGER) + CAST(SUBSTR(isbn, 8, 1) AS INTEGER)
+        + 3 * CAST(SUBSTR(isbn, 9, 1) AS INTEGER)) % 10) % 10 AS TEXT),
+    updated_at = NOW()
+WHERE CASE
+    WHEN isbn ~ '^[0-9]{9}[0-9X]$' THEN (
+        10 * CAST(SUBSTR(isbn, 1, 1) AS INTEGER) + 9 * CAST(SUBSTR(isbn, 2, 1) AS INTEGER)
+        + 8 * CAST(SUBSTR(isbn, 3, 1) AS INTEGER) + 7 * CAST(SUBSTR(isbn, 4, 1) AS INTEGER)
+        + 6 * CAST(SUBSTR(isbn, 5, 1) AS INTEGER) + 5 * CAST(SUBSTR(isbn, 6, 1) AS INTEGER)
+        + 4 * CAST(SUBSTR(isbn, 7, 1) AS INTEGER) + 3 * CAST(SUBSTR(isbn, 8, 1) AS INTEGER)
+        + 2 * CAST(SUBSTR(isbn, 9, 1) AS INTEGER)
+        + CASE SUBSTR(isbn, 10, 1) WHEN 'X' THEN 10 ELSE CAST(SUBSTR(isbn, 10, 1) AS INTEGER) END) % 11 = 0
+    ELSE FALSE
+END;
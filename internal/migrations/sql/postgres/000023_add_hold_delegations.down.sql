@@ -0,0 +1,5 @@
+-- Hold delegations without a copy cannot be kept.
+DELETE FROM delegations WHERE copy_id IS NULL;
+ALTER TABLE delegations DROP CONSTRAINT fk_delegations_hold;
+ALTER TABLE delegations DROP COLUMN hold_id;
+ALTER TABLE delegations ALTER COLUMN copy_id SET NOT NULL;
@@ -0,0 +1,5 @@
+-- Delegations now also record holds placed or cancelled for a patron,
+-- which may have no copy yet.
+ALTER TABLE delegations ALTER COLUMN copy_id DROP NOT NULL;
+ALTER TABLE delegations ADD COLUMN hold_id BIGINT;
+ALTER TABLE delegations ADD CONSTRAINT fk_delegations_hold FOREIGN KEY (hold_id) REFERENCES holds (id);
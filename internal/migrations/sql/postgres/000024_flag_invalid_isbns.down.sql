@@ -0,0 +1,3 @@
+UPDATE titles SET isbn = invalid_isbn WHERE invalid_isbn IS NOT NULL;
+
+ALTER TABLE titles DROP COLUMN invalid_isbn;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS users (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    name       TEXT,
+    email      TEXT,
+    password   TEXT,
+    role       TEXT,
+    penalty    REAL DEFAULT 0.0,
+    blocked    NUMERIC DEFAULT false,
+    CONSTRAINT uni_users_email UNIQUE (email)
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
@@ -0,0 +1,17 @@
+-- Books added through POST /api/books store donated_by_id = 0, so the
+-- column deliberately has no foreign key to users.
+CREATE TABLE IF NOT EXISTS books (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at    DATETIME,
+    updated_at    DATETIME,
+    deleted_at    DATETIME,
+    title         TEXT,
+    author        TEXT,
+    number        TEXT,
+    genre         TEXT,
+    donated_by_id INTEGER,
+    available     NUMERIC DEFAULT true,
+    CONSTRAINT uni_books_number UNIQUE (number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_books_deleted_at ON books (deleted_at);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS borrows (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME,
+    updated_at  DATETIME,
+    deleted_at  DATETIME,
+    book_id     INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    borrow_date DATETIME,
+    return_date DATETIME,
+    due_date    DATETIME,
+    returned    NUMERIC DEFAULT false,
+    fine_amount REAL DEFAULT 0.0,
+    fine_paid   NUMERIC DEFAULT false,
+    CONSTRAINT fk_borrows_book FOREIGN KEY (book_id) REFERENCES books (id),
+    CONSTRAINT fk_borrows_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_borrows_deleted_at ON borrows (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_borrows_user_returned ON borrows (user_id, returned);
@@ -0,0 +1,53 @@
+-- Copies become books again. Only the first author survives, and the
+-- extra title fields (ISBN, publisher, ...) are lost.
+CREATE TABLE books (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at    DATETIME,
+    updated_at    DATETIME,
+    deleted_at    DATETIME,
+    title         TEXT,
+    author        TEXT,
+    number        TEXT,
+    genre         TEXT,
+    donated_by_id INTEGER,
+    available     NUMERIC DEFAULT true,
+    CONSTRAINT uni_books_number UNIQUE (number)
+);
+
+CREATE INDEX idx_books_deleted_at ON books (deleted_at);
+
+INSERT INTO books (id, created_at, updated_at, deleted_at, title, author, number, genre, donated_by_id, available)
+SELECT c.id, c.created_at, c.updated_at, c.deleted_at, t.title, COALESCE(json_extract(t.authors, '$[0]'), ''),
+       c.barcode, t.genre, c.donated_by_id, c.status = 'available'
+FROM copies c
+JOIN titles t ON t.id = c.title_id;
+
+CREATE TABLE borrows_old (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME,
+    updated_at  DATETIME,
+    deleted_at  DATETIME,
+    book_id     INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    borrow_date DATETIME,
+    return_date DATETIME,
+    due_date    DATETIME,
+    returned    NUMERIC DEFAULT false,
+    fine_amount REAL DEFAULT 0.0,
+    fine_paid   NUMERIC DEFAULT false,
+    CONSTRAINT fk_borrows_book FOREIGN KEY (book_id) REFERENCES books (id),
+    CONSTRAINT fk_borrows_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+INSERT INTO borrows_old (id, created_at, updated_at, deleted_at, book_id, user_id, borrow_date, return_date, due_date, returned, fine_amount, fine_paid)
+SELECT id, created_at, updated_at, deleted_at, copy_id, user_id, borrow_date, return_date, due_date, returned, fine_amount, fine_paid
+FROM borrows;
+
+DROP TABLE borrows;
+ALTER TABLE borrows_old RENAME TO borrows;
+
+CREATE INDEX idx_borrows_deleted_at ON borrows (deleted_at);
+CREATE INDEX idx_borrows_user_returned ON borrows (user_id, returned);
+
+DROP TABLE copies;
+DROP TABLE titles;
@@ -0,0 +1,90 @@
+CREATE TABLE titles (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    title      TEXT,
+    authors    TEXT,
+    isbn       TEXT,
+    publisher  TEXT,
+    year       INTEGER,
+    language   TEXT,
+    subjects   TEXT,
+    genre      TEXT
+);
+
+CREATE INDEX idx_titles_deleted_at ON titles (deleted_at);
+CREATE INDEX idx_titles_isbn ON titles (isbn);
+
+CREATE TABLE copies (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at    DATETIME,
+    updated_at    DATETIME,
+    deleted_at    DATETIME,
+    title_id      INTEGER NOT NULL,
+    barcode       TEXT,
+    location      TEXT,
+    condition     TEXT DEFAULT 'good',
+    status        TEXT DEFAULT 'available',
+    donated_by_id INTEGER,
+    CONSTRAINT uni_copies_barcode UNIQUE (barcode),
+    CONSTRAINT fk_copies_title FOREIGN KEY (title_id) REFERENCES titles (id)
+);
+
+CREATE INDEX idx_copies_deleted_at ON copies (deleted_at);
+CREATE INDEX idx_copies_title_status ON copies (title_id, status);
+
+-- Every distinct (title, author, genre) becomes one title, deleted only if
+-- every book it is made from was.
+INSERT INTO titles (created_at, updated_at, deleted_at, title, authors, subjects, genre)
+SELECT MIN(created_at), MAX(updated_at), CASE WHEN SUM(deleted_at IS NULL) = 0 THEN MAX(deleted_at) END, title, authors, '[]', genre
+FROM (
+    SELECT created_at, updated_at, deleted_at,
+           COALESCE(title, '') AS title,
+           CASE WHEN COALESCE(author, '') = '' THEN '[]' ELSE json_array(author) END AS authors,
+           COALESCE(genre, '') AS genre
+    FROM books
+) b
+GROUP BY title, authors, genre;
+
+-- Every book row becomes a copy with the same id, so borrows.book_id can
+-- be reused as copy_id unchanged.
+INSERT INTO copies (id, created_at, updated_at, deleted_at, title_id, barcode, condition, status, donated_by_id)
+SELECT b.id, b.created_at, b.updated_at, b.deleted_at, t.id, b.number, 'good',
+       CASE WHEN b.available THEN 'available' ELSE 'on_loan' END,
+       b.donated_by_id
+FROM books b
+JOIN titles t
+  ON t.title = COALESCE(b.title, '')
+ AND t.genre = COALESCE(b.genre, '')
+ AND t.authors = CASE WHEN COALESCE(b.author, '') = '' THEN '[]' ELSE json_array(b.author) END;
+
+-- SQLite cannot alter a foreign key in place, so borrows is rebuilt.
+CREATE TABLE borrows_new (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME,
+    updated_at  DATETIME,
+    deleted_at  DATETIME,
+    copy_id     INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    borrow_date DATETIME,
+    return_date DATETIME,
+    due_date    DATETIME,
+    returned    NUMERIC DEFAULT false,
+    fine_amount REAL DEFAULT 0.0,
+    fine_paid   NUMERIC DEFAULT false,
+    CONSTRAINT fk_borrows_copy FOREIGN KEY (copy_id) REFERENCES copies (id),
+    CONSTRAINT fk_borrows_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+INSERT INTO borrows_new (id, created_at, updated_at, deleted_at, copy_id, user_id, borrow_date, return_date, due_date, returned, fine_amount, fine_paid)
+SELECT id, created_at, updated_at, deleted_at, book_id, user_id, borrow_date, return_date, due_date, returned, fine_amount, fine_paid
+FROM borrows;
+
+DROP TABLE borrows;
+ALTER TABLE borrows_new RENAME TO borrows;
+
+CREATE INDEX idx_borrows_deleted_at ON borrows (deleted_at);
+CREATE INDEX idx_borrows_user_returned ON borrows (user_id, returned);
+
+DROP TABLE books;
@@ -0,0 +1,21 @@
+CREATE TABLE holds (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    title_id   INTEGER NOT NULL,
+    user_id    INTEGER NOT NULL,
+    copy_id    INTEGER,
+    status     TEXT DEFAULT 'waiting',
+    placed_at  DATETIME,
+    ready_at   DATETIME,
+    pickup_by  DATETIME,
+    closed_at  DATETIME,
+    CONSTRAINT fk_holds_title FOREIGN KEY (title_id) REFERENCES titles (id),
+    CONSTRAINT fk_holds_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_holds_copy FOREIGN KEY (copy_id) REFERENCES copies (id)
+);
+
+CREATE INDEX idx_holds_deleted_at ON holds (deleted_at);
+CREATE INDEX idx_holds_title_status ON holds (title_id, status);
+CREATE INDEX idx_holds_user_status ON holds (user_id, status);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS renewals;
+
+ALTER TABLE borrows DROP COLUMN renew_count;
@@ -0,0 +1,17 @@
+ALTER TABLE borrows ADD COLUMN renew_count INTEGER DEFAULT 0;
+
+CREATE TABLE renewals (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at        DATETIME,
+    updated_at        DATETIME,
+    deleted_at        DATETIME,
+    borrow_id         INTEGER NOT NULL,
+    renewed_by_id     INTEGER,
+    renewed_at        DATETIME,
+    previous_due_date DATETIME,
+    new_due_date      DATETIME,
+    CONSTRAINT fk_renewals_borrow FOREIGN KEY (borrow_id) REFERENCES borrows (id)
+);
+
+CREATE INDEX idx_renewals_deleted_at ON renewals (deleted_at);
+CREATE INDEX idx_renewals_borrow_id ON renewals (borrow_id);
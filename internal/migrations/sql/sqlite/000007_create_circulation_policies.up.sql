@@ -0,0 +1,22 @@
+CREATE TABLE circulation_policies (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at   DATETIME,
+    updated_at   DATETIME,
+    deleted_at   DATETIME,
+    role         TEXT NOT NULL DEFAULT '',
+    genre        TEXT NOT NULL DEFAULT '',
+    loan_days    INTEGER NOT NULL,
+    max_loans    INTEGER NOT NULL DEFAULT 0,
+    fine_rate    REAL    NOT NULL DEFAULT 0,
+    fine_cap     REAL    NOT NULL DEFAULT 0,
+    grace_days   INTEGER NOT NULL DEFAULT 0,
+    max_renewals INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_circulation_policies_deleted_at ON circulation_policies (deleted_at);
+CREATE UNIQUE INDEX idx_policies_role_genre ON circulation_policies (role, genre);
+
+-- The rules that used to be hard-coded in BorrowBook and ReturnBook.
+INSERT INTO circulation_policies (created_at, updated_at, role, genre, loan_days, max_loans, fine_rate, fine_cap, grace_days, max_renewals)
+VALUES (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, '', '', 7, 0, 1.0, 0, 0, 2),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'student', '', 7, 3, 1.0, 0, 0, 2);
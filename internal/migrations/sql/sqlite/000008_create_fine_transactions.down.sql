@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS fine_transactions;
+
+ALTER TABLE users ADD COLUMN penalty_units REAL DEFAULT 0.0;
+UPDATE users SET penalty_units = penalty / 100.0;
+ALTER TABLE users DROP COLUMN penalty;
+ALTER TABLE users RENAME COLUMN penalty_units TO penalty;
+
+ALTER TABLE borrows ADD COLUMN fine_amount_units REAL DEFAULT 0.0;
+UPDATE borrows SET fine_amount_units = fine_amount / 100.0;
+ALTER TABLE borrows DROP COLUMN fine_amount;
+ALTER TABLE borrows RENAME COLUMN fine_amount_units TO fine_amount;
+
+ALTER TABLE circulation_policies ADD COLUMN fine_rate_units REAL NOT NULL DEFAULT 0;
+ALTER TABLE circulation_policies ADD COLUMN fine_cap_units REAL NOT NULL DEFAULT 0;
+UPDATE circulation_policies SET fine_rate_units = fine_rate / 100.0,
+                                fine_cap_units = fine_cap / 100.0;
+ALTER TABLE circulation_policies DROP COLUMN fine_rate;
+ALTER TABLE circulation_policies DROP COLUMN fine_cap;
+ALTER TABLE circulation_policies RENAME COLUMN fine_rate_units TO fine_rate;
+ALTER TABLE circulation_policies RENAME COLUMN fine_cap_units TO fine_cap;
@@ -0,0 +1,52 @@
+-- Money moves from floating point to integer minor units (cents). SQLite
+-- cannot change a column's type, so each one is rebuilt under its old name.
+ALTER TABLE users ADD COLUMN penalty_cents INTEGER DEFAULT 0;
+UPDATE users SET penalty_cents = CAST(ROUND(penalty * 100) AS INTEGER);
+ALTER TABLE users DROP COLUMN penalty;
+ALTER TABLE users RENAME COLUMN penalty_cents TO penalty;
+
+ALTER TABLE borrows ADD COLUMN fine_amount_cents INTEGER DEFAULT 0;
+UPDATE borrows SET fine_amount_cents = CAST(ROUND(fine_amount * 100) AS INTEGER);
+ALTER TABLE borrows DROP COLUMN fine_amount;
+ALTER TABLE borrows RENAME COLUMN fine_amount_cents TO fine_amount;
+
+ALTER TABLE circulation_policies ADD COLUMN fine_rate_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE circulation_policies ADD COLUMN fine_cap_cents INTEGER NOT NULL DEFAULT 0;
+UPDATE circulation_policies SET fine_rate_cents = CAST(ROUND(fine_rate * 100) AS INTEGER),
+                                fine_cap_cents = CAST(ROUND(fine_cap * 100) AS INTEGER);
+ALTER TABLE circulation_policies DROP COLUMN fine_rate;
+ALTER TABLE circulation_policies DROP COLUMN fine_cap;
+ALTER TABLE circulation_policies RENAME COLUMN fine_rate_cents TO fine_rate;
+ALTER TABLE circulation_policies RENAME COLUMN fine_cap_cents TO fine_cap;
+
+CREATE TABLE fine_transactions (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at     DATETIME,
+    updated_at     DATETIME,
+    deleted_at     DATETIME,
+    user_id        INTEGER NOT NULL,
+    borrow_id      INTEGER NOT NULL,
+    kind           TEXT NOT NULL,
+    amount         INTEGER NOT NULL,
+    reason         TEXT NOT NULL DEFAULT '',
+    recorded_by_id INTEGER,
+    CONSTRAINT fk_fine_transactions_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_fine_transactions_borrow FOREIGN KEY (borrow_id) REFERENCES borrows (id),
+    CONSTRAINT fk_fine_transactions_recorded_by FOREIGN KEY (recorded_by_id) REFERENCES users (id),
+    CONSTRAINT chk_fine_transactions_amount CHECK (amount > 0)
+);
+
+CREATE INDEX idx_fine_transactions_deleted_at ON fine_transactions (deleted_at);
+CREATE INDEX idx_fine_transactions_user_id ON fine_transactions (user_id);
+CREATE INDEX idx_fine_transactions_borrow_id ON fine_transactions (borrow_id);
+
+-- Nothing could reduce a fine before the ledger existed, so every fine
+-- recorded so far becomes an unpaid charge and the penalty column is
+-- rebuilt from the ledger.
+INSERT INTO fine_transactions (created_at, updated_at, user_id, borrow_id, kind, amount, reason)
+SELECT COALESCE(return_date, CURRENT_TIMESTAMP), CURRENT_TIMESTAMP, user_id, id, 'charge', fine_amount, 'Overdue return'
+FROM borrows
+WHERE fine_amount > 0;
+
+UPDATE borrows SET fine_paid = false WHERE fine_amount > 0;
+UPDATE users SET penalty = COALESCE((SELECT SUM(amount) FROM fine_transactions WHERE fine_transactions.user_id = users.id), 0);
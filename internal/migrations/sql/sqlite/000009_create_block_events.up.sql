@@ -0,0 +1,22 @@
+ALTER TABLE users ADD COLUMN blocked_manually NUMERIC DEFAULT false;
+ALTER TABLE users ADD COLUMN block_reason TEXT DEFAULT '';
+
+-- Blocks that existed before the block rules could only have been set by
+-- hand, so keep them from being lifted automatically.
+UPDATE users SET blocked_manually = true WHERE blocked = true;
+
+CREATE TABLE block_events (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at     DATETIME,
+    updated_at     DATETIME,
+    deleted_at     DATETIME,
+    user_id        INTEGER NOT NULL,
+    blocked        NUMERIC NOT NULL,
+    reason         TEXT NOT NULL DEFAULT '',
+    recorded_by_id INTEGER,
+    CONSTRAINT fk_block_events_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_block_events_recorded_by FOREIGN KEY (recorded_by_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_block_events_deleted_at ON block_events (deleted_at);
+CREATE INDEX idx_block_events_user_id ON block_events (user_id);
@@ -0,0 +1,16 @@
+CREATE TABLE notices (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME,
+    updated_at  DATETIME,
+    deleted_at  DATETIME,
+    borrow_id   INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    kind        TEXT NOT NULL,
+    renew_count INTEGER NOT NULL DEFAULT 0,
+    sent_at     DATETIME,
+    CONSTRAINT fk_notices_borrow FOREIGN KEY (borrow_id) REFERENCES borrows (id),
+    CONSTRAINT fk_notices_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_notices_deleted_at ON notices (deleted_at);
+CREATE UNIQUE INDEX idx_notices_borrow_kind ON notices (borrow_id, kind, renew_count);
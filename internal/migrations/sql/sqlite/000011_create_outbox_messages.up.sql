@@ -0,0 +1,20 @@
+CREATE TABLE outbox_messages (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at      DATETIME,
+    updated_at      DATETIME,
+    deleted_at      DATETIME,
+    event           TEXT NOT NULL,
+    user_id         INTEGER,
+    recipient       TEXT NOT NULL,
+    subject         TEXT NOT NULL,
+    body            TEXT NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    last_error      TEXT NOT NULL DEFAULT '',
+    sent_at         DATETIME,
+    CONSTRAINT fk_outbox_messages_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_outbox_messages_deleted_at ON outbox_messages (deleted_at);
+CREATE INDEX idx_outbox_messages_status_next ON outbox_messages (status, next_attempt_at);
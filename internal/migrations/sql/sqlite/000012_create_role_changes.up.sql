@@ -0,0 +1,16 @@
+CREATE TABLE role_changes (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at    DATETIME,
+    updated_at    DATETIME,
+    deleted_at    DATETIME,
+    user_id       INTEGER NOT NULL,
+    old_role      TEXT NOT NULL DEFAULT '',
+    new_role      TEXT NOT NULL,
+    reason        TEXT NOT NULL DEFAULT '',
+    changed_by_id INTEGER,
+    CONSTRAINT fk_role_changes_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_role_changes_changed_by FOREIGN KEY (changed_by_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_role_changes_deleted_at ON role_changes (deleted_at);
+CREATE INDEX idx_role_changes_user_id ON role_changes (user_id);
@@ -0,0 +1,19 @@
+CREATE TABLE delegations (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    actor_id   INTEGER NOT NULL,
+    user_id    INTEGER NOT NULL,
+    action     TEXT NOT NULL,
+    copy_id    INTEGER NOT NULL,
+    borrow_id  INTEGER,
+    CONSTRAINT fk_delegations_actor FOREIGN KEY (actor_id) REFERENCES users (id),
+    CONSTRAINT fk_delegations_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_delegations_copy FOREIGN KEY (copy_id) REFERENCES copies (id),
+    CONSTRAINT fk_delegations_borrow FOREIGN KEY (borrow_id) REFERENCES borrows (id)
+);
+
+CREATE INDEX idx_delegations_deleted_at ON delegations (deleted_at);
+CREATE INDEX idx_delegations_user_id ON delegations (user_id);
+CREATE INDEX idx_delegations_actor_id ON delegations (actor_id);
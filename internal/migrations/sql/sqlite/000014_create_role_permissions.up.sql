@@ -0,0 +1,30 @@
+CREATE TABLE role_permissions (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    role       TEXT NOT NULL,
+    permission TEXT NOT NULL
+);
+
+CREATE INDEX idx_role_permissions_deleted_at ON role_permissions (deleted_at);
+CREATE UNIQUE INDEX idx_role_permissions_role_permission ON role_permissions (role, permission);
+
+-- Librarians keep everything they could do when routes were guarded by role.
+INSERT INTO role_permissions (created_at, updated_at, role, permission)
+VALUES (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'books:create'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'books:donate-any'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'borrows:create-any'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'borrows:return-any'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'borrows:read'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'policies:manage'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'fines:read'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'fines:collect'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'fines:waive'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'fines:refund'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'users:read'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'users:block'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'users:change-role'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'delegations:read'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'outbox:manage'),
+       (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'roles:manage');
@@ -0,0 +1,22 @@
+ALTER TABLE users ADD COLUMN email_verified NUMERIC DEFAULT false;
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME;
+
+-- Accounts created before verification existed keep borrowing.
+UPDATE users SET email_verified = true;
+
+CREATE TABLE user_tokens (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    user_id    INTEGER NOT NULL,
+    purpose    TEXT NOT NULL,
+    token_id   TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at    DATETIME,
+    CONSTRAINT fk_user_tokens_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_user_tokens_deleted_at ON user_tokens (deleted_at);
+CREATE UNIQUE INDEX idx_user_tokens_token_id ON user_tokens (token_id);
+CREATE INDEX idx_user_tokens_user_purpose ON user_tokens (user_id, purpose);
@@ -0,0 +1,4 @@
+DELETE FROM role_permissions WHERE permission = 'logins:read';
+
+DROP TABLE IF EXISTS login_throttles;
+DROP TABLE IF EXISTS login_attempts;
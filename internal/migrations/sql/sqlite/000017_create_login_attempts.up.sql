@@ -0,0 +1,36 @@
+CREATE TABLE login_attempts (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    email      TEXT NOT NULL,
+    user_id    INTEGER,
+    ip         TEXT NOT NULL,
+    user_agent TEXT,
+    success    NUMERIC NOT NULL,
+    outcome    TEXT NOT NULL,
+    CONSTRAINT fk_login_attempts_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX idx_login_attempts_deleted_at ON login_attempts (deleted_at);
+CREATE INDEX idx_login_attempts_user_id ON login_attempts (user_id);
+CREATE INDEX idx_login_attempts_email ON login_attempts (email);
+CREATE INDEX idx_login_attempts_ip ON login_attempts (ip);
+
+CREATE TABLE login_throttles (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at      DATETIME,
+    updated_at      DATETIME,
+    deleted_at      DATETIME,
+    kind            TEXT NOT NULL,
+    value           TEXT NOT NULL,
+    failures        INTEGER NOT NULL DEFAULT 0,
+    last_failure_at DATETIME,
+    retry_at        DATETIME
+);
+
+CREATE INDEX idx_login_throttles_deleted_at ON login_throttles (deleted_at);
+CREATE UNIQUE INDEX idx_login_throttles_kind_value ON login_throttles (kind, value);
+
+INSERT INTO role_permissions (created_at, updated_at, role, permission)
+VALUES (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'logins:read');
@@ -0,0 +1,18 @@
+CREATE TABLE signing_keys (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at   DATETIME,
+    updated_at   DATETIME,
+    deleted_at   DATETIME,
+    kid          TEXT NOT NULL,
+    algorithm    TEXT NOT NULL,
+    public_key   TEXT NOT NULL,
+    private_key  TEXT NOT NULL,
+    activates_at DATETIME NOT NULL,
+    expires_at   DATETIME
+);
+
+CREATE INDEX idx_signing_keys_deleted_at ON signing_keys (deleted_at);
+CREATE UNIQUE INDEX idx_signing_keys_kid ON signing_keys (kid);
+
+INSERT INTO role_permissions (created_at, updated_at, role, permission)
+VALUES (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'keys:manage');
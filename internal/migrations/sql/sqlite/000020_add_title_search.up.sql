@@ -0,0 +1,3 @@
+-- SQLite has no full-text index here; the catalog is searched with the
+-- in-process index of package search instead.
+SELECT 1;
@@ -0,0 +1,2 @@
+INSERT INTO role_permissions (created_at, updated_at, role, permission)
+VALUES (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'librarian', 'books:manage');
@@ -0,0 +1,31 @@
+-- Delegations now also record holds placed or cancelled for a patron,
+-- which may have no copy yet. SQLite cannot drop NOT NULL in place, so the
+-- table is rebuilt.
+CREATE TABLE delegations_new (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    actor_id   INTEGER NOT NULL,
+    user_id    INTEGER NOT NULL,
+    action     TEXT NOT NULL,
+    copy_id    INTEGER,
+    borrow_id  INTEGER,
+    hold_id    INTEGER,
+    CONSTRAINT fk_delegations_actor FOREIGN KEY (actor_id) REFERENCES users (id),
+    CONSTRAINT fk_delegations_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_delegations_copy FOREIGN KEY (copy_id) REFERENCES copies (id),
+    CONSTRAINT fk_delegations_borrow FOREIGN KEY (borrow_id) REFERENCES borrows (id),
+    CONSTRAINT fk_delegations_hold FOREIGN KEY (hold_id) REFERENCES holds (id)
+);
+
+INSERT INTO delegations_new (id, created_at, updated_at, deleted_at, actor_id, user_id, action, copy_id, borrow_id)
+SELECT id, created_at, updated_at, deleted_at, actor_id, user_id, action, copy_id, borrow_id
+FROM delegations;
+
+DROP TABLE delegations;
+ALTER TABLE delegations_new RENAME TO delegations;
+
+CREATE INDEX idx_delegations_deleted_at ON delegations (deleted_at);
+CREATE INDEX idx_delegations_user_id ON delegations (user_id);
+CREATE INDEX idx_delegations_actor_id ON delegations (actor_id);
@@ -0,0 +1,18 @@
+-- Titles whose ISBN is still not a valid ISBN-13 after 000022, such as a
+-- wrong check digit or a stray character, could never be looked up by
+-- ISBN. Their ISBN is moved to invalid_isbn for a librarian to correct. The
+-- check digit is only summed once the ISBN is known to be thirteen digits.
+ALTER TABLE titles ADD COLUMN invalid_isbn TEXT;
+
+UPDATE titles SET invalid_isbn = isbn, isbn = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE isbn <> '' AND CASE
+    WHEN isbn GLOB '97[89][0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9]' THEN (
+        CAST(SUBSTR(isbn, 1, 1) AS INTEGER) + 3 * CAST(SUBSTR(isbn, 2, 1) AS INTEGER)
+        + CAST(SUBSTR(isbn, 3, 1) AS INTEGER) + 3 * CAST(SUBSTR(isbn, 4, 1) AS INTEGER)
+        + CAST(SUBSTR(isbn, 5, 1) AS INTEGER) + 3 * CAST(SUBSTR(isbn, 6, 1) AS INTEGER)
+        + CAST(SUBSTR(isbn, 7, 1) AS INTEGER) + 3 * CAST(SUBSTR(isbn, 8, 1) AS INTEGER)
+        + CAST(SUBSTR(isbn, 9, 1) AS INTEGER) + 3 * CAST(SUBSTR(isbn, 10, 1) AS INTEGER)
+        + CAST(SUBSTR(isbn, 11, 1) AS INTEGER) + 3 * CAST(SUBSTR(isbn, 12, 1) AS INTEGER)
+        + CAST(SUBSTR(isbn, 13, 1) AS INTEGER)) % 10 <> 0
+    ELSE TRUE
+END;
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// BlockEvent records one change to a user's Blocked flag and why it was
+// made.
+type BlockEvent struct {
+	gorm.Model
+	UserID       uint   `json:"user_id"`
+	User         User   `json:"-" gorm:"foreignKey:UserID"`
+	Blocked      bool   `json:"blocked"`
+	Reason       string `json:"reason"`
+	RecordedByID *uint  `json:"recorded_by_id"` // nil when applied by the automatic block rules
+}
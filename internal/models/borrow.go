@@ -8,14 +8,15 @@ import (
 
 type Borrow struct {
 	gorm.Model
-	BookID       uint      `json:"book_id"`
-	Book         Book      `json:"-" gorm:"foreignKey:BookID"`
-	UserID       uint      `json:"user_id"`
-	User         User      `json:"-" gorm:"foreignKey:UserID"` 
-	BorrowDate   time.Time `json:"borrow_date"`
-	ReturnDate   *time.Time `json:"return_date"` 
-	DueDate      time.Time `json:"due_date"`
-	Returned     bool      `json:"returned" gorm:"default:false"`
-	FineAmount   float64   `json:"fine_amount" gorm:"default:0.0"`
-	FinePaid     bool      `json:"fine_paid" gorm:"default:false"`
-}
\ No newline at end of file
+	CopyID     uint       `json:"copy_id"`
+	Copy       Copy       `json:"-" gorm:"foreignKey:CopyID"`
+	UserID     uint       `json:"user_id"`
+	User       User       `json:"-" gorm:"foreignKey:UserID"`
+	BorrowDate time.Time  `json:"borrow_date"`
+	ReturnDate *time.Time `json:"return_date"`
+	DueDate    time.Time  `json:"due_date"`
+	RenewCount int        `json:"renew_count" gorm:"default:0"`
+	Returned   bool       `json:"returned" gorm:"default:false"`
+	FineAmount int64      `json:"fine_amount" gorm:"default:0"` // cents
+	FinePaid   bool       `json:"fine_paid" gorm:"default:false"`
+}
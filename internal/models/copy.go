@@ -0,0 +1,51 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	CopyStatusAvailable = "available"
+	CopyStatusOnLoan    = "on_loan"
+	CopyStatusOnHold    = "on_hold_shelf"
+	CopyStatusLost      = "lost"
+	CopyStatusInRepair  = "in_repair"
+)
+
+const (
+	ConditionNew  = "new"
+	ConditionGood = "good"
+	ConditionFair = "fair"
+	ConditionPoor = "poor"
+)
+
+// Copy is one physical item of a Title, identified by its barcode.
+type Copy struct {
+	gorm.Model
+	TitleID     uint   `json:"title_id"`
+	Title       Title  `json:"-" gorm:"foreignKey:TitleID"`
+	Barcode     string `json:"barcode" gorm:"unique"`
+	Location    string `json:"location"`
+	Condition   string `json:"condition" gorm:"default:good"`
+	Status      string `json:"status" gorm:"default:available"`
+	DonatedByID uint   `json:"donated_by_id"`
+	DonatedBy   User   `json:"-" gorm:"foreignKey:DonatedByID"`
+}
+
+func IsValidCopyStatus(status string) bool {
+	switch status {
+	case CopyStatusAvailable, CopyStatusOnLoan, CopyStatusOnHold, CopyStatusLost, CopyStatusInRepair:
+		return true
+	default:
+		return false
+	}
+}
+
+func IsValidCondition(condition string) bool {
+	switch condition {
+	case ConditionNew, ConditionGood, ConditionFair, ConditionPoor:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	DelegationBorrow = "borrow"
+	DelegationReturn = "return"
+	DelegationDonate = "donate"
+	// DelegationHold and DelegationCancelHold record a hold placed or
+	// cancelled for a patron.
+	DelegationHold       = "hold"
+	DelegationCancelHold = "cancel_hold"
+	DelegationRenew      = "renew"
+)
+
+// Delegation records a librarian borrowing, returning, renewing, donating
+// or managing holds on behalf of another user.
+type Delegation struct {
+	gorm.Model
+	ActorID  uint   `json:"actor_id"`
+	Actor    User   `json:"-" gorm:"foreignKey:ActorID"`
+	UserID   uint   `json:"user_id"`
+	User     User   `json:"-" gorm:"foreignKey:UserID"`
+	Action   string `json:"action"`
+	CopyID   *uint  `json:"copy_id"`   // nil for holds not yet set aside
+	BorrowID *uint  `json:"borrow_id"` // nil for donations and holds
+	HoldID   *uint  `json:"hold_id"`   // set for holds only
+}
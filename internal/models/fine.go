@@ -0,0 +1,39 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	FineKindCharge  = "charge"
+	FineKindPayment = "payment"
+	FineKindWaiver  = "waiver"
+	FineKindRefund  = "refund"
+)
+
+// FineTransaction is one entry in a patron's fines ledger. Amount is
+// always positive and in minor currency units (cents); Kind says whether
+// it adds to what the patron owes (charge, refund) or takes from it
+// (payment, waiver). Every entry belongs to the loan whose fine it
+// settles, so each fine can be followed to zero.
+type FineTransaction struct {
+	gorm.Model
+	UserID       uint   `json:"user_id"`
+	User         User   `json:"-" gorm:"foreignKey:UserID"`
+	BorrowID     uint   `json:"borrow_id"`
+	Borrow       Borrow `json:"-" gorm:"foreignKey:BorrowID"`
+	Kind         string `json:"kind"`
+	Amount       int64  `json:"amount"`
+	Reason       string `json:"reason"`
+	RecordedByID *uint  `json:"recorded_by_id"` // nil for charges made by the system
+}
+
+// Delta returns the change the entry makes to the patron's balance.
+func (t *FineTransaction) Delta() int64 {
+	switch t.Kind {
+	case FineKindPayment, FineKindWaiver:
+		return -t.Amount
+	default:
+		return t.Amount
+	}
+}
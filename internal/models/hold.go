@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	HoldStatusWaiting   = "waiting"
+	HoldStatusReady     = "ready"
+	HoldStatusFulfilled = "fulfilled"
+	HoldStatusCancelled = "cancelled"
+	HoldStatusExpired   = "expired"
+)
+
+// Hold is a patron's place in the FIFO queue for a title. When a copy is
+// returned it is set aside for the oldest waiting hold, which becomes
+// ready until PickupBy.
+type Hold struct {
+	gorm.Model
+	TitleID  uint       `json:"title_id"`
+	Title    Title      `json:"-" gorm:"foreignKey:TitleID"`
+	UserID   uint       `json:"user_id"`
+	User     User       `json:"-" gorm:"foreignKey:UserID"`
+	CopyID   *uint      `json:"copy_id"`
+	Status   string     `json:"status" gorm:"default:waiting"`
+	PlacedAt time.Time  `json:"placed_at"`
+	ReadyAt  *time.Time `json:"ready_at"`
+	PickupBy *time.Time `json:"pickup_by"`
+	ClosedAt *time.Time `json:"closed_at"`
+}
+
+// IsActive reports whether the hold is still queued or waiting for pickup.
+func (h *Hold) IsActive() bool {
+	return h.Status == HoldStatusWaiting || h.Status == HoldStatusReady
+}
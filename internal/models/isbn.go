@@ -0,0 +1,61 @@
+package models
+
+import (
+	"strings"
+)
+
+// NormalizeISBN checks the check digit of an ISBN-10 or ISBN-13, written
+// with or without hyphens or spaces, and returns it as the thirteen digits
+// of an ISBN-13. ISBN-10s become ISBN-13s under the 978 prefix, and
+// ISBN-13s must start with 978 or 979. It reports false when raw is not a
+// valid ISBN.
+func NormalizeISBN(raw string) (string, bool) {
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(raw))
+	switch len(isbn) {
+	case 10:
+		sum := 0
+		for i, r := range isbn {
+			d := int(r - '0')
+			if r == 'X' && i == 9 {
+				d = 10
+			} else if r < '0' || r > '9' {
+				return "", false
+			}
+			sum += (10 - i) * d
+		}
+		if sum%11 != 0 {
+			return "", false
+		}
+		isbn = "978" + isbn[:9]
+		return isbn + string(rune('0'+isbn13CheckDigit(isbn))), true
+	case 13:
+		for _, r := range isbn {
+			if r < '0' || r > '9' {
+				return "", false
+			}
+		}
+		if !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+			return "", false
+		}
+		if isbn13CheckDigit(isbn[:12]) != int(isbn[12]-'0') {
+			return "", false
+		}
+		return isbn, true
+	default:
+		return "", false
+	}
+}
+
+// isbn13CheckDigit returns the check digit for the first twelve digits of
+// an ISBN-13.
+func isbn13CheckDigit(digits string) int {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(digits[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
@@ -0,0 +1,23 @@
+package models
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	for _, tc := range []struct {
+		raw, want string
+		ok        bool
+	}{
+		{"0-441-01359-7", "9780441013593", true},
+		{"080442957x", "9780804429573", true},
+		{"978-0-441-01359-3", "9780441013593", true},
+		{"9791034749997", "9791034749997", true},
+		{"9780441013594", "", false},
+		{"1234567890128", "", false},
+		{"97804410135X3", "", false},
+	} {
+		got, ok := NormalizeISBN(tc.raw)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("NormalizeISBN(%q) = %q, %v; want %q, %v", tc.raw, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Outcomes of a sign-in attempt.
+const (
+	LoginSucceeded      = "succeeded"
+	LoginBadCredentials = "invalid_credentials"
+	LoginUnknownAccount = "unknown_account"
+	LoginBlocked        = "blocked"
+	LoginThrottled      = "throttled"
+	// LoginSecondFactor marks a right password from a user who must still
+	// give an authenticator code.
+	LoginSecondFactor    = "second_factor_required"
+	LoginBadSecondFactor = "invalid_second_factor"
+)
+
+// What a LoginThrottle counts failures for.
+const (
+	ThrottleAccount = "account"
+	ThrottleIP      = "ip"
+)
+
+// LoginAttempt records one sign-in attempt, successful or not, for
+// librarians to review.
+type LoginAttempt struct {
+	gorm.Model
+	Email     string `json:"email"`
+	UserID    *uint  `json:"user_id"` // nil when no account has this email
+	User      User   `json:"-" gorm:"foreignKey:UserID"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Success   bool   `json:"success"`
+	Outcome   string `json:"outcome"`
+}
+
+// LoginThrottle counts the recent failed sign-ins for one account email or
+// client address, and holds off further attempts until RetryAt.
+type LoginThrottle struct {
+	gorm.Model
+	Kind          string     `json:"kind" gorm:"uniqueIndex:idx_login_throttles_kind_value"`
+	Value         string     `json:"value" gorm:"uniqueIndex:idx_login_throttles_kind_value"`
+	Failures      int        `json:"failures"`
+	LastFailureAt *time.Time `json:"last_failure_at"`
+	RetryAt       *time.Time `json:"retry_at"`
+}
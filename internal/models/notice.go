@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	NoticeDueSoon = "due_soon"
+	NoticeOverdue = "overdue"
+	NoticeFinal   = "final"
+)
+
+// Notice records a reminder sent about a loan. RenewCount ties it to one
+// due date, so renewing a loan makes its reminders due again, while each
+// kind is sent at most once per due date.
+type Notice struct {
+	gorm.Model
+	BorrowID   uint      `json:"borrow_id" gorm:"uniqueIndex:idx_notices_borrow_kind"`
+	Borrow     Borrow    `json:"-" gorm:"foreignKey:BorrowID"`
+	UserID     uint      `json:"user_id"`
+	User       User      `json:"-" gorm:"foreignKey:UserID"`
+	Kind       string    `json:"kind" gorm:"uniqueIndex:idx_notices_borrow_kind"`
+	RenewCount int       `json:"renew_count" gorm:"uniqueIndex:idx_notices_borrow_kind"`
+	SentAt     time.Time `json:"sent_at"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+// Email events, each with a template in internal/notify/templates. The
+// loan reminders use the Notice kinds as their event names.
+const (
+	EventSignup = "signup"
+	EventBorrow = "borrow"
+	EventReturn = "return"
+	EventFine   = "fine"
+
+	EventVerifyEmail   = "verify_email"
+	EventPasswordReset = "password_reset"
+	EventAccountLocked = "account_locked"
+)
+
+// IsSensitiveEvent reports whether emails for event carry a secret, such
+// as a password reset token, that must not be shown in the outbox.
+func IsSensitiveEvent(event string) bool {
+	return event == EventVerifyEmail || event == EventPasswordReset || event == EventSignup
+}
+
+// OutboxMessage is an email written in the same transaction as the change
+// it reports and delivered afterwards by the outbox worker. Failed
+// deliveries are retried with backoff until the message is dead.
+type OutboxMessage struct {
+	gorm.Model
+	Event         string     `json:"event"`
+	UserID        *uint      `json:"user_id"`
+	User          User       `json:"-" gorm:"foreignKey:UserID"`
+	Recipient     string     `json:"recipient"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body"`
+	Status        string     `json:"status" gorm:"default:pending"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	SentAt        *time.Time `json:"sent_at"`
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Permissions guard the routes and actions that not every user may use.
+// Which roles hold them is stored in the role_permissions table.
+const (
+	PermBooksCreate      = "books:create"
+	PermBooksManage      = "books:manage"
+	PermBooksDonateAny   = "books:donate-any"
+	PermBorrowsCreateAny = "borrows:create-any"
+	PermBorrowsReturnAny = "borrows:return-any"
+	PermBorrowsRead      = "borrows:read"
+	PermPoliciesManage   = "policies:manage"
+	PermFinesRead        = "fines:read"
+	PermFinesCollect     = "fines:collect"
+	PermFinesWaive       = "fines:waive"
+	PermFinesRefund      = "fines:refund"
+	PermUsersRead        = "users:read"
+	PermUsersBlock       = "users:block"
+	PermUsersChangeRole  = "users:change-role"
+	PermDelegationsRead  = "delegations:read"
+	PermOutboxManage     = "outbox:manage"
+	PermRolesManage      = "roles:manage"
+	PermLoginsRead       = "logins:read"
+	PermKeysManage       = "keys:manage"
+)
+
+// AllPermissions lists every permission a role can be granted.
+var AllPermissions = []string{
+	PermBooksCreate,
+	PermBooksManage,
+	PermBooksDonateAny,
+	PermBorrowsCreateAny,
+	PermBorrowsReturnAny,
+	PermBorrowsRead,
+	PermPoliciesManage,
+	PermFinesRead,
+	PermFinesCollect,
+	PermFinesWaive,
+	PermFinesRefund,
+	PermUsersRead,
+	PermUsersBlock,
+	PermUsersChangeRole,
+	PermDelegationsRead,
+	PermOutboxManage,
+	PermRolesManage,
+	PermLoginsRead,
+	PermKeysManage,
+}
+
+func IsValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RolePermission grants one permission to every user with Role.
+type RolePermission struct {
+	gorm.Model
+	Role       string `json:"role" gorm:"uniqueIndex:idx_role_permissions_role_permission"`
+	Permission string `json:"permission" gorm:"uniqueIndex:idx_role_permissions_role_permission"`
+}
+
+// PermissionSet holds the permissions of one role.
+type PermissionSet map[string]bool
+
+func NewPermissionSet(permissions []string) PermissionSet {
+	set := make(PermissionSet, len(permissions))
+	for _, p := range permissions {
+		set[p] = true
+	}
+	return set
+}
+
+// Has reports whether the set holds any of permissions.
+func (s PermissionSet) Has(permissions ...string) bool {
+	for _, p := range permissions {
+		if s[p] {
+			return true
+		}
+	}
+	return false
+}
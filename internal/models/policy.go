@@ -0,0 +1,33 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// CirculationPolicy holds the lending rules for one patron role and item
+// genre. An empty Role or Genre matches any value; the most specific
+// policy wins, with Role weighing more than Genre.
+type CirculationPolicy struct {
+	gorm.Model
+	Role        string `json:"role" gorm:"uniqueIndex:idx_policies_role_genre"`
+	Genre       string `json:"genre" gorm:"uniqueIndex:idx_policies_role_genre"`
+	LoanDays    int    `json:"loan_days"`
+	MaxLoans    int    `json:"max_loans"` // 0 means no limit
+	FineRate    int64  `json:"fine_rate"` // cents per overdue day
+	FineCap     int64  `json:"fine_cap"`  // cents; 0 means no cap
+	GraceDays   int    `json:"grace_days"`
+	MaxRenewals int    `json:"max_renewals"`
+}
+
+// Fine returns the fine for a loan returned overdueDays days late. Days
+// inside the grace period are free, and the total never exceeds FineCap.
+func (p *CirculationPolicy) Fine(overdueDays int) int64 {
+	if overdueDays <= p.GraceDays {
+		return 0
+	}
+	fine := int64(overdueDays-p.GraceDays) * p.FineRate
+	if p.FineCap > 0 && fine > p.FineCap {
+		fine = p.FineCap
+	}
+	return fine
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCode is one of the single-use codes that let a user with
+// two-factor authentication sign in without their authenticator. Only a
+// SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint       `json:"user_id"`
+	User     User       `json:"-" gorm:"foreignKey:UserID"`
+	CodeHash string     `json:"-" gorm:"uniqueIndex"`
+	UsedAt   *time.Time `json:"used_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken is a refresh token handed out at sign-in or on refresh. Only
+// a SHA-256 hash of the token is stored. Each token is used once: a refresh
+// revokes it and issues its replacement.
+type RefreshToken struct {
+	gorm.Model
+	UserID       uint       `json:"user_id"`
+	User         User       `json:"-" gorm:"foreignKey:UserID"`
+	TokenHash    string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	ReplacedByID *uint      `json:"replaced_by_id"` // the token issued when this one was used
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Renewal records one extension of a Borrow's due date.
+type Renewal struct {
+	gorm.Model
+	BorrowID        uint      `json:"borrow_id"`
+	Borrow          Borrow    `json:"-" gorm:"foreignKey:BorrowID"`
+	RenewedByID     uint      `json:"renewed_by_id"`
+	RenewedBy       User      `json:"-" gorm:"foreignKey:RenewedByID"`
+	RenewedAt       time.Time `json:"renewed_at"`
+	PreviousDueDate time.Time `json:"previous_due_date"`
+	NewDueDate      time.Time `json:"new_due_date"`
+}
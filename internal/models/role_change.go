@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// RoleChange records one change to a user's role.
+type RoleChange struct {
+	gorm.Model
+	UserID      uint   `json:"user_id"`
+	User        User   `json:"-" gorm:"foreignKey:UserID"`
+	OldRole     string `json:"old_role"` // empty when the user was created with NewRole
+	NewRole     string `json:"new_role"`
+	Reason      string `json:"reason"`
+	ChangedByID *uint  `json:"changed_by_id"` // nil for the bootstrap librarian
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Algorithms access tokens can be signed with.
+const (
+	KeyAlgEdDSA = "EdDSA"
+	KeyAlgRS256 = "RS256"
+)
+
+func IsValidKeyAlgorithm(alg string) bool {
+	return alg == KeyAlgEdDSA || alg == KeyAlgRS256
+}
+
+// SigningKey is a key pair that access tokens are signed with; each token
+// names its key in the kid header. A key is published in the JWKS from
+// when it is created, signs tokens from ActivatesAt until a newer key
+// takes over, and is dropped once ExpiresAt has passed.
+type SigningKey struct {
+	gorm.Model
+	KID         string     `json:"kid" gorm:"column:kid;uniqueIndex"`
+	Algorithm   string     `json:"algorithm"`
+	PublicKey   string     `json:"-"` // PKIX DER, base64
+	PrivateKey  string     `json:"-"` // PKCS #8 DER, encrypted
+	ActivatesAt time.Time  `json:"activates_at"`
+	ExpiresAt   *time.Time `json:"expires_at"` // set once a newer key is created
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Title is the bibliographic record of a work. The physical items that can
+// be borrowed are its Copies.
+type Title struct {
+	gorm.Model
+	Title     string     `json:"title"`
+	Authors   StringList `json:"authors"`
+	ISBN      string     `json:"isbn" gorm:"index"`
+	Publisher string     `json:"publisher"`
+	Year      int        `json:"year"`
+	Language  string     `json:"language"`
+	Subjects  StringList `json:"subjects"`
+	Genre     string     `json:"genre"`
+	Copies    []Copy     `json:"-" gorm:"foreignKey:TitleID"`
+
+	// InvalidISBN holds an ISBN from before ISBNs were validated that
+	// could not be normalised, until a librarian replaces it.
+	InvalidISBN string `json:"invalid_isbn"`
+}
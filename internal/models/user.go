@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -12,12 +14,35 @@ const (
 
 type User struct {
 	gorm.Model
-	Name     string  `json:"name"`
-	Email    string  `json:"email" gorm:"unique"`
-	Password string  `json:"-"` 
-	Role     string  `json:"role"`
-	Penalty  float64 `json:"penalty" gorm:"default:0.0"` 
-	Blocked  bool    `json:"blocked" gorm:"default:false"`
+	Name     string `json:"name"`
+	Email    string `json:"email" gorm:"unique"`
+	Password string `json:"-"`
+	Role     string `json:"role"`
+	Penalty  int64  `json:"penalty" gorm:"default:0"` // outstanding fines in cents
+	Blocked  bool   `json:"blocked" gorm:"default:false"`
+	// BlockedManually marks a block placed by a librarian, which the
+	// automatic block rules never lift.
+	BlockedManually bool   `json:"blocked_manually" gorm:"default:false"`
+	BlockReason     string `json:"block_reason"`
+	// EmailVerified is set once the user proves they own Email. Unverified
+	// users can sign in but not borrow.
+	EmailVerified   bool       `json:"email_verified" gorm:"default:false"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// TokenVersion is carried in access tokens; bumping it ends every
+	// session of the user at once.
+	TokenVersion int `json:"-" gorm:"default:0"`
+	// TOTPSecret is the user's authenticator secret, encrypted. It is set
+	// when two-factor setup starts and only used once TOTPEnabled is.
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled" gorm:"default:false"`
+	// TOTPLastStep is the time step of the last code accepted, so that no
+	// code works twice.
+	TOTPLastStep int64 `json:"-" gorm:"default:0"`
+}
+
+// IsPatronRole reports whether role may be chosen at self-registration.
+func IsPatronRole(role string) bool {
+	return role == RoleStudent || role == RoleGeneral
 }
 
 func IsValidRole(role string) bool {
@@ -27,4 +52,4 @@ func IsValidRole(role string) bool {
 	default:
 		return false
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenPasswordReset = "password_reset"
+	// TokenTwoFactor is handed out when a password was right but an
+	// authenticator code is still needed to finish signing in.
+	TokenTwoFactor = "two_factor"
+)
+
+// UserToken records a single-use token emailed to a user to verify their
+// address or reset their password. The token itself is a signed JWT whose
+// ID is TokenID; the row makes sure it is only used once.
+type UserToken struct {
+	gorm.Model
+	UserID    uint       `json:"user_id"`
+	User      User       `json:"-" gorm:"foreignKey:UserID"`
+	Purpose   string     `json:"purpose"`
+	TokenID   string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
@@ -0,0 +1,119 @@
+// Package notify delivers messages to patrons.
+package notify
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text message to one recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier sends messages. Notify returns once the message has been handed
+// over, or with an error if it could not be.
+type Notifier interface {
+	Notify(msg Message) error
+}
+
+// SMTPNotifier sends messages through an SMTP server. Auth may be nil for
+// servers that accept mail without it, such as a local mail catcher.
+type SMTPNotifier struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func (n *SMTPNotifier) Notify(msg Message) error {
+	return smtp.SendMail(n.Addr, n.Auth, n.From, []string{headerValue(msg.To)}, n.message(msg, time.Now()))
+}
+
+// message formats msg as an email sent at date. The subject can hold a
+// patron's name or a book title, so it is encoded rather than written raw.
+func (n *SMTPNotifier) message(msg Message, date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(n.From))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(msg.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerLineBreaks replaces the line breaks that would let a header value
+// start headers of its own.
+var headerLineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+func headerValue(v string) string {
+	return headerLineBreaks.Replace(v)
+}
+
+// LogNotifier writes messages to w instead of sending them.
+type LogNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogNotifier(w io.Writer) *LogNotifier {
+	return &LogNotifier{w: w}
+}
+
+func (n *LogNotifier) Notify(msg Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err := fmt.Fprintf(n.w, "--- %s\nTo: %s\nSubject: %s\n\n%s\n", time.Now().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// FromEnv builds the Notifier selected by NOTIFIER:
+//
+//   - "log" (the default) writes messages to NOTIFY_LOG_FILE, or to
+//     standard output if that is empty.
+//   - "smtp" sends them through SMTP_ADDR (default localhost:1025) as
+//     SMTP_FROM, authenticating with SMTP_USERNAME and SMTP_PASSWORD if set.
+func FromEnv() Notifier {
+	switch kind := os.Getenv("NOTIFIER"); kind {
+	case "", "log":
+		path := os.Getenv("NOTIFY_LOG_FILE")
+		if path == "" {
+			return NewLogNotifier(os.Stdout)
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("Failed to open NOTIFY_LOG_FILE: %v", err)
+		}
+		return NewLogNotifier(f)
+	case "smtp":
+		n := &SMTPNotifier{Addr: os.Getenv("SMTP_ADDR"), From: os.Getenv("SMTP_FROM")}
+		if n.Addr == "" {
+			n.Addr = "localhost:1025"
+		}
+		if n.From == "" {
+			n.From = "library@localhost"
+		}
+		if user := os.Getenv("SMTP_USERNAME"); user != "" {
+			host, _, err := net.SplitHostPort(n.Addr)
+			if err != nil {
+				log.Fatalf("SMTP_ADDR must be host:port, got %q", n.Addr)
+			}
+			n.Auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		return n
+	default:
+		log.Fatalf("NOTIFIER must be log or smtp, got %q", kind)
+		return nil
+	}
+}
@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSMTPMessageHeadersCannotBeInjected(t *testing.T) {
+	n := &SMTPNotifier{From: "library@example.com"}
+	raw := string(n.message(Message{
+		To:      "patron@example.com",
+		Subject: "Loan receipt: Dune\r\nBcc: victim@example.com",
+		Body:    "Hello",
+	}, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+	headers, _, ok := strings.Cut(raw, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("message has no header section: %q", raw)
+	}
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Errorf("subject injected a header: %q", headers)
+		}
+	}
+	if want := "Subject: Loan receipt: Dune Bcc: victim@example.com\r\n"; !strings.Contains(headers+"\r\n", want) {
+		t.Errorf("got headers %q, want %q", headers, want)
+	}
+}
+
+func TestSMTPMessageEncodesSubject(t *testing.T) {
+	n := &SMTPNotifier{From: "library@example.com"}
+	raw := string(n.message(Message{To: "patron@example.com", Subject: "Reçu de prêt", Body: "Bonjour"}, time.Now()))
+	if want := "Subject: =?utf-8?q?Re=C3=A7u_de_pr=C3=AAt?=\r\n"; !strings.Contains(raw, want) {
+		t.Errorf("got message %q, want it to contain %q", raw, want)
+	}
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// templates maps each event name to its parsed template file, which
+// defines a "subject" and a "body" template.
+var templates = parseTemplates()
+
+var templateFuncs = template.FuncMap{
+	"date": func(t time.Time) string { return t.Format("Monday 2 January 2006") },
+	"money": func(cents int64) string {
+		sign := ""
+		if cents < 0 {
+			sign, cents = "-", -cents
+		}
+		return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+	},
+}
+
+func parseTemplates() map[string]*template.Template {
+	files, err := fs.Glob(templateFS, "templates/*.tmpl")
+	if err != nil {
+		panic(err)
+	}
+	parsed := make(map[string]*template.Template, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".tmpl")
+		parsed[name] = template.Must(template.New(name).Funcs(templateFuncs).ParseFS(templateFS, file))
+	}
+	return parsed
+}
+
+// Render fills in the subject and body templates of event with data. The
+// subject is kept to one line, since names and titles in data may hold
+// line breaks.
+func Render(event string, data any) (subject, body string, err error) {
+	t, ok := templates[event]
+	if !ok {
+		return "", "", fmt.Errorf("no template for event %q", event)
+	}
+	var s, b strings.Builder
+	if err := t.ExecuteTemplate(&s, "subject", data); err != nil {
+		return "", "", err
+	}
+	if err := t.ExecuteTemplate(&b, "body", data); err != nil {
+		return "", "", err
+	}
+	return headerValue(strings.TrimSpace(s.String())), b.String(), nil
+}
@@ -0,0 +1,22 @@
+package notify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenderKeepsSubjectOnOneLine(t *testing.T) {
+	subject, _, err := Render("borrow", map[string]any{
+		"Name":       "Ada",
+		"Title":      "Dune\r\nBcc: victim@example.com",
+		"Barcode":    "B1",
+		"BorrowDate": time.Now(),
+		"DueDate":    time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Loan receipt: Dune Bcc: victim@example.com"; subject != want {
+		t.Errorf("got subject %q, want %q", subject, want)
+	}
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// FacetCount is how many titles share one value of a facet, and how many
+// of those have a copy available.
+type FacetCount struct {
+	Value     string `json:"value"`
+	Count     int64  `json:"count"`
+	Available int64  `json:"available"`
+}
+
+// DonorFacetCount is a FacetCount for the titles with a copy donated by
+// one user.
+type DonorFacetCount struct {
+	DonorID   uint   `json:"donor_id"`
+	Name      string `json:"name"`
+	Count     int64  `json:"count"`
+	Available int64  `json:"available"`
+}
+
+// TitleFacets breaks the titles matching a filter down by genre, author,
+// decade of publication and donor, each most common first. Titles with
+// no year count towards no decade.
+type TitleFacets struct {
+	Genres  []FacetCount      `json:"genres"`
+	Authors []FacetCount      `json:"authors"`
+	Decades []FacetCount      `json:"decades"`
+	Donors  []DonorFacetCount `json:"donors"`
+}
+
+// titleDonor is one user who donated a copy of one title.
+type titleDonor struct {
+	TitleID uint
+	DonorID uint
+	Name    string
+}
+
+// countFacets builds the facets of titles from their summaries and donors.
+func countFacets(summaries []TitleSummary, donors []titleDonor) *TitleFacets {
+	genres := make(map[string]*FacetCount)
+	authors := make(map[string]*FacetCount)
+	decades := make(map[string]*FacetCount)
+	add := func(m map[string]*FacetCount, value string, available bool) {
+		if value == "" {
+			return
+		}
+		f := m[value]
+		if f == nil {
+			f = &FacetCount{Value: value}
+			m[value] = f
+		}
+		f.Count++
+		if available {
+			f.Available++
+		}
+	}
+
+	available := make(map[uint]bool, len(summaries))
+	for _, s := range summaries {
+		avail := s.AvailableCopies > 0
+		available[s.ID] = avail
+		add(genres, s.Genre, avail)
+		for _, author := range slices.Compact(slices.Sorted(slices.Values(s.Authors))) {
+			add(authors, author, avail)
+		}
+		if s.Year > 0 {
+			add(decades, strconv.Itoa(s.Year/10*10)+"s", avail)
+		}
+	}
+
+	byDonor := make(map[uint]*DonorFacetCount)
+	counted := make(map[string]bool)
+	for _, d := range donors {
+		key := fmt.Sprint(d.TitleID, "/", d.DonorID)
+		if counted[key] {
+			continue
+		}
+		counted[key] = true
+		f := byDonor[d.DonorID]
+		if f == nil {
+			f = &DonorFacetCount{DonorID: d.DonorID, Name: d.Name}
+			byDonor[d.DonorID] = f
+		}
+		f.Count++
+		if available[d.TitleID] {
+			f.Available++
+		}
+	}
+
+	facets := &TitleFacets{
+		Genres:  sortedFacets(genres),
+		Authors: sortedFacets(authors),
+		Decades: sortedFacets(decades),
+		Donors:  make([]DonorFacetCount, 0, len(byDonor)),
+	}
+	for _, f := range byDonor {
+		facets.Donors = append(facets.Donors, *f)
+	}
+	slices.SortFunc(facets.Donors, func(a, b DonorFacetCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.DonorID, b.DonorID)
+	})
+	return facets
+}
+
+func sortedFacets(m map[string]*FacetCount) []FacetCount {
+	out := make([]FacetCount, 0, len(m))
+	for _, f := range m {
+		out = append(out, *f)
+	}
+	slices.SortFunc(out, func(a, b FacetCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Value, b.Value)
+	})
+	return out
+}
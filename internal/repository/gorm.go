@@ -0,0 +1,1119 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"library-management/internal/models"
+)
+
+type gormStore struct {
+	db *gorm.DB
+	// index serves catalog searches on databases other than PostgreSQL.
+	index *titleIndex
+}
+
+// NewGormStore returns a Store backed by the given GORM connection.
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db, index: &titleIndex{}}
+}
+
+func (s *gormStore) Titles() TitleRepository {
+	return &gormTitleRepository{db: s.db, index: s.index}
+}
+func (s *gormStore) Copies() CopyRepository            { return &gormCopyRepository{db: s.db} }
+func (s *gormStore) Users() UserRepository             { return &gormUserRepository{db: s.db} }
+func (s *gormStore) Borrows() BorrowRepository         { return &gormBorrowRepository{db: s.db} }
+func (s *gormStore) Holds() HoldRepository             { return &gormHoldRepository{db: s.db} }
+func (s *gormStore) Renewals() RenewalRepository       { return &gormRenewalRepository{db: s.db} }
+func (s *gormStore) Policies() PolicyRepository        { return &gormPolicyRepository{db: s.db} }
+func (s *gormStore) Fines() FineRepository             { return &gormFineRepository{db: s.db} }
+func (s *gormStore) Blocks() BlockEventRepository      { return &gormBlockEventRepository{db: s.db} }
+func (s *gormStore) Notices() NoticeRepository         { return &gormNoticeRepository{db: s.db} }
+func (s *gormStore) Outbox() OutboxRepository          { return &gormOutboxRepository{db: s.db} }
+func (s *gormStore) RoleChanges() RoleChangeRepository { return &gormRoleChangeRepository{db: s.db} }
+func (s *gormStore) Delegations() DelegationRepository { return &gormDelegationRepository{db: s.db} }
+func (s *gormStore) Permissions() PermissionRepository { return &gormPermissionRepository{db: s.db} }
+func (s *gormStore) UserTokens() UserTokenRepository   { return &gormUserTokenRepository{db: s.db} }
+func (s *gormStore) RefreshTokens() RefreshTokenRepository {
+	return &gormRefreshTokenRepository{db: s.db}
+}
+func (s *gormStore) LoginAttempts() LoginAttemptRepository {
+	return &gormLoginAttemptRepository{db: s.db}
+}
+func (s *gormStore) LoginThrottles() LoginThrottleRepository {
+	return &gormLoginThrottleRepository{db: s.db}
+}
+func (s *gormStore) RecoveryCodes() RecoveryCodeRepository {
+	return &gormRecoveryCodeRepository{db: s.db}
+}
+func (s *gormStore) SigningKeys() SigningKeyRepository {
+	return &gormSigningKeyRepository{db: s.db}
+}
+
+func (s *gormStore) Transaction(fn func(tx Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx, index: s.index})
+	})
+}
+
+// translate maps GORM's not-found error onto ErrNotFound so callers never
+// have to import gorm.
+func translate(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func forUpdate(db *gorm.DB) *gorm.DB {
+	return db.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+type gormTitleRepository struct {
+	db    *gorm.DB
+	index *titleIndex
+}
+
+func (r *gormTitleRepository) Create(title *models.Title) error {
+	return r.db.Create(title).Error
+}
+
+func (r *gormTitleRepository) FindByID(id uint) (*models.Title, error) {
+	var title models.Title
+	if err := r.db.First(&title, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &title, nil
+}
+
+func (r *gormTitleRepository) FindAny(id uint) (*models.Title, error) {
+	var title models.Title
+	if err := r.db.Unscoped().First(&title, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &title, nil
+}
+
+func (r *gormTitleRepository) Lock(id uint) (*models.Title, error) {
+	var title models.Title
+	if err := forUpdate(r.db.Unscoped()).First(&title, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &title, nil
+}
+
+func (r *gormTitleRepository) Update(title *models.Title) error {
+	return r.db.Unscoped().Model(title).
+		Select("title", "authors", "isbn", "invalid_isbn", "publisher", "year", "language", "subjects", "genre").
+		Updates(title).Error
+}
+
+func (r *gormTitleRepository) Withdraw(id uint) error {
+	return r.db.Delete(&models.Title{}, id).Error
+}
+
+func (r *gormTitleRepository) Restore(id uint) error {
+	return r.db.Unscoped().Model(&models.Title{}).Where("id = ?", id).Update("deleted_at", nil).Error
+}
+
+func (r *gormTitleRepository) FindByISBN(isbn string) (*models.Title, error) {
+	var title models.Title
+	if err := r.db.Where("isbn = ?", isbn).First(&title).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &title, nil
+}
+
+func (r *gormTitleRepository) FindAnyByISBN(isbn string) (*models.Title, error) {
+	var title models.Title
+	if err := r.db.Unscoped().Where("isbn = ?", isbn).First(&title).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &title, nil
+}
+
+// titleSortColumns maps each catalog sort key to its column.
+var titleSortColumns = map[string]string{
+	TitleSortTitle: "titles.title",
+	TitleSortYear:  "titles.year",
+	TitleSortGenre: "titles.genre",
+	TitleSortAdded: "titles.id",
+}
+
+func (c *TitleCursor) value(key string) any {
+	switch key {
+	case TitleSortTitle:
+		return c.Title
+	case TitleSortYear:
+		return c.Year
+	case TitleSortGenre:
+		return c.Genre
+	default:
+		return c.ID
+	}
+}
+
+// likeEscaper escapes the wildcards of LIKE, for patterns used with
+// ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func filterTitles(db *gorm.DB, filter TitleFilter) *gorm.DB {
+	if filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(filter.Search)) + "%"
+		db = db.Where(`(LOWER(titles.title) LIKE ? ESCAPE '\' OR LOWER(titles.authors) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	if filter.Genre != "" {
+		db = db.Where("titles.genre = ?", filter.Genre)
+	}
+	if filter.ISBN != "" {
+		db = db.Where("titles.isbn = ?", filter.ISBN)
+	}
+	if filter.Available != nil {
+		exists := "EXISTS (SELECT 1 FROM copies WHERE copies.title_id = titles.id AND copies.status = ? AND copies.deleted_at IS NULL)"
+		if !*filter.Available {
+			exists = "NOT " + exists
+		}
+		db = db.Where(exists, models.CopyStatusAvailable)
+	}
+	if filter.DonorID != 0 {
+		db = db.Where("EXISTS (SELECT 1 FROM copies WHERE copies.title_id = titles.id AND copies.donated_by_id = ? AND copies.deleted_at IS NULL)", filter.DonorID)
+	}
+	return db
+}
+
+// withCopyCounts selects the titles of db with the counts of their copies,
+// as TitleSummary rows.
+func withCopyCounts(db *gorm.DB) *gorm.DB {
+	return db.
+		Select("titles.*, COUNT(copies.id) AS total_copies, "+
+			"COALESCE(SUM(CASE WHEN copies.status = ? THEN 1 ELSE 0 END), 0) AS available_copies", models.CopyStatusAvailable).
+		Joins("LEFT JOIN copies ON copies.title_id = titles.id AND copies.deleted_at IS NULL").
+		Group("titles.id")
+}
+
+// titleKeyset returns the condition for the titles past cursor in the
+// given order, or before it when before is set.
+func titleKeyset(order []TitleSort, cursor *TitleCursor, before bool) (string, []any) {
+	var or []string
+	var args []any
+	for i, key := range order {
+		var and []string
+		for _, prev := range order[:i] {
+			and = append(and, titleSortColumns[prev.Key]+" = ?")
+			args = append(args, cursor.value(prev.Key))
+		}
+		op := " > ?"
+		if key.Desc != before {
+			op = " < ?"
+		}
+		and = append(and, titleSortColumns[key.Key]+op)
+		args = append(args, cursor.value(key.Key))
+		or = append(or, "("+strings.Join(and, " AND ")+")")
+	}
+	return "(" + strings.Join(or, " OR ") + ")", args
+}
+
+func (r *gormTitleRepository) ListSummaries(query TitleQuery) ([]TitleSummary, error) {
+	order := withTieBreak(query.Sort)
+	db := withCopyCounts(filterTitles(r.db.Model(&models.Title{}), query.TitleFilter))
+	// A page before the cursor is read backwards from it and turned
+	// around afterwards.
+	backward := query.Before != nil
+	if query.After != nil {
+		cond, args := titleKeyset(order, query.After, false)
+		db = db.Where(cond, args...)
+	}
+	if backward {
+		cond, args := titleKeyset(order, query.Before, true)
+		db = db.Where(cond, args...)
+	}
+	for _, key := range order {
+		dir := " ASC"
+		if key.Desc != backward {
+			dir = " DESC"
+		}
+		db = db.Order(titleSortColumns[key.Key] + dir)
+	}
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+
+	var summaries []TitleSummary
+	if err := db.Scan(&summaries).Error; err != nil {
+		return nil, err
+	}
+	if backward {
+		slices.Reverse(summaries)
+	}
+	return summaries, nil
+}
+
+func (r *gormTitleRepository) CountSummaries(filter TitleFilter) (int64, error) {
+	var n int64
+	err := filterTitles(r.db.Model(&models.Title{}), filter).Count(&n).Error
+	return n, err
+}
+
+func (r *gormTitleRepository) Facets(filter TitleFilter) (*TitleFacets, error) {
+	var summaries []TitleSummary
+	if err := withCopyCounts(filterTitles(r.db.Model(&models.Title{}), filter)).Scan(&summaries).Error; err != nil {
+		return nil, err
+	}
+	var donors []titleDonor
+	err := r.db.Model(&models.Copy{}).
+		Distinct("copies.title_id, copies.donated_by_id AS donor_id, users.name").
+		Joins("JOIN users ON users.id = copies.donated_by_id").
+		Where("copies.title_id IN (?)", filterTitles(r.db.Model(&models.Title{}), filter).Select("titles.id")).
+		Scan(&donors).Error
+	if err != nil {
+		return nil, err
+	}
+	return countFacets(summaries, donors), nil
+}
+
+// titleSearchSQL searches the search_vector column, with word similarity
+// to the title and authors for misspellings. Highlights come from
+// ts_headline, which only marks words the text search matched.
+const titleSearchSQL = `
+SELECT titles.*,
+    (SELECT COUNT(*) FROM copies WHERE copies.title_id = titles.id AND copies.deleted_at IS NULL) AS total_copies,
+    (SELECT COUNT(*) FROM copies WHERE copies.title_id = titles.id AND copies.deleted_at IS NULL
+        AND copies.status = @available) AS available_copies,
+    ts_rank(titles.search_vector, websearch_to_tsquery('english', @query))
+        + GREATEST(word_similarity(@query, titles.title), word_similarity(@query, titles.authors)) AS rank,
+    ts_headline('english', titles.title, websearch_to_tsquery('english', @query),
+        'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') AS title_highlight,
+    ts_headline('english',
+        COALESCE((SELECT string_agg(author, ', ')
+            FROM json_array_elements_text(COALESCE(NULLIF(titles.authors, ''), '[]')::json) AS author), ''),
+        websearch_to_tsquery('english', @query),
+        'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') AS authors_highlight
+FROM titles
+WHERE titles.deleted_at IS NULL
+    AND (titles.search_vector @@ websearch_to_tsquery('english', @query)
+        OR @query <% titles.title
+        OR @query <% titles.authors)
+ORDER BY rank DESC, titles.id
+LIMIT @limit`
+
+func (r *gormTitleRepository) Search(query string, limit int) ([]TitleHit, error) {
+	if r.db.Dialector.Name() != "postgres" {
+		return r.searchIndex(query, limit)
+	}
+	var rows []struct {
+		TitleSummary
+		Rank             float64
+		TitleHighlight   string
+		AuthorsHighlight string
+	}
+	err := r.db.Raw(titleSearchSQL, map[string]any{
+		"query":     query,
+		"available": models.CopyStatusAvailable,
+		"limit":     limit,
+	}).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]TitleHit, 0, len(rows))
+	for _, row := range rows {
+		hits = append(hits, TitleHit{
+			TitleSummary: row.TitleSummary,
+			Rank:         row.Rank,
+			Highlights: TitleHighlights{
+				Title:   escapeHighlight(row.TitleHighlight),
+				Authors: escapeHighlight(row.AuthorsHighlight),
+			},
+		})
+	}
+	return hits, nil
+}
+
+// searchIndex searches the in-process index, which is rebuilt when a
+// title has been added, changed or removed since it was built.
+func (r *gormTitleRepository) searchIndex(query string, limit int) ([]TitleHit, error) {
+	var stamp struct {
+		Count       int64
+		LastID      sql.NullString
+		LastUpdate  sql.NullString
+		LastRemoval sql.NullString
+	}
+	err := r.db.Unscoped().Model(&models.Title{}).
+		Select("COUNT(*) AS count, MAX(id) AS last_id, MAX(updated_at) AS last_update, MAX(deleted_at) AS last_removal").
+		Scan(&stamp).Error
+	if err != nil {
+		return nil, err
+	}
+	index, err := r.index.get(fmt.Sprint(stamp), func() ([]models.Title, error) {
+		var titles []models.Title
+		err := r.db.Find(&titles).Error
+		return titles, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hits := index.Search(query, limit)
+	if len(hits) == 0 {
+		return []TitleHit{}, nil
+	}
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	var summaries []TitleSummary
+	err = withCopyCounts(r.db.Model(&models.Title{}).Where("titles.id IN ?", ids)).Scan(&summaries).Error
+	if err != nil {
+		return nil, err
+	}
+	return titleHits(hits, summaries), nil
+}
+
+type gormCopyRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormCopyRepository) Create(cp *models.Copy) error {
+	return r.db.Create(cp).Error
+}
+
+func (r *gormCopyRepository) FindByID(id uint) (*models.Copy, error) {
+	var cp models.Copy
+	if err := r.db.First(&cp, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &cp, nil
+}
+
+func (r *gormCopyRepository) FindByBarcode(barcode string) (*models.Copy, error) {
+	var cp models.Copy
+	if err := r.db.Unscoped().Where("barcode = ?", barcode).First(&cp).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &cp, nil
+}
+
+func (r *gormCopyRepository) ListByTitle(titleID uint) ([]models.Copy, error) {
+	var copies []models.Copy
+	if err := r.db.Where("title_id = ?", titleID).Order("id").Find(&copies).Error; err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+func (r *gormCopyRepository) ListAnyByTitle(titleID uint) ([]models.Copy, error) {
+	var copies []models.Copy
+	if err := r.db.Unscoped().Where("title_id = ?", titleID).Order("id").Find(&copies).Error; err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+func (r *gormCopyRepository) LockByTitle(titleID uint) ([]models.Copy, error) {
+	var copies []models.Copy
+	if err := forUpdate(r.db).Where("title_id = ?", titleID).Order("id").Find(&copies).Error; err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+func (r *gormCopyRepository) WithdrawByTitle(titleID uint) error {
+	return r.db.Where("title_id = ?", titleID).Delete(&models.Copy{}).Error
+}
+
+func (r *gormCopyRepository) RestoreByTitle(titleID uint) error {
+	return r.db.Unscoped().Model(&models.Copy{}).Where("title_id = ?", titleID).Update("deleted_at", nil).Error
+}
+
+func (r *gormCopyRepository) LockAvailable(id uint) (*models.Copy, error) {
+	var cp models.Copy
+	if err := forUpdate(r.db).Where("id = ? AND status = ?", id, models.CopyStatusAvailable).First(&cp).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &cp, nil
+}
+
+func (r *gormCopyRepository) LockAvailableForTitle(titleID uint) (*models.Copy, error) {
+	var cp models.Copy
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("title_id = ? AND status = ?", titleID, models.CopyStatusAvailable).
+		Order("id").
+		First(&cp).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &cp, nil
+}
+
+func (r *gormCopyRepository) SetStatus(id uint, status string) error {
+	return r.db.Model(&models.Copy{}).Where("id = ?", id).Update("status", status).Error
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormUserRepository) Create(user *models.User) error {
+	return r.db.Create(user).Error
+}
+
+func (r *gormUserRepository) FindByID(id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.First(&user, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByEmail(email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) LockActive(id uint) (*models.User, error) {
+	var user models.User
+	if err := forUpdate(r.db).Where("id = ? AND blocked = ?", id, false).First(&user).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) Lock(id uint) (*models.User, error) {
+	var user models.User
+	if err := forUpdate(r.db).First(&user, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) AddPenalty(id uint, amount int64) error {
+	// Increment in SQL rather than read-modify-write so concurrent updates
+	// for the same patron cannot lose an amount.
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("penalty", gorm.Expr("penalty + ?", amount)).Error
+}
+
+func (r *gormUserRepository) SetRole(id uint, role string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("role", role).Error
+}
+
+func (r *gormUserRepository) LockByRole(role string) ([]uint, error) {
+	var ids []uint
+	err := forUpdate(r.db).Model(&models.User{}).Where("role = ?", role).Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *gormUserRepository) SetPassword(id uint, hash string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("password", hash).Error
+}
+
+func (r *gormUserRepository) MarkEmailVerified(id uint, at time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]any{"email_verified": true, "email_verified_at": at}).Error
+}
+
+func (r *gormUserRepository) BumpTokenVersion(id uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("token_version", gorm.Expr("token_version + 1")).Error
+}
+
+func (r *gormUserRepository) SaveTwoFactor(user *models.User) error {
+	return r.db.Model(user).Select("totp_secret", "totp_enabled", "totp_last_step").Updates(user).Error
+}
+
+func (r *gormUserRepository) ListWithTOTPSecret() ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.User{}).Where("totp_secret <> ''").Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *gormUserRepository) SaveBlock(user *models.User) error {
+	return r.db.Model(user).Select("blocked", "blocked_manually", "block_reason").Updates(user).Error
+}
+
+func (r *gormUserRepository) ListForBlockReview(review BlockReview) ([]uint, error) {
+	cond := r.db.Where("blocked = ? AND blocked_manually = ?", true, false)
+	if review.MinPenalty > 0 {
+		cond = cond.Or("penalty >= ?", review.MinPenalty)
+	}
+	if !review.DueBefore.IsZero() {
+		overdue := r.db.Model(&models.Borrow{}).Select("user_id").Where("returned = ? AND due_date < ?", false, review.DueBefore)
+		cond = cond.Or("id IN (?)", overdue)
+	}
+	var ids []uint
+	err := r.db.Model(&models.User{}).Where(cond).Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+type gormBorrowRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormBorrowRepository) Create(borrow *models.Borrow) error {
+	return r.db.Create(borrow).Error
+}
+
+func (r *gormBorrowRepository) Save(borrow *models.Borrow) error {
+	return r.db.Save(borrow).Error
+}
+
+func (r *gormBorrowRepository) FindByID(id uint) (*models.Borrow, error) {
+	var borrow models.Borrow
+	if err := r.db.First(&borrow, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &borrow, nil
+}
+
+func (r *gormBorrowRepository) CountActiveByUser(userID uint, genre string) (int64, error) {
+	var count int64
+	query := r.db.Model(&models.Borrow{}).Where("borrows.user_id = ? AND borrows.returned = ?", userID, false)
+	if genre != "" {
+		query = query.
+			Joins("JOIN copies ON copies.id = borrows.copy_id").
+			Joins("JOIN titles ON titles.id = copies.title_id").
+			Where("titles.genre = ?", genre)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+func (r *gormBorrowRepository) FindActiveForTitle(userID, titleID uint) (*models.Borrow, error) {
+	var borrow models.Borrow
+	err := r.db.
+		Joins("JOIN copies ON copies.id = borrows.copy_id").
+		Where("borrows.user_id = ? AND borrows.returned = ? AND copies.title_id = ?", userID, false, titleID).
+		First(&borrow).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &borrow, nil
+}
+
+func (r *gormBorrowRepository) LockActive(id uint) (*models.Borrow, error) {
+	var borrow models.Borrow
+	if err := forUpdate(r.db).Where("id = ? AND returned = ?", id, false).First(&borrow).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &borrow, nil
+}
+
+type gormHoldRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormHoldRepository) Create(hold *models.Hold) error {
+	return r.db.Create(hold).Error
+}
+
+func (r *gormHoldRepository) Save(hold *models.Hold) error {
+	return r.db.Save(hold).Error
+}
+
+func (r *gormHoldRepository) FindByID(id uint) (*models.Hold, error) {
+	var hold models.Hold
+	if err := r.db.First(&hold, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &hold, nil
+}
+
+func (r *gormHoldRepository) Lock(id uint) (*models.Hold, error) {
+	var hold models.Hold
+	if err := forUpdate(r.db).First(&hold, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &hold, nil
+}
+
+func (r *gormHoldRepository) FindActive(userID, titleID uint) (*models.Hold, error) {
+	var hold models.Hold
+	err := r.db.Where("user_id = ? AND title_id = ? AND status IN ?", userID, titleID,
+		[]string{models.HoldStatusWaiting, models.HoldStatusReady}).First(&hold).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &hold, nil
+}
+
+func (r *gormHoldRepository) LockNextWaiting(titleID uint) (*models.Hold, error) {
+	var hold models.Hold
+	err := forUpdate(r.db).Where("title_id = ? AND status = ?", titleID, models.HoldStatusWaiting).
+		Order("id").First(&hold).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &hold, nil
+}
+
+func (r *gormHoldRepository) LockExpired(now time.Time) ([]models.Hold, error) {
+	var holds []models.Hold
+	err := forUpdate(r.db).Where("status = ? AND pickup_by < ?", models.HoldStatusReady, now).
+		Order("id").Find(&holds).Error
+	if err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+func (r *gormHoldRepository) QueuePosition(hold *models.Hold) (int64, error) {
+	var ahead int64
+	err := r.db.Model(&models.Hold{}).
+		Where("title_id = ? AND status = ? AND id < ?", hold.TitleID, models.HoldStatusWaiting, hold.ID).
+		Count(&ahead).Error
+	return ahead + 1, err
+}
+
+func (r *gormHoldRepository) List(filter HoldFilter) ([]models.Hold, error) {
+	query := r.db.Order("id")
+	if filter.TitleID != 0 {
+		query = query.Where("title_id = ?", filter.TitleID)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	statuses := filter.Statuses
+	if len(statuses) == 0 {
+		statuses = []string{models.HoldStatusWaiting, models.HoldStatusReady}
+	}
+	var holds []models.Hold
+	if err := query.Where("status IN ?", statuses).Find(&holds).Error; err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+func (r *gormBorrowRepository) CountOverdueByUser(userID uint, dueBefore time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Borrow{}).
+		Where("user_id = ? AND returned = ? AND due_date < ?", userID, false, dueBefore).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormBorrowRepository) ListActiveDueBefore(dueBefore time.Time) ([]models.Borrow, error) {
+	var borrows []models.Borrow
+	err := r.db.Where("returned = ? AND due_date < ?", false, dueBefore).Order("due_date, id").Find(&borrows).Error
+	return borrows, err
+}
+
+type gormRenewalRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRenewalRepository) Create(renewal *models.Renewal) error {
+	return r.db.Create(renewal).Error
+}
+
+func (r *gormRenewalRepository) ListByBorrow(borrowID uint) ([]models.Renewal, error) {
+	var renewals []models.Renewal
+	if err := r.db.Where("borrow_id = ?", borrowID).Order("id").Find(&renewals).Error; err != nil {
+		return nil, err
+	}
+	return renewals, nil
+}
+
+type gormFineRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormFineRepository) Create(entry *models.FineTransaction) error {
+	return r.db.Create(entry).Error
+}
+
+func (r *gormFineRepository) ListByUser(userID uint) ([]models.FineTransaction, error) {
+	var entries []models.FineTransaction
+	if err := r.db.Where("user_id = ?", userID).Order("id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+type gormBlockEventRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormBlockEventRepository) Create(event *models.BlockEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *gormBlockEventRepository) ListByUser(userID uint) ([]models.BlockEvent, error) {
+	var events []models.BlockEvent
+	if err := r.db.Where("user_id = ?", userID).Order("id").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+type gormNoticeRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormNoticeRepository) Create(notice *models.Notice) error {
+	return r.db.Create(notice).Error
+}
+
+func (r *gormNoticeRepository) Exists(borrowID uint, kind string, renewCount int) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Notice{}).
+		Where("borrow_id = ? AND kind = ? AND renew_count = ?", borrowID, kind, renewCount).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormNoticeRepository) ListByBorrow(borrowID uint) ([]models.Notice, error) {
+	var notices []models.Notice
+	if err := r.db.Where("borrow_id = ?", borrowID).Order("id").Find(&notices).Error; err != nil {
+		return nil, err
+	}
+	return notices, nil
+}
+
+type gormOutboxRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormOutboxRepository) Create(msg *models.OutboxMessage) error {
+	return r.db.Create(msg).Error
+}
+
+func (r *gormOutboxRepository) Save(msg *models.OutboxMessage) error {
+	return r.db.Save(msg).Error
+}
+
+func (r *gormOutboxRepository) FindByID(id uint) (*models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+	if err := r.db.First(&msg, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &msg, nil
+}
+
+func (r *gormOutboxRepository) LockDue(now time.Time, limit int) ([]models.OutboxMessage, error) {
+	var msgs []models.OutboxMessage
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND next_attempt_at <= ?", models.OutboxPending, now).
+		Order("next_attempt_at, id").
+		Limit(limit).
+		Find(&msgs).Error
+	return msgs, err
+}
+
+func (r *gormOutboxRepository) List(status string) ([]models.OutboxMessage, error) {
+	query := r.db.Order("id DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var msgs []models.OutboxMessage
+	if err := query.Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+type gormRoleChangeRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRoleChangeRepository) Create(change *models.RoleChange) error {
+	return r.db.Create(change).Error
+}
+
+func (r *gormRoleChangeRepository) ListByUser(userID uint) ([]models.RoleChange, error) {
+	var changes []models.RoleChange
+	if err := r.db.Where("user_id = ?", userID).Order("id").Find(&changes).Error; err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+type gormDelegationRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormDelegationRepository) Create(delegation *models.Delegation) error {
+	return r.db.Create(delegation).Error
+}
+
+func (r *gormDelegationRepository) List(filter DelegationFilter) ([]models.Delegation, error) {
+	query := r.db.Order("id DESC")
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	var delegations []models.Delegation
+	if err := query.Find(&delegations).Error; err != nil {
+		return nil, err
+	}
+	return delegations, nil
+}
+
+type gormRefreshTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRefreshTokenRepository) Create(token *models.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *gormRefreshTokenRepository) Save(token *models.RefreshToken) error {
+	return r.db.Save(token).Error
+}
+
+func (r *gormRefreshTokenRepository) LockByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := forUpdate(r.db).Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &token, nil
+}
+
+func (r *gormRefreshTokenRepository) RevokeAllByUser(userID uint, now time.Time) error {
+	return r.db.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error
+}
+
+type gormUserTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormUserTokenRepository) Create(token *models.UserToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *gormUserTokenRepository) Save(token *models.UserToken) error {
+	return r.db.Save(token).Error
+}
+
+func (r *gormUserTokenRepository) LockByTokenID(tokenID string) (*models.UserToken, error) {
+	var token models.UserToken
+	if err := forUpdate(r.db).Where("token_id = ?", tokenID).First(&token).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &token, nil
+}
+
+func (r *gormUserTokenRepository) UseAll(userID uint, purpose string, now time.Time) error {
+	return r.db.Model(&models.UserToken{}).Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).Update("used_at", now).Error
+}
+
+func (r *gormUserTokenRepository) CountActive(userID uint, purpose string, now time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", userID, purpose, now).
+		Count(&count).Error
+	return count, err
+}
+
+type gormLoginAttemptRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormLoginAttemptRepository) Create(attempt *models.LoginAttempt) error {
+	return r.db.Create(attempt).Error
+}
+
+func (r *gormLoginAttemptRepository) List(filter LoginAttemptFilter) ([]models.LoginAttempt, error) {
+	query := r.db.Order("id DESC")
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Email != "" {
+		query = query.Where("email = ?", filter.Email)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if filter.FailedOnly {
+		query = query.Where("success = ?", false)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	var attempts []models.LoginAttempt
+	if err := query.Find(&attempts).Error; err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+type gormLoginThrottleRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormLoginThrottleRepository) Lock(kind, value string) (*models.LoginThrottle, error) {
+	// Insert first, so that there is a row to lock even on the first
+	// attempt and concurrent first attempts wait for each other.
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginThrottle{Kind: kind, Value: value}).Error
+	if err != nil {
+		return nil, err
+	}
+	var throttle models.LoginThrottle
+	if err := forUpdate(r.db).Where("kind = ? AND value = ?", kind, value).First(&throttle).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &throttle, nil
+}
+
+func (r *gormLoginThrottleRepository) Save(throttle *models.LoginThrottle) error {
+	return r.db.Save(throttle).Error
+}
+
+type gormRecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRecoveryCodeRepository) Replace(userID uint, hashes []string) error {
+	if err := r.db.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	codes := make([]models.RecoveryCode, len(hashes))
+	for i, hash := range hashes {
+		codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+	return r.db.Create(&codes).Error
+}
+
+func (r *gormRecoveryCodeRepository) Use(userID uint, hash string, now time.Time) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", now)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormRecoveryCodeRepository) CountUnused(userID uint) (int64, error) {
+	var n int64
+	err := r.db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&n).Error
+	return n, err
+}
+
+type gormSigningKeyRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormSigningKeyRepository) Create(key *models.SigningKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *gormSigningKeyRepository) Save(key *models.SigningKey) error {
+	return r.db.Save(key).Error
+}
+
+func (r *gormSigningKeyRepository) List(now time.Time) ([]models.SigningKey, error) {
+	return r.list(r.db, now)
+}
+
+func (r *gormSigningKeyRepository) LockAll(now time.Time) ([]models.SigningKey, error) {
+	return r.list(forUpdate(r.db), now)
+}
+
+func (r *gormSigningKeyRepository) list(db *gorm.DB, now time.Time) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	err := db.Where("expires_at IS NULL OR expires_at > ?", now).Order("activates_at, id").Find(&keys).Error
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *gormSigningKeyRepository) DeleteExpired(now time.Time) error {
+	return r.db.Unscoped().Where("expires_at <= ?", now).Delete(&models.SigningKey{}).Error
+}
+
+type gormPermissionRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPermissionRepository) ListByRole(role string) ([]string, error) {
+	var permissions []string
+	err := r.db.Model(&models.RolePermission{}).Where("role = ?", role).Order("permission").Pluck("permission", &permissions).Error
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (r *gormPermissionRepository) List() ([]models.RolePermission, error) {
+	var grants []models.RolePermission
+	if err := r.db.Order("role, permission").Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+func (r *gormPermissionRepository) SetForRole(role string, permissions []string) error {
+	if err := r.db.Unscoped().Where("role = ?", role).Delete(&models.RolePermission{}).Error; err != nil {
+		return err
+	}
+	if len(permissions) == 0 {
+		return nil
+	}
+	grants := make([]models.RolePermission, len(permissions))
+	for i, p := range permissions {
+		grants[i] = models.RolePermission{Role: role, Permission: p}
+	}
+	return r.db.Create(&grants).Error
+}
+
+type gormPolicyRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPolicyRepository) Create(policy *models.CirculationPolicy) error {
+	return r.db.Create(policy).Error
+}
+
+func (r *gormPolicyRepository) Save(policy *models.CirculationPolicy) error {
+	return r.db.Save(policy).Error
+}
+
+func (r *gormPolicyRepository) Delete(id uint) error {
+	// Unscoped so that the (role, genre) pair can be reused afterwards.
+	return r.db.Unscoped().Delete(&models.CirculationPolicy{}, id).Error
+}
+
+func (r *gormPolicyRepository) FindByID(id uint) (*models.CirculationPolicy, error) {
+	var policy models.CirculationPolicy
+	if err := r.db.First(&policy, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &policy, nil
+}
+
+func (r *gormPolicyRepository) FindExact(role, genre string) (*models.CirculationPolicy, error) {
+	var policy models.CirculationPolicy
+	if err := r.db.Where("role = ? AND genre = ?", role, genre).First(&policy).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &policy, nil
+}
+
+func (r *gormPolicyRepository) Resolve(role, genre string) (*models.CirculationPolicy, error) {
+	var policy models.CirculationPolicy
+	err := r.db.Where("role IN ? AND genre IN ?", []string{role, ""}, []string{genre, ""}).
+		Order("CASE WHEN role = '' THEN 1 ELSE 0 END, CASE WHEN genre = '' THEN 1 ELSE 0 END").
+		First(&policy).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &policy, nil
+}
+
+func (r *gormPolicyRepository) List() ([]models.CirculationPolicy, error) {
+	var policies []models.CirculationPolicy
+	if err := r.db.Order("role, genre").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
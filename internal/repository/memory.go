@@ -0,0 +1,1783 @@
+package repository
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"library-management/internal/models"
+)
+
+// table holds the rows of one in-memory table keyed by primary key.
+type table[T any] struct {
+	rows map[uint]T
+	seq  uint
+}
+
+func newTable[T any]() *table[T] {
+	return &table[T]{rows: make(map[uint]T)}
+}
+
+func (t *table[T]) clone() *table[T] {
+	c := &table[T]{rows: make(map[uint]T, len(t.rows)), seq: t.seq}
+	for id, row := range t.rows {
+		c.rows[id] = row
+	}
+	return c
+}
+
+func (t *table[T]) nextID() uint {
+	t.seq++
+	return t.seq
+}
+
+// all returns the rows in primary key order.
+func (t *table[T]) all() []T {
+	ids := make([]uint, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	rows := make([]T, 0, len(ids))
+	for _, id := range ids {
+		rows = append(rows, t.rows[id])
+	}
+	return rows
+}
+
+func stamp(m *gorm.Model, id uint) {
+	now := time.Now()
+	m.ID = id
+	m.CreatedAt = now
+	m.UpdatedAt = now
+}
+
+// setDeleted soft-deletes a row, as GORM's Delete does, or undoes it.
+func setDeleted(m *gorm.Model, deleted bool) {
+	now := time.Now()
+	m.DeletedAt = gorm.DeletedAt{Time: now, Valid: deleted}
+	m.UpdatedAt = now
+}
+
+type memoryTables struct {
+	titles      *table[models.Title]
+	copies      *table[models.Copy]
+	users       *table[models.User]
+	borrows     *table[models.Borrow]
+	holds       *table[models.Hold]
+	renewals    *table[models.Renewal]
+	policies    *table[models.CirculationPolicy]
+	fines       *table[models.FineTransaction]
+	blocks      *table[models.BlockEvent]
+	notices     *table[models.Notice]
+	outbox      *table[models.OutboxMessage]
+	roleChanges *table[models.RoleChange]
+	delegations *table[models.Delegation]
+	permissions *table[models.RolePermission]
+	refresh     *table[models.RefreshToken]
+	userTokens  *table[models.UserToken]
+	logins      *table[models.LoginAttempt]
+	throttles   *table[models.LoginThrottle]
+	recovery    *table[models.RecoveryCode]
+	signingKeys *table[models.SigningKey]
+}
+
+func (t *memoryTables) clone() memoryTables {
+	return memoryTables{
+		titles:      t.titles.clone(),
+		copies:      t.copies.clone(),
+		users:       t.users.clone(),
+		borrows:     t.borrows.clone(),
+		holds:       t.holds.clone(),
+		renewals:    t.renewals.clone(),
+		policies:    t.policies.clone(),
+		fines:       t.fines.clone(),
+		blocks:      t.blocks.clone(),
+		notices:     t.notices.clone(),
+		outbox:      t.outbox.clone(),
+		roleChanges: t.roleChanges.clone(),
+		delegations: t.delegations.clone(),
+		permissions: t.permissions.clone(),
+		refresh:     t.refresh.clone(),
+		userTokens:  t.userTokens.clone(),
+		logins:      t.logins.clone(),
+		throttles:   t.throttles.clone(),
+		recovery:    t.recovery.clone(),
+		signingKeys: t.signingKeys.clone(),
+	}
+}
+
+type memoryData struct {
+	// mu is held for a single call outside a transaction and for the whole
+	// of a transaction, which gives transactions serializable isolation and
+	// makes the Lock* methods trivially correct.
+	mu     sync.Mutex
+	tables memoryTables
+	// index serves catalog searches.
+	index titleIndex
+}
+
+type memoryStore struct {
+	data *memoryData
+	inTx bool
+}
+
+// NewMemoryStore returns an empty Store that keeps everything in process
+// memory. It is meant for tests and local experiments.
+func NewMemoryStore() Store {
+	return &memoryStore{data: &memoryData{tables: memoryTables{
+		titles:      newTable[models.Title](),
+		copies:      newTable[models.Copy](),
+		users:       newTable[models.User](),
+		borrows:     newTable[models.Borrow](),
+		holds:       newTable[models.Hold](),
+		renewals:    newTable[models.Renewal](),
+		policies:    newTable[models.CirculationPolicy](),
+		fines:       newTable[models.FineTransaction](),
+		blocks:      newTable[models.BlockEvent](),
+		notices:     newTable[models.Notice](),
+		outbox:      newTable[models.OutboxMessage](),
+		roleChanges: newTable[models.RoleChange](),
+		delegations: newTable[models.Delegation](),
+		permissions: newTable[models.RolePermission](),
+		refresh:     newTable[models.RefreshToken](),
+		userTokens:  newTable[models.UserToken](),
+		logins:      newTable[models.LoginAttempt](),
+		throttles:   newTable[models.LoginThrottle](),
+		recovery:    newTable[models.RecoveryCode](),
+		signingKeys: newTable[models.SigningKey](),
+	}}}
+}
+
+func (s *memoryStore) Titles() TitleRepository               { return &memoryTitleRepository{s} }
+func (s *memoryStore) Copies() CopyRepository                { return &memoryCopyRepository{s} }
+func (s *memoryStore) Users() UserRepository                 { return &memoryUserRepository{s} }
+func (s *memoryStore) Borrows() BorrowRepository             { return &memoryBorrowRepository{s} }
+func (s *memoryStore) Holds() HoldRepository                 { return &memoryHoldRepository{s} }
+func (s *memoryStore) Renewals() RenewalRepository           { return &memoryRenewalRepository{s} }
+func (s *memoryStore) Policies() PolicyRepository            { return &memoryPolicyRepository{s} }
+func (s *memoryStore) Fines() FineRepository                 { return &memoryFineRepository{s} }
+func (s *memoryStore) Blocks() BlockEventRepository          { return &memoryBlockEventRepository{s} }
+func (s *memoryStore) Notices() NoticeRepository             { return &memoryNoticeRepository{s} }
+func (s *memoryStore) Outbox() OutboxRepository              { return &memoryOutboxRepository{s} }
+func (s *memoryStore) RoleChanges() RoleChangeRepository     { return &memoryRoleChangeRepository{s} }
+func (s *memoryStore) Delegations() DelegationRepository     { return &memoryDelegationRepository{s} }
+func (s *memoryStore) Permissions() PermissionRepository     { return &memoryPermissionRepository{s} }
+func (s *memoryStore) RefreshTokens() RefreshTokenRepository { return &memoryRefreshTokenRepository{s} }
+func (s *memoryStore) UserTokens() UserTokenRepository       { return &memoryUserTokenRepository{s} }
+func (s *memoryStore) LoginAttempts() LoginAttemptRepository { return &memoryLoginAttemptRepository{s} }
+func (s *memoryStore) LoginThrottles() LoginThrottleRepository {
+	return &memoryLoginThrottleRepository{s}
+}
+func (s *memoryStore) RecoveryCodes() RecoveryCodeRepository {
+	return &memoryRecoveryCodeRepository{s}
+}
+func (s *memoryStore) SigningKeys() SigningKeyRepository { return &memorySigningKeyRepository{s} }
+
+func (s *memoryStore) Transaction(fn func(tx Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+	s.data.mu.Lock()
+	defer s.data.mu.Unlock()
+
+	snapshot := s.data.tables.clone()
+	if err := fn(&memoryStore{data: s.data, inTx: true}); err != nil {
+		s.data.tables = snapshot
+		return err
+	}
+	return nil
+}
+
+// with runs fn against the tables, taking the store lock unless the caller
+// already holds it through Transaction.
+func (s *memoryStore) with(fn func(t *memoryTables) error) error {
+	if !s.inTx {
+		s.data.mu.Lock()
+		defer s.data.mu.Unlock()
+	}
+	return fn(&s.data.tables)
+}
+
+type memoryTitleRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryTitleRepository) Create(title *models.Title) error {
+	return r.s.with(func(t *memoryTables) error {
+		stamp(&title.Model, t.titles.nextID())
+		t.titles.rows[title.ID] = *title
+		return nil
+	})
+}
+
+func (r *memoryTitleRepository) FindByID(id uint) (*models.Title, error) {
+	var title models.Title
+	err := r.s.with(func(t *memoryTables) error {
+		found, ok := t.titles.rows[id]
+		if !ok || found.DeletedAt.Valid {
+			return ErrNotFound
+		}
+		title = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &title, nil
+}
+
+func (r *memoryTitleRepository) FindAny(id uint) (*models.Title, error) {
+	var title models.Title
+	err := r.s.with(func(t *memoryTables) error {
+		found, ok := t.titles.rows[id]
+		if !ok {
+			return ErrNotFound
+		}
+		title = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &title, nil
+}
+
+func (r *memoryTitleRepository) Lock(id uint) (*models.Title, error) {
+	return r.FindAny(id)
+}
+
+func (r *memoryTitleRepository) Update(title *models.Title) error {
+	return r.s.with(func(t *memoryTables) error {
+		stored, ok := t.titles.rows[title.ID]
+		if !ok {
+			return nil
+		}
+		stored.Title = title.Title
+		stored.Authors = title.Authors
+		stored.ISBN = title.ISBN
+		stored.InvalidISBN = title.InvalidISBN
+		stored.Publisher = title.Publisher
+		stored.Year = title.Year
+		stored.Language = title.Language
+		stored.Subjects = title.Subjects
+		stored.Genre = title.Genre
+		stored.UpdatedAt = time.Now()
+		t.titles.rows[title.ID] = stored
+		return nil
+	})
+}
+
+func (r *memoryTitleRepository) Withdraw(id uint) error {
+	return r.s.with(func(t *memoryTables) error {
+		row, ok := t.titles.rows[id]
+		if ok {
+			setDeleted(&row.Model, true)
+			t.titles.rows[id] = row
+		}
+		return nil
+	})
+}
+
+func (r *memoryTitleRepository) Restore(id uint) error {
+	return r.s.with(func(t *memoryTables) error {
+		row, ok := t.titles.rows[id]
+		if ok {
+			setDeleted(&row.Model, false)
+			t.titles.rows[id] = row
+		}
+		return nil
+	})
+}
+
+func (r *memoryTitleRepository) FindByISBN(isbn string) (*models.Title, error) {
+	var title models.Title
+	err := r.s.with(func(t *memoryTables) error {
+		for _, found := range t.titles.all() {
+			if found.ISBN == isbn && !found.DeletedAt.Valid {
+				title = found
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &title, nil
+}
+
+func (r *memoryTitleRepository) FindAnyByISBN(isbn string) (*models.Title, error) {
+	var title models.Title
+	err := r.s.with(func(t *memoryTables) error {
+		for _, found := range t.titles.all() {
+			if found.ISBN == isbn {
+				title = found
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &title, nil
+}
+
+// summaries returns the titles matching filter with their copy counts, in
+// no particular order.
+func (r *memoryTitleRepository) summaries(t *memoryTables, filter TitleFilter) []TitleSummary {
+	search := strings.ToLower(filter.Search)
+	index := make(map[uint]int)
+	var summaries []TitleSummary
+	for _, title := range t.titles.all() {
+		if title.DeletedAt.Valid {
+			continue
+		}
+		if filter.Genre != "" && title.Genre != filter.Genre {
+			continue
+		}
+		if filter.ISBN != "" && title.ISBN != filter.ISBN {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(title.Title), search) &&
+			!slices.ContainsFunc(title.Authors, func(a string) bool { return strings.Contains(strings.ToLower(a), search) }) {
+			continue
+		}
+		index[title.ID] = len(summaries)
+		summaries = append(summaries, TitleSummary{Title: title})
+	}
+	donated := make(map[uint]bool)
+	for _, cp := range t.copies.rows {
+		i, ok := index[cp.TitleID]
+		if !ok || cp.DeletedAt.Valid {
+			continue
+		}
+		summaries[i].TotalCopies++
+		if cp.Status == models.CopyStatusAvailable {
+			summaries[i].AvailableCopies++
+		}
+		if filter.DonorID != 0 && cp.DonatedByID == filter.DonorID {
+			donated[cp.TitleID] = true
+		}
+	}
+	return slices.DeleteFunc(summaries, func(s TitleSummary) bool {
+		if filter.Available != nil && (s.AvailableCopies > 0) != *filter.Available {
+			return true
+		}
+		return filter.DonorID != 0 && !donated[s.ID]
+	})
+}
+
+// compareTitles compares a and b by the keys of order.
+func compareTitles(order []TitleSort, a, b TitleCursor) int {
+	for _, key := range order {
+		var c int
+		switch key.Key {
+		case TitleSortTitle:
+			c = strings.Compare(a.Title, b.Title)
+		case TitleSortYear:
+			c = cmp.Compare(a.Year, b.Year)
+		case TitleSortGenre:
+			c = strings.Compare(a.Genre, b.Genre)
+		default:
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if key.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (r *memoryTitleRepository) ListSummaries(query TitleQuery) ([]TitleSummary, error) {
+	var summaries []TitleSummary
+	err := r.s.with(func(t *memoryTables) error {
+		summaries = r.summaries(t, query.TitleFilter)
+		return nil
+	})
+	order := withTieBreak(query.Sort)
+	slices.SortFunc(summaries, func(a, b TitleSummary) int {
+		return compareTitles(order, CursorOf(a), CursorOf(b))
+	})
+	if query.After != nil {
+		summaries = slices.DeleteFunc(summaries, func(s TitleSummary) bool {
+			return compareTitles(order, CursorOf(s), *query.After) <= 0
+		})
+	}
+	if query.Before != nil {
+		summaries = slices.DeleteFunc(summaries, func(s TitleSummary) bool {
+			return compareTitles(order, CursorOf(s), *query.Before) >= 0
+		})
+		if query.Limit > 0 && len(summaries) > query.Limit {
+			summaries = summaries[len(summaries)-query.Limit:]
+		}
+	}
+	if query.Limit > 0 && len(summaries) > query.Limit {
+		summaries = summaries[:query.Limit]
+	}
+	return summaries, err
+}
+
+func (r *memoryTitleRepository) CountSummaries(filter TitleFilter) (int64, error) {
+	var n int64
+	err := r.s.with(func(t *memoryTables) error {
+		n = int64(len(r.summaries(t, filter)))
+		return nil
+	})
+	return n, err
+}
+
+func (r *memoryTitleRepository) Facets(filter TitleFilter) (*TitleFacets, error) {
+	var facets *TitleFacets
+	err := r.s.with(func(t *memoryTables) error {
+		summaries := r.summaries(t, filter)
+		matched := make(map[uint]bool, len(summaries))
+		for _, s := range summaries {
+			matched[s.ID] = true
+		}
+		var donors []titleDonor
+		for _, cp := range t.copies.all() {
+			if !matched[cp.TitleID] || cp.DonatedByID == 0 || cp.DeletedAt.Valid {
+				continue
+			}
+			if user, ok := t.users.rows[cp.DonatedByID]; ok {
+				donors = append(donors, titleDonor{TitleID: cp.TitleID, DonorID: user.ID, Name: user.Name})
+			}
+		}
+		facets = countFacets(summaries, donors)
+		return nil
+	})
+	return facets, err
+}
+
+func (r *memoryTitleRepository) Search(query string, limit int) ([]TitleHit, error) {
+	var hits []TitleHit
+	err := r.s.with(func(t *memoryTables) error {
+		// The index is rebuilt when a title has been added, changed or
+		// removed since it was built.
+		var last time.Time
+		for _, title := range t.titles.rows {
+			if title.UpdatedAt.After(last) {
+				last = title.UpdatedAt
+			}
+		}
+		stamp := fmt.Sprint(len(t.titles.rows), t.titles.seq, last.UnixNano())
+		index, err := r.s.data.index.get(stamp, func() ([]models.Title, error) {
+			return slices.DeleteFunc(t.titles.all(), func(title models.Title) bool { return title.DeletedAt.Valid }), nil
+		})
+		if err != nil {
+			return err
+		}
+		hits = titleHits(index.Search(query, limit), r.summaries(t, TitleFilter{}))
+		return nil
+	})
+	return hits, err
+}
+
+type memoryCopyRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryCopyRepository) Create(cp *models.Copy) error {
+	return r.s.with(func(t *memoryTables) error {
+		for _, existing := range t.copies.rows {
+			if existing.Barcode == cp.Barcode {
+				return fmt.Errorf("duplicate copy barcode %q", cp.Barcode)
+			}
+		}
+		if cp.Status == "" {
+			cp.Status = models.CopyStatusAvailable
+		}
+		stamp(&cp.Model, t.copies.nextID())
+		t.copies.rows[cp.ID] = *cp
+		return nil
+	})
+}
+
+func (r *memoryCopyRepository) FindByID(id uint) (*models.Copy, error) {
+	var cp models.Copy
+	err := r.s.with(func(t *memoryTables) error {
+		found, ok := t.copies.rows[id]
+		if !ok || found.DeletedAt.Valid {
+			return ErrNotFound
+		}
+		cp = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (r *memoryCopyRepository) FindByBarcode(barcode string) (*models.Copy, error) {
+	var cp models.Copy
+	err := r.s.with(func(t *memoryTables) error {
+		for _, found := range t.copies.rows {
+			if found.Barcode == barcode {
+				cp = found
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (r *memoryCopyRepository) ListByTitle(titleID uint) ([]models.Copy, error) {
+	var copies []models.Copy
+	err := r.s.with(func(t *memoryTables) error {
+		for _, cp := range t.copies.all() {
+			if cp.TitleID == titleID && !cp.DeletedAt.Valid {
+				copies = append(copies, cp)
+			}
+		}
+		return nil
+	})
+	return copies, err
+}
+
+func (r *memoryCopyRepository) ListAnyByTitle(titleID uint) ([]models.Copy, error) {
+	var copies []models.Copy
+	err := r.s.with(func(t *memoryTables) error {
+		for _, cp := range t.copies.all() {
+			if cp.TitleID == titleID {
+				copies = append(copies, cp)
+			}
+		}
+		return nil
+	})
+	return copies, err
+}
+
+func (r *memoryCopyRepository) LockByTitle(titleID uint) ([]models.Copy, error) {
+	return r.ListByTitle(titleID)
+}
+
+func (r *memoryCopyRepository) WithdrawByTitle(titleID uint) error {
+	return r.s.with(func(t *memoryTables) error {
+		for id, cp := range t.copies.rows {
+			if cp.TitleID == titleID {
+				row := t.copies.rows[id]
+				setDeleted(&row.Model, true)
+				t.copies.rows[id] = row
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryCopyRepository) RestoreByTitle(titleID uint) error {
+	return r.s.with(func(t *memoryTables) error {
+		for id, cp := range t.copies.rows {
+			if cp.TitleID == titleID {
+				row := t.copies.rows[id]
+				setDeleted(&row.Model, false)
+				t.copies.rows[id] = row
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryCopyRepository) LockAvailable(id uint) (*models.Copy, error) {
+	cp, err := r.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Status != models.CopyStatusAvailable {
+		return nil, ErrNotFound
+	}
+	return cp, nil
+}
+
+func (r *memoryCopyRepository) LockAvailableForTitle(titleID uint) (*models.Copy, error) {
+	var cp models.Copy
+	err := r.s.with(func(t *memoryTables) error {
+		for _, found := range t.copies.all() {
+			if found.TitleID == titleID && found.Status == models.CopyStatusAvailable && !found.DeletedAt.Valid {
+				cp = found
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (r *memoryCopyRepository) SetStatus(id uint, status string) error {
+	return r.s.with(func(t *memoryTables) error {
+		cp, ok := t.copies.rows[id]
+		if !ok {
+			return nil
+		}
+		cp.Status = status
+		cp.UpdatedAt = time.Now()
+		t.copies.rows[id] = cp
+		return nil
+	})
+}
+
+type memoryUserRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryUserRepository) Create(user *models.User) error {
+	return r.s.with(func(t *memoryTables) error {
+		for _, u := range t.users.rows {
+			if u.Email == user.Email {
+				return fmt.Errorf("duplicate user email %q", user.Email)
+			}
+		}
+		stamp(&user.Model, t.users.nextID())
+		t.users.rows[user.ID] = *user
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) FindByID(id uint) (*models.User, error) {
+	var user models.User
+	err := r.s.with(func(t *memoryTables) error {
+		u, ok := t.users.rows[id]
+		if !ok {
+			return ErrNotFound
+		}
+		user = u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *memoryUserRepository) FindByEmail(email string) (*models.User, error) {
+	var user models.User
+	err := r.s.with(func(t *memoryTables) error {
+		for _, u := range t.users.rows {
+			if u.Email == email {
+				user = u
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *memoryUserRepository) LockActive(id uint) (*models.User, error) {
+	user, err := r.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Blocked {
+		return nil, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *memoryUserRepository) Lock(id uint) (*models.User, error) {
+	return r.FindByID(id)
+}
+
+func (r *memoryUserRepository) AddPenalty(id uint, amount int64) error {
+	return r.s.with(func(t *memoryTables) error {
+		u, ok := t.users.rows[id]
+		if !ok {
+			return nil
+		}
+		u.Penalty += amount
+		u.UpdatedAt = time.Now()
+		t.users.rows[id] = u
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) SetRole(id uint, role string) error {
+	return r.s.with(func(t *memoryTables) error {
+		u, ok := t.users.rows[id]
+		if !ok {
+			return nil
+		}
+		u.Role = role
+		u.UpdatedAt = time.Now()
+		t.users.rows[id] = u
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) SetPassword(id uint, hash string) error {
+	return r.s.with(func(t *memoryTables) error {
+		u, ok := t.users.rows[id]
+		if !ok {
+			return nil
+		}
+		u.Password = hash
+		u.UpdatedAt = time.Now()
+		t.users.rows[id] = u
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) MarkEmailVerified(id uint, at time.Time) error {
+	return r.s.with(func(t *memoryTables) error {
+		u, ok := t.users.rows[id]
+		if !ok {
+			return nil
+		}
+		u.EmailVerified = true
+		u.EmailVerifiedAt = &at
+		u.UpdatedAt = time.Now()
+		t.users.rows[id] = u
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) BumpTokenVersion(id uint) error {
+	return r.s.with(func(t *memoryTables) error {
+		u, ok := t.users.rows[id]
+		if !ok {
+			return nil
+		}
+		u.TokenVersion++
+		u.UpdatedAt = time.Now()
+		t.users.rows[id] = u
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) LockByRole(role string) ([]uint, error) {
+	var ids []uint
+	err := r.s.with(func(t *memoryTables) error {
+		for _, u := range t.users.all() {
+			if u.Role == role {
+				ids = append(ids, u.ID)
+			}
+		}
+		return nil
+	})
+	return ids, err
+}
+
+func (r *memoryUserRepository) SaveTwoFactor(user *models.User) error {
+	return r.s.with(func(t *memoryTables) error {
+		u, ok := t.users.rows[user.ID]
+		if !ok {
+			return nil
+		}
+		u.TOTPSecret = user.TOTPSecret
+		u.TOTPEnabled = user.TOTPEnabled
+		u.TOTPLastStep = user.TOTPLastStep
+		u.UpdatedAt = time.Now()
+		t.users.rows[user.ID] = u
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) ListWithTOTPSecret() ([]uint, error) {
+	var ids []uint
+	err := r.s.with(func(t *memoryTables) error {
+		for _, u := range t.users.all() {
+			if u.TOTPSecret != "" {
+				ids = append(ids, u.ID)
+			}
+		}
+		return nil
+	})
+	return ids, err
+}
+
+func (r *memoryUserRepository) SaveBlock(user *models.User) error {
+	return r.s.with(func(t *memoryTables) error {
+		u, ok := t.users.rows[user.ID]
+		if !ok {
+			return nil
+		}
+		u.Blocked = user.Blocked
+		u.BlockedManually = user.BlockedManually
+		u.BlockReason = user.BlockReason
+		u.UpdatedAt = time.Now()
+		t.users.rows[user.ID] = u
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) ListForBlockReview(review BlockReview) ([]uint, error) {
+	var ids []uint
+	err := r.s.with(func(t *memoryTables) error {
+		overdue := make(map[uint]bool)
+		if !review.DueBefore.IsZero() {
+			for _, b := range t.borrows.rows {
+				if !b.Returned && b.DueDate.Before(review.DueBefore) {
+					overdue[b.UserID] = true
+				}
+			}
+		}
+		for _, u := range t.users.all() {
+			if (u.Blocked && !u.BlockedManually) ||
+				(review.MinPenalty > 0 && u.Penalty >= review.MinPenalty) ||
+				overdue[u.ID] {
+				ids = append(ids, u.ID)
+			}
+		}
+		return nil
+	})
+	return ids, err
+}
+
+type memoryBorrowRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryBorrowRepository) Create(borrow *models.Borrow) error {
+	return r.s.with(func(t *memoryTables) error {
+		stamp(&borrow.Model, t.borrows.nextID())
+		t.borrows.rows[borrow.ID] = *borrow
+		return nil
+	})
+}
+
+func (r *memoryBorrowRepository) Save(borrow *models.Borrow) error {
+	return r.s.with(func(t *memoryTables) error {
+		if borrow.ID == 0 {
+			stamp(&borrow.Model, t.borrows.nextID())
+		}
+		borrow.UpdatedAt = time.Now()
+		t.borrows.rows[borrow.ID] = *borrow
+		return nil
+	})
+}
+
+func (r *memoryBorrowRepository) FindByID(id uint) (*models.Borrow, error) {
+	var borrow models.Borrow
+	err := r.s.with(func(t *memoryTables) error {
+		b, ok := t.borrows.rows[id]
+		if !ok {
+			return ErrNotFound
+		}
+		borrow = b
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &borrow, nil
+}
+
+func (r *memoryBorrowRepository) CountActiveByUser(userID uint, genre string) (int64, error) {
+	var count int64
+	err := r.s.with(func(t *memoryTables) error {
+		for _, b := range t.borrows.rows {
+			if b.UserID != userID || b.Returned {
+				continue
+			}
+			if genre != "" && t.titles.rows[t.copies.rows[b.CopyID].TitleID].Genre != genre {
+				continue
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (r *memoryBorrowRepository) FindActiveForTitle(userID, titleID uint) (*models.Borrow, error) {
+	var borrow models.Borrow
+	err := r.s.with(func(t *memoryTables) error {
+		for _, b := range t.borrows.rows {
+			if b.UserID == userID && !b.Returned && t.copies.rows[b.CopyID].TitleID == titleID {
+				borrow = b
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &borrow, nil
+}
+
+func (r *memoryBorrowRepository) LockActive(id uint) (*models.Borrow, error) {
+	var borrow models.Borrow
+	err := r.s.with(func(t *memoryTables) error {
+		b, ok := t.borrows.rows[id]
+		if !ok || b.Returned {
+			return ErrNotFound
+		}
+		borrow = b
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &borrow, nil
+}
+
+type memoryHoldRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryHoldRepository) Create(hold *models.Hold) error {
+	return r.s.with(func(t *memoryTables) error {
+		stamp(&hold.Model, t.holds.nextID())
+		t.holds.rows[hold.ID] = *hold
+		return nil
+	})
+}
+
+func (r *memoryHoldRepository) Save(hold *models.Hold) error {
+	return r.s.with(func(t *memoryTables) error {
+		if hold.ID == 0 {
+			stamp(&hold.Model, t.holds.nextID())
+		}
+		hold.UpdatedAt = time.Now()
+		t.holds.rows[hold.ID] = *hold
+		return nil
+	})
+}
+
+func (r *memoryHoldRepository) FindByID(id uint) (*models.Hold, error) {
+	var hold models.Hold
+	err := r.s.with(func(t *memoryTables) error {
+		found, ok := t.holds.rows[id]
+		if !ok {
+			return ErrNotFound
+		}
+		hold = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+func (r *memoryHoldRepository) Lock(id uint) (*models.Hold, error) {
+	return r.FindByID(id)
+}
+
+// first returns the oldest hold matching match.
+func (r *memoryHoldRepository) first(match func(h *models.Hold) bool) (*models.Hold, error) {
+	var hold models.Hold
+	err := r.s.with(func(t *memoryTables) error {
+		for _, found := range t.holds.all() {
+			if match(&found) {
+				hold = found
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+func (r *memoryHoldRepository) FindActive(userID, titleID uint) (*models.Hold, error) {
+	return r.first(func(h *models.Hold) bool {
+		return h.UserID == userID && h.TitleID == titleID && h.IsActive()
+	})
+}
+
+func (r *memoryHoldRepository) LockNextWaiting(titleID uint) (*models.Hold, error) {
+	return r.first(func(h *models.Hold) bool {
+		return h.TitleID == titleID && h.Status == models.HoldStatusWaiting
+	})
+}
+
+func (r *memoryHoldRepository) LockExpired(now time.Time) ([]models.Hold, error) {
+	var holds []models.Hold
+	err := r.s.with(func(t *memoryTables) error {
+		for _, h := range t.holds.all() {
+			if h.Status == models.HoldStatusReady && h.PickupBy != nil && h.PickupBy.Before(now) {
+				holds = append(holds, h)
+			}
+		}
+		return nil
+	})
+	return holds, err
+}
+
+func (r *memoryHoldRepository) QueuePosition(hold *models.Hold) (int64, error) {
+	var ahead int64
+	err := r.s.with(func(t *memoryTables) error {
+		for _, h := range t.holds.rows {
+			if h.TitleID == hold.TitleID && h.Status == models.HoldStatusWaiting && h.ID < hold.ID {
+				ahead++
+			}
+		}
+		return nil
+	})
+	return ahead + 1, err
+}
+
+func (r *memoryHoldRepository) List(filter HoldFilter) ([]models.Hold, error) {
+	statuses := filter.Statuses
+	if len(statuses) == 0 {
+		statuses = []string{models.HoldStatusWaiting, models.HoldStatusReady}
+	}
+	var holds []models.Hold
+	err := r.s.with(func(t *memoryTables) error {
+		for _, h := range t.holds.all() {
+			if filter.TitleID != 0 && h.TitleID != filter.TitleID {
+				continue
+			}
+			if filter.UserID != 0 && h.UserID != filter.UserID {
+				continue
+			}
+			if slices.Contains(statuses, h.Status) {
+				holds = append(holds, h)
+			}
+		}
+		return nil
+	})
+	return holds, err
+}
+
+func (r *memoryBorrowRepository) CountOverdueByUser(userID uint, dueBefore time.Time) (int64, error) {
+	var count int64
+	err := r.s.with(func(t *memoryTables) error {
+		for _, b := range t.borrows.rows {
+			if b.UserID == userID && !b.Returned && b.DueDate.Before(dueBefore) {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (r *memoryBorrowRepository) ListActiveDueBefore(dueBefore time.Time) ([]models.Borrow, error) {
+	var borrows []models.Borrow
+	err := r.s.with(func(t *memoryTables) error {
+		for _, b := range t.borrows.all() {
+			if !b.Returned && b.DueDate.Before(dueBefore) {
+				borrows = append(borrows, b)
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(borrows, func(i, j int) bool { return borrows[i].DueDate.Before(borrows[j].DueDate) })
+	return borrows, err
+}
+
+type memoryRenewalRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryRenewalRepository) Create(renewal *models.Renewal) error {
+	return r.s.with(func(t *memoryTables) error {
+		stamp(&renewal.Model, t.renewals.nextID())
+		t.renewals.rows[renewal.ID] = *renewal
+		return nil
+	})
+}
+
+func (r *memoryRenewalRepository) ListByBorrow(borrowID uint) ([]models.Renewal, error) {
+	var renewals []models.Renewal
+	err := r.s.with(func(t *memoryTables) error {
+		for _, renewal := range t.renewals.all() {
+			if renewal.BorrowID == borrowID {
+				renewals = append(renewals, renewal)
+			}
+		}
+		return nil
+	})
+	return renewals, err
+}
+
+type memoryFineRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryFineRepository) Create(entry *models.FineTransaction) error {
+	return r.s.with(func(t *memoryTables) error {
+		stamp(&entry.Model, t.fines.nextID())
+		t.fines.rows[entry.ID] = *entry
+		return nil
+	})
+}
+
+func (r *memoryFineRepository) ListByUser(userID uint) ([]models.FineTransaction, error) {
+	var entries []models.FineTransaction
+	err := r.s.with(func(t *memoryTables) error {
+		for _, entry := range t.fines.all() {
+			if entry.UserID == userID {
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+type memoryBlockEventRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryBlockEventRepository) Create(event *models.BlockEvent) error {
+	return r.s.with(func(t *memoryTables) error {
+		stamp(&event.Model, t.blocks.nextID())
+		t.blocks.rows[event.ID] = *event
+		return nil
+	})
+}
+
+func (r *memoryBlockEventRepository) ListByUser(userID uint) ([]models.BlockEvent, error) {
+	var events []models.BlockEvent
+	err := r.s.with(func(t *memoryTables) error {
+		for _, event := range t.blocks.all() {
+			if event.UserID == userID {
+				events = append(events, event)
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+type memoryNoticeRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryNoticeRepository) Create(notice *models.Notice) error {
+	return r.s.with(func(t *memoryTables) error {
+		for _, n := range t.notices.rows {
+			if n.BorrowID == notice.BorrowID && n.Kind == notice.Kind && n.RenewCount == notice.RenewCount {
+				return fmt.Errorf("duplicate %s notice for borrow %d", notice.Kind, notice.BorrowID)
+			}
+		}
+		stamp(&notice.Model, t.notices.nextID())
+		t.notices.rows[notice.ID] = *notice
+		return nil
+	})
+}
+
+func (r *memoryNoticeRepository) Exists(borrowID uint, kind string, renewCount int) (bool, error) {
+	var found bool
+	err := r.s.with(func(t *memoryTables) error {
+		for _, n := range t.notices.rows {
+			if n.BorrowID == borrowID && n.Kind == kind && n.RenewCount == renewCount {
+				found = true
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+func (r *memoryNoticeRepository) ListByBorrow(borrowID uint) ([]models.Notice, error) {
+	var notices []models.Notice
+	err := r.s.with(func(t *memoryTables) error {
+		for _, n := range t.notices.all() {
+			if n.BorrowID == borrowID {
+				notices = append(notices, n)
+			}
+		}
+		return nil
+	})
+	return notices, err
+}
+
+type memoryOutboxRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryOutboxRepository) Create(msg *models.OutboxMessage) error {
+	return r.s.with(func(t *memoryTables) error {
+		stamp(&msg.Model, t.outbox.nextID())
+		if msg.Status == "" {
+			msg.Status = models.OutboxPending
+		}
+		t.outbox.rows[msg.ID] = *msg
+		return nil
+	})
+}
+
+func (r *memoryOutboxRepository) Save(msg *models.OutboxMessage) error {
+	return r.s.with(func(t *memoryTables) error {
+		msg.UpdatedAt = time.Now()
+		t.outbox.rows[msg.ID] = *msg
+		return nil
+	})
+}
+
+func (r *memoryOutboxRepository) FindByID(id uint) (*models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+	err := r.s.with(func(t *memoryTables) error {
+		m, ok := t.outbox.rows[id]
+		if !ok {
+			return ErrNotFound
+		}
+		msg = m
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (r *memoryOutboxRepository) LockDue(now time.Time, limit int) ([]models.OutboxMessage, error) {
+	var msgs []models.OutboxMessage
+	err := r.s.with(func(t *memoryTables) error {
+		for _, msg := range t.outbox.all() {
+			if msg.Status == models.OutboxPending && !msg.NextAttemptAt.After(now) {
+				msgs = append(msgs, msg)
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].NextAttemptAt.Before(msgs[j].NextAttemptAt) })
+	if len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+	return msgs, err
+}
+
+func (r *memoryOutboxRepository) List(status string) ([]models.OutboxMessage, error) {
+	var msgs []models.OutboxMessage
+	err := r.s.with(func(t *memoryTables) error {
+		all := t.outbox.all()
+		for i := len(all) - 1; i >= 0; i-- {
+			if status == "" || all[i].Status == status {
+				msgs = append(msgs, all[i])
+			}
+		}
+		return nil
+	})
+	return msgs, err
+}
+
+type memoryRoleChangeRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryRoleChangeRepository) Create(change *models.RoleChange) error {
+	return r.s.with(func(t *memoryTables) error {
+		stamp(&change.Model, t.roleChanges.nextID())
+		t.roleChanges.rows[change.ID] = *change
+		return nil
+	})
+}
+
+func (r *memoryRoleChangeRepository) ListByUser(userID uint) ([]models.RoleChange, error) {
+	var changes []models.RoleChange
+	err := r.s.with(func(t *memoryTables) error {
+		for _, change := range t.roleChanges.all() {
+			if change.UserID == userID {
+				changes = append(changes, change)
+			}
+		}
+		return nil
+	})
+	return changes, err
+}
+
+type memoryDelegationRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryDelegationRepository) Create(delegation *models.Delegation) error {
+	return r.s.with(func(t *memoryTables) error {
+		stamp(&delegation.Model, t.delegations.nextID())
+		t.delegations.rows[delegation.ID] = *delegation
+		return nil
+	})
+}
+
+func (r *memoryDelegationRepository) List(filter DelegationFilter) ([]models.Delegation, error) {
+	var delegations []models.Delegation
+	err := r.s.with(func(t *memoryTables) error {
+		all := t.delegations.all()
+		for i := len(all) - 1; i >= 0; i-- {
+			d := all[i]
+			if filter.ActorID != 0 && d.ActorID != filter.ActorID {
+				continue
+			}
+			if filter.UserID != 0 && d.UserID != filter.UserID {
+				continue
+			}
+			delegations = append(delegations, d)
+		}
+		return nil
+	})
+	return delegations, err
+}
+
+type memoryRefreshTokenRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryRefreshTokenRepository) Create(token *models.RefreshToken) error {
+	return r.s.with(func(t *memoryTables) error {
+		for _, existing := range t.refresh.rows {
+			if existing.TokenHash == token.TokenHash {
+				return fmt.Errorf("duplicate refresh token")
+			}
+		}
+		stamp(&token.Model, t.refresh.nextID())
+		t.refresh.rows[token.ID] = *token
+		return nil
+	})
+}
+
+func (r *memoryRefreshTokenRepository) Save(token *models.RefreshToken) error {
+	return r.s.with(func(t *memoryTables) error {
+		token.UpdatedAt = time.Now()
+		t.refresh.rows[token.ID] = *token
+		return nil
+	})
+}
+
+func (r *memoryRefreshTokenRepository) LockByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.s.with(func(t *memoryTables) error {
+		for _, existing := range t.refresh.rows {
+			if existing.TokenHash == hash {
+				token = existing
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *memoryRefreshTokenRepository) RevokeAllByUser(userID uint, now time.Time) error {
+	return r.s.with(func(t *memoryTables) error {
+		for id, token := range t.refresh.rows {
+			if token.UserID == userID && token.RevokedAt == nil {
+				revokedAt := now
+				token.RevokedAt = &revokedAt
+				token.UpdatedAt = now
+				t.refresh.rows[id] = token
+			}
+		}
+		return nil
+	})
+}
+
+type memoryUserTokenRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryUserTokenRepository) Create(token *models.UserToken) error {
+	return r.s.with(func(t *memoryTables) error {
+		for _, existing := range t.userTokens.rows {
+			if existing.TokenID == token.TokenID {
+				return fmt.Errorf("duplicate user token %q", token.TokenID)
+			}
+		}
+		stamp(&token.Model, t.userTokens.nextID())
+		t.userTokens.rows[token.ID] = *token
+		return nil
+	})
+}
+
+func (r *memoryUserTokenRepository) Save(token *models.UserToken) error {
+	return r.s.with(func(t *memoryTables) error {
+		token.UpdatedAt = time.Now()
+		t.userTokens.rows[token.ID] = *token
+		return nil
+	})
+}
+
+func (r *memoryUserTokenRepository) LockByTokenID(tokenID string) (*models.UserToken, error) {
+	var token models.UserToken
+	err := r.s.with(func(t *memoryTables) error {
+		for _, existing := range t.userTokens.rows {
+			if existing.TokenID == tokenID {
+				token = existing
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *memoryUserTokenRepository) UseAll(userID uint, purpose string, now time.Time) error {
+	return r.s.with(func(t *memoryTables) error {
+		for id, token := range t.userTokens.rows {
+			if token.UserID == userID && token.Purpose == purpose && token.UsedAt == nil {
+				usedAt := now
+				token.UsedAt = &usedAt
+				token.UpdatedAt = now
+				t.userTokens.rows[id] = token
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryUserTokenRepository) CountActive(userID uint, purpose string, now time.Time) (int64, error) {
+	var count int64
+	err := r.s.with(func(t *memoryTables) error {
+		for _, token := range t.userTokens.rows {
+			if token.UserID == userID && token.Purpose == purpose && token.UsedAt == nil && token.ExpiresAt.After(now) {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+type memoryLoginAttemptRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryLoginAttemptRepository) Create(attempt *models.LoginAttempt) error {
+	return r.s.with(func(t *memoryTables) error {
+		stamp(&attempt.Model, t.logins.nextID())
+		t.logins.rows[attempt.ID] = *attempt
+		return nil
+	})
+}
+
+func (r *memoryLoginAttemptRepository) List(filter LoginAttemptFilter) ([]models.LoginAttempt, error) {
+	var attempts []models.LoginAttempt
+	err := r.s.with(func(t *memoryTables) error {
+		all := t.logins.all()
+		for i := len(all) - 1; i >= 0; i-- {
+			if filter.Limit > 0 && len(attempts) == filter.Limit {
+				break
+			}
+			a := all[i]
+			if filter.UserID != 0 && (a.UserID == nil || *a.UserID != filter.UserID) {
+				continue
+			}
+			if filter.Email != "" && a.Email != filter.Email {
+				continue
+			}
+			if filter.IP != "" && a.IP != filter.IP {
+				continue
+			}
+			if filter.FailedOnly && a.Success {
+				continue
+			}
+			attempts = append(attempts, a)
+		}
+		return nil
+	})
+	return attempts, err
+}
+
+type memoryLoginThrottleRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryLoginThrottleRepository) Lock(kind, value string) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	err := r.s.with(func(t *memoryTables) error {
+		for _, existing := range t.throttles.rows {
+			if existing.Kind == kind && existing.Value == value {
+				throttle = existing
+				return nil
+			}
+		}
+		throttle = models.LoginThrottle{Kind: kind, Value: value}
+		stamp(&throttle.Model, t.throttles.nextID())
+		t.throttles.rows[throttle.ID] = throttle
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+func (r *memoryLoginThrottleRepository) Save(throttle *models.LoginThrottle) error {
+	return r.s.with(func(t *memoryTables) error {
+		throttle.UpdatedAt = time.Now()
+		t.throttles.rows[throttle.ID] = *throttle
+		return nil
+	})
+}
+
+type memoryRecoveryCodeRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryRecoveryCodeRepository) Replace(userID uint, hashes []string) error {
+	return r.s.with(func(t *memoryTables) error {
+		for id, code := range t.recovery.rows {
+			if code.UserID == userID {
+				delete(t.recovery.rows, id)
+			}
+		}
+		for _, hash := range hashes {
+			for _, existing := range t.recovery.rows {
+				if existing.CodeHash == hash {
+					return fmt.Errorf("duplicate recovery code")
+				}
+			}
+			code := models.RecoveryCode{UserID: userID, CodeHash: hash}
+			stamp(&code.Model, t.recovery.nextID())
+			t.recovery.rows[code.ID] = code
+		}
+		return nil
+	})
+}
+
+func (r *memoryRecoveryCodeRepository) Use(userID uint, hash string, now time.Time) (bool, error) {
+	var used bool
+	err := r.s.with(func(t *memoryTables) error {
+		for id, code := range t.recovery.rows {
+			if code.UserID == userID && code.CodeHash == hash && code.UsedAt == nil {
+				usedAt := now
+				code.UsedAt = &usedAt
+				code.UpdatedAt = now
+				t.recovery.rows[id] = code
+				used = true
+				return nil
+			}
+		}
+		return nil
+	})
+	return used, err
+}
+
+func (r *memoryRecoveryCodeRepository) CountUnused(userID uint) (int64, error) {
+	var n int64
+	err := r.s.with(func(t *memoryTables) error {
+		for _, code := range t.recovery.rows {
+			if code.UserID == userID && code.UsedAt == nil {
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+type memorySigningKeyRepository struct {
+	s *memoryStore
+}
+
+func (r *memorySigningKeyRepository) Create(key *models.SigningKey) error {
+	return r.s.with(func(t *memoryTables) error {
+		for _, existing := range t.signingKeys.rows {
+			if existing.KID == key.KID {
+				return fmt.Errorf("duplicate signing key %q", key.KID)
+			}
+		}
+		stamp(&key.Model, t.signingKeys.nextID())
+		t.signingKeys.rows[key.ID] = *key
+		return nil
+	})
+}
+
+func (r *memorySigningKeyRepository) Save(key *models.SigningKey) error {
+	return r.s.with(func(t *memoryTables) error {
+		key.UpdatedAt = time.Now()
+		t.signingKeys.rows[key.ID] = *key
+		return nil
+	})
+}
+
+func (r *memorySigningKeyRepository) List(now time.Time) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	err := r.s.with(func(t *memoryTables) error {
+		for _, k := range t.signingKeys.all() {
+			if k.ExpiresAt == nil || k.ExpiresAt.After(now) {
+				keys = append(keys, k)
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].ActivatesAt.Before(keys[j].ActivatesAt) })
+	return keys, err
+}
+
+func (r *memorySigningKeyRepository) LockAll(now time.Time) ([]models.SigningKey, error) {
+	return r.List(now)
+}
+
+func (r *memorySigningKeyRepository) DeleteExpired(now time.Time) error {
+	return r.s.with(func(t *memoryTables) error {
+		for id, k := range t.signingKeys.rows {
+			if k.ExpiresAt != nil && !k.ExpiresAt.After(now) {
+				delete(t.signingKeys.rows, id)
+			}
+		}
+		return nil
+	})
+}
+
+type memoryPermissionRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryPermissionRepository) ListByRole(role string) ([]string, error) {
+	var permissions []string
+	err := r.s.with(func(t *memoryTables) error {
+		for _, g := range t.permissions.rows {
+			if g.Role == role {
+				permissions = append(permissions, g.Permission)
+			}
+		}
+		return nil
+	})
+	sort.Strings(permissions)
+	return permissions, err
+}
+
+func (r *memoryPermissionRepository) List() ([]models.RolePermission, error) {
+	var grants []models.RolePermission
+	err := r.s.with(func(t *memoryTables) error {
+		grants = t.permissions.all()
+		return nil
+	})
+	sort.SliceStable(grants, func(i, j int) bool {
+		if grants[i].Role != grants[j].Role {
+			return grants[i].Role < grants[j].Role
+		}
+		return grants[i].Permission < grants[j].Permission
+	})
+	return grants, err
+}
+
+func (r *memoryPermissionRepository) SetForRole(role string, permissions []string) error {
+	return r.s.with(func(t *memoryTables) error {
+		for id, g := range t.permissions.rows {
+			if g.Role == role {
+				delete(t.permissions.rows, id)
+			}
+		}
+		seen := make(map[string]bool)
+		for _, p := range permissions {
+			if seen[p] {
+				return fmt.Errorf("duplicate permission %q for role %q", p, role)
+			}
+			seen[p] = true
+			g := models.RolePermission{Role: role, Permission: p}
+			stamp(&g.Model, t.permissions.nextID())
+			t.permissions.rows[g.ID] = g
+		}
+		return nil
+	})
+}
+
+type memoryPolicyRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryPolicyRepository) Create(policy *models.CirculationPolicy) error {
+	return r.s.with(func(t *memoryTables) error {
+		for _, p := range t.policies.rows {
+			if p.Role == policy.Role && p.Genre == policy.Genre {
+				return fmt.Errorf("duplicate policy for role %q and genre %q", policy.Role, policy.Genre)
+			}
+		}
+		stamp(&policy.Model, t.policies.nextID())
+		t.policies.rows[policy.ID] = *policy
+		return nil
+	})
+}
+
+func (r *memoryPolicyRepository) Save(policy *models.CirculationPolicy) error {
+	return r.s.with(func(t *memoryTables) error {
+		if policy.ID == 0 {
+			stamp(&policy.Model, t.policies.nextID())
+		}
+		policy.UpdatedAt = time.Now()
+		t.policies.rows[policy.ID] = *policy
+		return nil
+	})
+}
+
+func (r *memoryPolicyRepository) Delete(id uint) error {
+	return r.s.with(func(t *memoryTables) error {
+		delete(t.policies.rows, id)
+		return nil
+	})
+}
+
+func (r *memoryPolicyRepository) FindByID(id uint) (*models.CirculationPolicy, error) {
+	var policy models.CirculationPolicy
+	err := r.s.with(func(t *memoryTables) error {
+		p, ok := t.policies.rows[id]
+		if !ok {
+			return ErrNotFound
+		}
+		policy = p
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *memoryPolicyRepository) FindExact(role, genre string) (*models.CirculationPolicy, error) {
+	var policy models.CirculationPolicy
+	err := r.s.with(func(t *memoryTables) error {
+		for _, p := range t.policies.rows {
+			if p.Role == role && p.Genre == genre {
+				policy = p
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *memoryPolicyRepository) Resolve(role, genre string) (*models.CirculationPolicy, error) {
+	candidates := [][2]string{{role, genre}, {role, ""}, {"", genre}, {"", ""}}
+	for _, c := range candidates {
+		policy, err := r.FindExact(c[0], c[1])
+		if err == nil || !errors.Is(err, ErrNotFound) {
+			return policy, err
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryPolicyRepository) List() ([]models.CirculationPolicy, error) {
+	var policies []models.CirculationPolicy
+	err := r.s.with(func(t *memoryTables) error {
+		policies = t.policies.all()
+		return nil
+	})
+	sort.SliceStable(policies, func(i, j int) bool {
+		if policies[i].Role != policies[j].Role {
+			return policies[i].Role < policies[j].Role
+		}
+		return policies[i].Genre < policies[j].Genre
+	})
+	return policies, err
+}
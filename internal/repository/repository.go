@@ -0,0 +1,444 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"library-management/internal/models"
+)
+
+// ErrNotFound is returned by every repository when the requested row does
+// not exist (or does not match the extra conditions of the lookup).
+var ErrNotFound = errors.New("record not found")
+
+// TitleSummary is a title together with availability counts over its
+// copies.
+type TitleSummary struct {
+	models.Title
+	TotalCopies     int64 `json:"total_copies"`
+	AvailableCopies int64 `json:"available_copies"`
+}
+
+// Keys a catalog listing can be sorted by.
+const (
+	TitleSortTitle = "title"
+	TitleSortYear  = "year"
+	TitleSortGenre = "genre"
+	// TitleSortAdded orders titles by when they were catalogued.
+	TitleSortAdded = "added"
+)
+
+func IsValidTitleSort(key string) bool {
+	switch key {
+	case TitleSortTitle, TitleSortYear, TitleSortGenre, TitleSortAdded:
+		return true
+	default:
+		return false
+	}
+}
+
+// TitleFilter narrows a catalog listing. Zero fields are ignored.
+type TitleFilter struct {
+	// Search matches titles whose title or authors contain it, ignoring
+	// case.
+	Search string
+	Genre  string
+	// Available keeps only the titles that have an available copy, or
+	// with false only those that have none.
+	Available *bool
+	// DonorID keeps only the titles with a copy donated by this user.
+	DonorID uint
+	// ISBN matches the stored ISBN exactly, so it should be normalised.
+	ISBN string
+}
+
+// TitleSort is one key of a catalog ordering.
+type TitleSort struct {
+	Key  string
+	Desc bool
+}
+
+// TitleCursor marks a position in a catalog listing: the sort keys of the
+// title it was taken from. Only the keys in the ordering are compared.
+type TitleCursor struct {
+	Title string
+	Year  int
+	Genre string
+	ID    uint
+}
+
+// TitleQuery asks for one page of the catalog.
+type TitleQuery struct {
+	TitleFilter
+	// Sort orders the titles. Ties are broken by ID, ascending unless
+	// TitleSortAdded says otherwise.
+	Sort []TitleSort
+	// After returns the titles that follow the cursor; Before returns
+	// those that precede it, still in Sort order. At most one is set.
+	After  *TitleCursor
+	Before *TitleCursor
+	Limit  int
+}
+
+// CursorOf returns the cursor at summary.
+func CursorOf(summary TitleSummary) TitleCursor {
+	return TitleCursor{Title: summary.Title.Title, Year: summary.Year, Genre: summary.Genre, ID: summary.ID}
+}
+
+// withTieBreak returns sort with the ID key appended unless it already
+// orders by it, so that every title has a distinct position.
+func withTieBreak(sort []TitleSort) []TitleSort {
+	for _, s := range sort {
+		if s.Key == TitleSortAdded {
+			return sort
+		}
+	}
+	return append(sort[:len(sort):len(sort)], TitleSort{Key: TitleSortAdded})
+}
+
+// TitleHit is a title found by a catalog search.
+type TitleHit struct {
+	TitleSummary
+	// Rank orders the hits, higher first. It only compares hits of the
+	// same search.
+	Rank       float64         `json:"rank"`
+	Highlights TitleHighlights `json:"highlights"`
+}
+
+// TitleHighlights holds the title and authors of a hit, HTML-escaped, with
+// the words that matched the search wrapped in <mark> tags.
+type TitleHighlights struct {
+	Title   string `json:"title"`
+	Authors string `json:"authors"`
+}
+
+// TitleRepository reads and writes titles. Withdrawn titles are left out
+// of everything but Lock.
+type TitleRepository interface {
+	Create(title *models.Title) error
+	FindByID(id uint) (*models.Title, error)
+	// FindAny is FindByID that also finds withdrawn titles.
+	FindAny(id uint) (*models.Title, error)
+	// Lock returns the title, even if it has been withdrawn, and holds a
+	// row lock on it until the surrounding transaction ends.
+	Lock(id uint) (*models.Title, error)
+	// Update saves the bibliographic fields of title, withdrawn or not.
+	Update(title *models.Title) error
+	// Withdraw soft-deletes the title; Restore brings it back.
+	Withdraw(id uint) error
+	Restore(id uint) error
+	FindByISBN(isbn string) (*models.Title, error)
+	// FindAnyByISBN is FindByISBN that also finds withdrawn titles.
+	FindAnyByISBN(isbn string) (*models.Title, error)
+	// ListSummaries returns a page of titles with copy counts.
+	ListSummaries(query TitleQuery) ([]TitleSummary, error)
+	// CountSummaries returns how many titles match filter.
+	CountSummaries(filter TitleFilter) (int64, error)
+	// Search returns up to limit titles matching query, best first. Words
+	// are matched when spelt a little differently.
+	Search(query string, limit int) ([]TitleHit, error)
+	// Facets counts the titles matching filter by genre, author, decade
+	// and donor.
+	Facets(filter TitleFilter) (*TitleFacets, error)
+}
+
+// CopyRepository reads and writes copies. Copies withdrawn with their title
+// are left out of everything but FindByBarcode, so that their barcodes
+// stay taken.
+type CopyRepository interface {
+	Create(cp *models.Copy) error
+	FindByID(id uint) (*models.Copy, error)
+	FindByBarcode(barcode string) (*models.Copy, error)
+	ListByTitle(titleID uint) ([]models.Copy, error)
+	// ListAnyByTitle is ListByTitle that also lists withdrawn copies.
+	ListAnyByTitle(titleID uint) ([]models.Copy, error)
+	// LockByTitle is ListByTitle holding row locks on the copies until the
+	// surrounding transaction ends.
+	LockByTitle(titleID uint) ([]models.Copy, error)
+	// WithdrawByTitle soft-deletes the copies of the title, and
+	// RestoreByTitle brings every one of them back.
+	WithdrawByTitle(titleID uint) error
+	RestoreByTitle(titleID uint) error
+	// LockAvailable returns the copy only if it is available, holding a row
+	// lock on it until the surrounding transaction ends.
+	LockAvailable(id uint) (*models.Copy, error)
+	// LockAvailableForTitle picks any available copy of the title and locks
+	// it like LockAvailable. Copies locked by other transactions are skipped.
+	LockAvailableForTitle(titleID uint) (*models.Copy, error)
+	SetStatus(id uint, status string) error
+}
+
+type UserRepository interface {
+	Create(user *models.User) error
+	FindByID(id uint) (*models.User, error)
+	FindByEmail(email string) (*models.User, error)
+	// LockActive returns the user only if they are not blocked, holding a row
+	// lock on it until the surrounding transaction ends.
+	LockActive(id uint) (*models.User, error)
+	// Lock returns the user, blocked or not, holding a row lock on it until
+	// the surrounding transaction ends.
+	Lock(id uint) (*models.User, error)
+	// AddPenalty adds amount cents, which may be negative, to the user's
+	// outstanding fines.
+	AddPenalty(id uint, amount int64) error
+	// SetRole changes the user's role, leaving the rest of the row alone.
+	SetRole(id uint, role string) error
+	// LockByRole returns the ids of the users with the given role, holding
+	// row locks on them until the surrounding transaction ends.
+	LockByRole(role string) ([]uint, error)
+	// SetPassword replaces the user's password hash.
+	SetPassword(id uint, hash string) error
+	// MarkEmailVerified records that the user's email was verified at.
+	MarkEmailVerified(id uint, at time.Time) error
+	// BumpTokenVersion increments the user's token version, which
+	// invalidates every access token issued before.
+	BumpTokenVersion(id uint) error
+	// SaveTwoFactor writes the user's TOTPSecret, TOTPEnabled and
+	// TOTPLastStep fields, leaving the rest of the row alone.
+	SaveTwoFactor(user *models.User) error
+	// ListWithTOTPSecret returns, in id order, the ids of users who have a
+	// TOTP secret, whether or not they finished setting it up.
+	ListWithTOTPSecret() ([]uint, error)
+	// SaveBlock writes the user's Blocked, BlockedManually and BlockReason
+	// fields, leaving the rest of the row alone.
+	SaveBlock(user *models.User) error
+	// ListForBlockReview returns, in id order, the ids of users whose
+	// automatic block may need to be placed or lifted.
+	ListForBlockReview(review BlockReview) ([]uint, error)
+}
+
+// BlockReview selects users for UserRepository.ListForBlockReview: those
+// blocked automatically, plus those owing at least MinPenalty cents or with
+// an unreturned loan due before DueBefore. Zero fields are ignored.
+type BlockReview struct {
+	MinPenalty int64
+	DueBefore  time.Time
+}
+
+type BorrowRepository interface {
+	Create(borrow *models.Borrow) error
+	Save(borrow *models.Borrow) error
+	FindByID(id uint) (*models.Borrow, error)
+	// CountActiveByUser counts the user's unreturned loans, only of copies
+	// whose title has the given genre unless genre is empty.
+	CountActiveByUser(userID uint, genre string) (int64, error)
+	// CountOverdueByUser counts the user's unreturned loans due before
+	// dueBefore.
+	CountOverdueByUser(userID uint, dueBefore time.Time) (int64, error)
+	// FindActiveForTitle returns one of the user's unreturned loans of a
+	// copy of the title.
+	FindActiveForTitle(userID, titleID uint) (*models.Borrow, error)
+	// ListActiveDueBefore returns the unreturned loans due before dueBefore,
+	// soonest due first.
+	ListActiveDueBefore(dueBefore time.Time) ([]models.Borrow, error)
+	// LockActive returns the borrow only if it has not been returned yet,
+	// holding a row lock on it until the surrounding transaction ends.
+	LockActive(id uint) (*models.Borrow, error)
+}
+
+type RenewalRepository interface {
+	Create(renewal *models.Renewal) error
+	// ListByBorrow returns the renewals of a borrow, oldest first.
+	ListByBorrow(borrowID uint) ([]models.Renewal, error)
+}
+
+type FineRepository interface {
+	Create(entry *models.FineTransaction) error
+	// ListByUser returns the user's ledger entries, oldest first.
+	ListByUser(userID uint) ([]models.FineTransaction, error)
+}
+
+type BlockEventRepository interface {
+	Create(event *models.BlockEvent) error
+	// ListByUser returns the user's block history, oldest first.
+	ListByUser(userID uint) ([]models.BlockEvent, error)
+}
+
+type NoticeRepository interface {
+	Create(notice *models.Notice) error
+	// Exists reports whether a notice of this kind was already sent for the
+	// loan at the given renewal count.
+	Exists(borrowID uint, kind string, renewCount int) (bool, error)
+	// ListByBorrow returns the notices sent for a loan, oldest first.
+	ListByBorrow(borrowID uint) ([]models.Notice, error)
+}
+
+type OutboxRepository interface {
+	Create(msg *models.OutboxMessage) error
+	Save(msg *models.OutboxMessage) error
+	FindByID(id uint) (*models.OutboxMessage, error)
+	// LockDue returns up to limit pending messages whose next attempt is not
+	// after now, oldest due first, locked. Messages locked by other
+	// transactions are skipped.
+	LockDue(now time.Time, limit int) ([]models.OutboxMessage, error)
+	// List returns the messages with the given status, or all of them if
+	// status is empty, newest first.
+	List(status string) ([]models.OutboxMessage, error)
+}
+
+type RoleChangeRepository interface {
+	Create(change *models.RoleChange) error
+	// ListByUser returns the user's role changes, oldest first.
+	ListByUser(userID uint) ([]models.RoleChange, error)
+}
+
+// DelegationFilter narrows DelegationRepository.List. Zero fields are
+// ignored.
+type DelegationFilter struct {
+	ActorID uint
+	UserID  uint
+}
+
+type DelegationRepository interface {
+	Create(delegation *models.Delegation) error
+	// List returns matching delegations, newest first.
+	List(filter DelegationFilter) ([]models.Delegation, error)
+}
+
+type RefreshTokenRepository interface {
+	Create(token *models.RefreshToken) error
+	Save(token *models.RefreshToken) error
+	// LockByHash returns the token with the given hash, revoked or not,
+	// holding a row lock on it until the surrounding transaction ends.
+	LockByHash(hash string) (*models.RefreshToken, error)
+	// RevokeAllByUser revokes every refresh token of the user that is not
+	// revoked yet.
+	RevokeAllByUser(userID uint, now time.Time) error
+}
+
+type UserTokenRepository interface {
+	Create(token *models.UserToken) error
+	Save(token *models.UserToken) error
+	// LockByTokenID returns the token with the given ID, used or not,
+	// holding a row lock on it until the surrounding transaction ends.
+	LockByTokenID(tokenID string) (*models.UserToken, error)
+	// UseAll marks every unused token of the user for purpose as used.
+	UseAll(userID uint, purpose string, now time.Time) error
+	// CountActive counts the user's tokens for purpose that are neither
+	// used nor expired at now.
+	CountActive(userID uint, purpose string, now time.Time) (int64, error)
+}
+
+// LoginAttemptFilter narrows LoginAttemptRepository.List. Zero fields are
+// ignored.
+type LoginAttemptFilter struct {
+	UserID     uint
+	Email      string
+	IP         string
+	FailedOnly bool
+	// Limit caps the number of attempts returned.
+	Limit int
+}
+
+type LoginAttemptRepository interface {
+	Create(attempt *models.LoginAttempt) error
+	// List returns matching attempts, newest first.
+	List(filter LoginAttemptFilter) ([]models.LoginAttempt, error)
+}
+
+type LoginThrottleRepository interface {
+	// Lock returns the throttle for kind and value, creating an empty one
+	// if there is none, and holds a row lock on it until the surrounding
+	// transaction ends.
+	Lock(kind, value string) (*models.LoginThrottle, error)
+	Save(throttle *models.LoginThrottle) error
+}
+
+type RecoveryCodeRepository interface {
+	// Replace deletes the user's recovery codes and stores new ones with
+	// the given hashes.
+	Replace(userID uint, hashes []string) error
+	// Use marks the user's unused code with hash as used and reports
+	// whether there was one.
+	Use(userID uint, hash string, now time.Time) (bool, error)
+	CountUnused(userID uint) (int64, error)
+}
+
+type SigningKeyRepository interface {
+	Create(key *models.SigningKey) error
+	Save(key *models.SigningKey) error
+	// List returns the keys that have not expired at now, oldest first.
+	List(now time.Time) ([]models.SigningKey, error)
+	// LockAll is List holding row locks on the keys until the surrounding
+	// transaction ends.
+	LockAll(now time.Time) ([]models.SigningKey, error)
+	// DeleteExpired removes the keys that expired before now.
+	DeleteExpired(now time.Time) error
+}
+
+type PermissionRepository interface {
+	// ListByRole returns the permissions granted to role, sorted.
+	ListByRole(role string) ([]string, error)
+	// List returns every grant, ordered by role and permission.
+	List() ([]models.RolePermission, error)
+	// SetForRole replaces the permissions granted to role.
+	SetForRole(role string, permissions []string) error
+}
+
+type PolicyRepository interface {
+	Create(policy *models.CirculationPolicy) error
+	Save(policy *models.CirculationPolicy) error
+	Delete(id uint) error
+	FindByID(id uint) (*models.CirculationPolicy, error)
+	// FindExact returns the policy stored for exactly this role and genre.
+	FindExact(role, genre string) (*models.CirculationPolicy, error)
+	// Resolve returns the most specific policy matching role and genre.
+	Resolve(role, genre string) (*models.CirculationPolicy, error)
+	List() ([]models.CirculationPolicy, error)
+}
+
+// HoldFilter narrows HoldRepository.List. Zero fields are ignored; an
+// empty Statuses means waiting and ready holds only.
+type HoldFilter struct {
+	TitleID  uint
+	UserID   uint
+	Statuses []string
+}
+
+type HoldRepository interface {
+	Create(hold *models.Hold) error
+	Save(hold *models.Hold) error
+	FindByID(id uint) (*models.Hold, error)
+	// Lock returns the hold and holds a row lock on it until the surrounding
+	// transaction ends.
+	Lock(id uint) (*models.Hold, error)
+	// FindActive returns the user's waiting or ready hold on the title.
+	FindActive(userID, titleID uint) (*models.Hold, error)
+	// LockNextWaiting returns the oldest waiting hold on the title, locked.
+	LockNextWaiting(titleID uint) (*models.Hold, error)
+	// LockExpired returns the ready holds whose pickup deadline is before
+	// now, locked.
+	LockExpired(now time.Time) ([]models.Hold, error)
+	// QueuePosition returns the 1-based place of a waiting hold in its
+	// title's queue.
+	QueuePosition(hold *models.Hold) (int64, error)
+	// List returns matching holds, oldest first.
+	List(filter HoldFilter) ([]models.Hold, error)
+}
+
+// Store groups the repositories that share one underlying connection.
+type Store interface {
+	Titles() TitleRepository
+	Copies() CopyRepository
+	Users() UserRepository
+	Borrows() BorrowRepository
+	Holds() HoldRepository
+	Renewals() RenewalRepository
+	Policies() PolicyRepository
+	Fines() FineRepository
+	Blocks() BlockEventRepository
+	Notices() NoticeRepository
+	Outbox() OutboxRepository
+	RoleChanges() RoleChangeRepository
+	Delegations() DelegationRepository
+	Permissions() PermissionRepository
+	RefreshTokens() RefreshTokenRepository
+	UserTokens() UserTokenRepository
+	LoginAttempts() LoginAttemptRepository
+	LoginThrottles() LoginThrottleRepository
+	RecoveryCodes() RecoveryCodeRepository
+	SigningKeys() SigningKeyRepository
+	// Transaction runs fn with a Store bound to a single transaction. The
+	// transaction is committed if fn returns nil and rolled back otherwise.
+	Transaction(fn func(tx Store) error) error
+}
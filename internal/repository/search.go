@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"html"
+	"strings"
+	"sync"
+
+	"library-management/internal/models"
+	"library-management/internal/search"
+)
+
+// titleIndex holds the in-process search index of the titles, for stores
+// whose database cannot search text itself. It is rebuilt whenever the
+// titles have changed.
+type titleIndex struct {
+	mu    sync.Mutex
+	stamp string
+	index *search.Index
+}
+
+// get returns the index of the titles as of stamp, a value that changes
+// whenever they do, and calls load to rebuild it if stamp is new.
+func (ti *titleIndex) get(stamp string, load func() ([]models.Title, error)) (*search.Index, error) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if ti.index != nil && ti.stamp == stamp {
+		return ti.index, nil
+	}
+	titles, err := load()
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]search.Document, 0, len(titles))
+	for _, t := range titles {
+		docs = append(docs, search.Document{ID: t.ID, Fields: []search.Field{
+			// The weights ts_rank gives to A, B and C.
+			{Name: "title", Text: t.Title, Weight: 1},
+			{Name: "authors", Text: strings.Join(t.Authors, ", "), Weight: 0.4},
+			{Name: "genre", Text: t.Genre, Weight: 0.2},
+		}})
+	}
+	ti.index = search.New(docs)
+	ti.stamp = stamp
+	return ti.index, nil
+}
+
+// titleHits pairs each hit with the summary of its title, keeping the
+// order of hits and leaving out titles that are gone.
+func titleHits(hits []search.Hit, summaries []TitleSummary) []TitleHit {
+	byID := make(map[uint]TitleSummary, len(summaries))
+	for _, s := range summaries {
+		byID[s.ID] = s
+	}
+	out := make([]TitleHit, 0, len(hits))
+	for _, hit := range hits {
+		summary, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		out = append(out, TitleHit{
+			TitleSummary: summary,
+			Rank:         hit.Score,
+			Highlights: TitleHighlights{
+				Title:   hit.Highlights["title"],
+				Authors: hit.Highlights["authors"],
+			},
+		})
+	}
+	return out
+}
+
+// escapeHighlight escapes a ts_headline result for HTML, keeping its
+// <mark> tags.
+func escapeHighlight(s string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(s, "<mark>") {
+		if i > 0 {
+			b.WriteString("<mark>")
+		}
+		marked, rest, found := strings.Cut(part, "</mark>")
+		if !found {
+			b.WriteString(html.EscapeString(part))
+			continue
+		}
+		b.WriteString(html.EscapeString(marked) + "</mark>" + html.EscapeString(rest))
+	}
+	return b.String()
+}
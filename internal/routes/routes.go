@@ -3,23 +3,89 @@ package routes
 import (
 	"github.com/gofiber/fiber/v2"
 	"library-management/internal/handlers"
-	"library-management/internal/middleware" 
-	"library-management/internal/models"     
+	"library-management/internal/middleware"
+	"library-management/internal/models"
 )
 
-func SetupRoutes(app *fiber.App) {
+func SetupRoutes(app *fiber.App, h *handlers.Handler) {
+	app.Get("/.well-known/jwks.json", h.JWKS)
+
 	api := app.Group("/api")
 
-	api.Post("/signup", handlers.SignUp)
-	api.Post("/signin", handlers.SignIn)
+	api.Post("/signup", h.SignUp)
+	api.Post("/signin", h.SignIn)
+	api.Post("/signin/2fa", h.SignInTwoFactor)
+	api.Post("/signin/2fa/setup", h.SetupTwoFactorAtSignIn)
+	api.Post("/signout", h.SignOut)
+	api.Post("/token/refresh", h.RefreshToken)
+	api.Post("/verify-email", h.VerifyEmail)
+	api.Post("/password/forgot", h.ForgotPassword)
+	api.Post("/password/reset", h.ResetPassword)
+
+	protected := api.Group("/").Use(middleware.Authenticate(h.AccessTokenKey, h.CheckSession), middleware.LoadPermissions(h.RolePermissions))
+
+	protected.Post("/verify-email/resend", h.ResendVerification)
+
+	protected.Get("/2fa", h.GetTwoFactor)
+	protected.Post("/2fa/setup", h.SetupTwoFactor)
+	protected.Post("/2fa/enable", h.EnableTwoFactor)
+	protected.Post("/2fa/disable", h.DisableTwoFactor)
+	protected.Post("/2fa/recovery-codes", h.RegenerateRecoveryCodes)
+
+	protected.Get("/books", h.GetAllBooks)
+	protected.Get("/books/search", h.SearchBooks)
+	protected.Get("/books/facets", h.GetBookFacets)
+	protected.Get("/books/isbn/:isbn", h.GetBooksByISBN)
+	protected.Post("/books", middleware.RequirePermission(models.PermBooksCreate), h.CreateBook)
+	protected.Post("/books/donate", h.DonateBook)
+	protected.Get("/books/:id", middleware.RequirePermission(models.PermBooksManage), h.GetBook)
+	protected.Patch("/books/:id", middleware.RequirePermission(models.PermBooksManage), h.UpdateBook)
+	protected.Delete("/books/:id", middleware.RequirePermission(models.PermBooksManage), h.WithdrawBook)
+	protected.Post("/books/:id/restore", middleware.RequirePermission(models.PermBooksManage), h.RestoreBook)
+	protected.Get("/books/:id/copies", h.GetBookCopies)
+	protected.Post("/books/:id/copies", middleware.RequirePermission(models.PermBooksCreate), h.AddCopy)
+
+	protected.Post("/books/borrow", h.BorrowBook)
+	protected.Post("/books/return/:id", h.ReturnBook)
+
+	protected.Post("/borrows/:id/renew", h.RenewBorrow)
+	protected.Get("/borrows/:id/renewals", middleware.RequirePermission(models.PermBorrowsRead), h.GetBorrowRenewals)
+	protected.Get("/borrows/:id/notices", middleware.RequirePermission(models.PermBorrowsRead), h.GetBorrowNotices)
+
+	protected.Get("/policies", h.ListPolicies)
+	protected.Post("/policies", middleware.RequirePermission(models.PermPoliciesManage), h.CreatePolicy)
+	protected.Patch("/policies/:id", middleware.RequirePermission(models.PermPoliciesManage), h.UpdatePolicy)
+	protected.Delete("/policies/:id", middleware.RequirePermission(models.PermPoliciesManage), h.DeletePolicy)
+
+	protected.Get("/fines", h.GetMyFines)
+	protected.Get("/users/:id/fines", middleware.RequirePermission(models.PermFinesRead), h.GetUserFines)
+	protected.Post("/users/:id/fines/payments", middleware.RequirePermission(models.PermFinesCollect), h.RecordFinePayment)
+	protected.Post("/users/:id/fines/waivers", middleware.RequirePermission(models.PermFinesWaive), h.WaiveFine)
+	protected.Post("/users/:id/fines/refunds", middleware.RequirePermission(models.PermFinesRefund), h.RefundFine)
+
+	protected.Patch("/users/:id/role", middleware.RequirePermission(models.PermUsersChangeRole), h.ChangeUserRole)
+	protected.Get("/users/:id/role-changes", middleware.RequirePermission(models.PermUsersRead), h.GetUserRoleChanges)
+
+	protected.Get("/users/:id/blocks", middleware.RequirePermission(models.PermUsersRead), h.GetUserBlocks)
+	protected.Post("/users/:id/block", middleware.RequirePermission(models.PermUsersBlock), h.BlockUser)
+	protected.Post("/users/:id/unblock", middleware.RequirePermission(models.PermUsersBlock), h.UnblockUser)
+
+	protected.Get("/outbox", middleware.RequirePermission(models.PermOutboxManage), h.ListOutbox)
+	protected.Post("/outbox/:id/retry", middleware.RequirePermission(models.PermOutboxManage), h.RetryOutboxMessage)
+
+	protected.Get("/roles", middleware.RequirePermission(models.PermRolesManage), h.ListRoles)
+	protected.Put("/roles/:role/permissions", middleware.RequirePermission(models.PermRolesManage), h.SetRolePermissions)
+
+	protected.Get("/delegations", middleware.RequirePermission(models.PermDelegationsRead), h.ListDelegations)
 
-	protected := api.Group("/").Use(middleware.Authenticate()) 
+	protected.Get("/login-attempts", middleware.RequirePermission(models.PermLoginsRead), h.ListLoginAttempts)
 
-	protected.Get("/books", handlers.GetAllBooks)
-	protected.Post("/books", middleware.Authorize(models.RoleLibrarian), handlers.CreateBook)
-	protected.Post("/books/donate", handlers.DonateBook) 
+	protected.Get("/signing-keys", middleware.RequirePermission(models.PermKeysManage), h.ListSigningKeys)
+	protected.Post("/signing-keys/rotate", middleware.RequirePermission(models.PermKeysManage), h.RotateSigningKey)
 
-	protected.Post("/books/borrow", handlers.BorrowBook)
-	protected.Post("/books/return/:id", handlers.ReturnBook)
+	protected.Get("/holds", h.ListHolds)
+	protected.Post("/holds", h.PlaceHold)
+	protected.Post("/holds/:id/cancel", h.CancelHold)
+	protected.Post("/holds/:id/fulfil", h.FulfilHold)
 
-}
\ No newline at end of file
+}
@@ -0,0 +1,91 @@
+// Package scheduler runs background jobs inside the server process.
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job does one run of a background task. now is the time the run was due.
+type Job func(now time.Time) error
+
+type entry struct {
+	name string
+	job  Job
+	// next returns the first time after now that the job should run.
+	next func(now time.Time) time.Time
+}
+
+// Scheduler runs jobs on fixed intervals or at a time of day. Each job
+// runs in its own goroutine, so a slow job only delays itself.
+type Scheduler struct {
+	entries []entry
+}
+
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Every runs job every interval, starting one interval after Run.
+func (s *Scheduler) Every(name string, interval time.Duration, job Job) {
+	s.entries = append(s.entries, entry{
+		name: name,
+		job:  job,
+		next: func(now time.Time) time.Time { return now.Add(interval) },
+	})
+}
+
+// Daily runs job once a day at hour:minute local time.
+func (s *Scheduler) Daily(name string, hour, minute int, job Job) {
+	s.entries = append(s.entries, entry{
+		name: name,
+		job:  job,
+		next: func(now time.Time) time.Time {
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			return next
+		},
+	})
+}
+
+// Run runs the jobs until ctx is cancelled, then waits for any job still
+// running to finish.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range s.entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loop(ctx, e)
+		}()
+	}
+	wg.Wait()
+}
+
+func loop(ctx context.Context, e entry) {
+	for {
+		timer := time.NewTimer(time.Until(e.next(time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			run(e, now)
+		}
+	}
+}
+
+func run(e entry, now time.Time) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v", e.name, r)
+		}
+	}()
+	if err := e.job(now); err != nil {
+		log.Printf("Job %s failed: %v", e.name, err)
+	}
+}
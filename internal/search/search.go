@@ -0,0 +1,231 @@
+// Package search is an in-process full-text index for databases without
+// one of their own. It ranks matches by the weight of the field they are
+// in, as PostgreSQL's ts_rank does, and tolerates misspellings through
+// trigram similarity, as pg_trgm does.
+package search
+
+import (
+	"cmp"
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// SimilarityThreshold is how similar a misspelt word must be to a
+	// word in the index to match it, the default of pg_trgm.
+	SimilarityThreshold = 0.3
+	// prefixWeight and fuzzyWeight scale matches that are not exact.
+	prefixWeight = 0.8
+	fuzzyWeight  = 0.6
+	// minPrefix is the shortest query word matched as a prefix.
+	minPrefix = 3
+)
+
+// Field is one searchable part of a document.
+type Field struct {
+	Name   string
+	Text   string
+	Weight float64
+}
+
+type Document struct {
+	ID     uint
+	Fields []Field
+}
+
+// Hit is a document that matched a query.
+type Hit struct {
+	ID    uint
+	Score float64
+	// Highlights holds each field's text, HTML-escaped, with the words
+	// that matched wrapped in <mark> tags.
+	Highlights map[string]string
+}
+
+// Index is an inverted index over a fixed set of documents. It is safe for
+// concurrent searches; build a new one when the documents change.
+type Index struct {
+	docs map[uint]Document
+	// postings maps each word to the documents it is in and the summed
+	// weight of the fields it is in.
+	postings map[string]map[uint]float64
+	// trigrams maps each trigram to the words that contain it.
+	trigrams map[string][]string
+}
+
+func New(docs []Document) *Index {
+	ix := &Index{
+		docs:     make(map[uint]Document, len(docs)),
+		postings: make(map[string]map[uint]float64),
+		trigrams: make(map[string][]string),
+	}
+	for _, doc := range docs {
+		ix.docs[doc.ID] = doc
+		for _, field := range doc.Fields {
+			for _, word := range Words(field.Text) {
+				if ix.postings[word] == nil {
+					ix.postings[word] = make(map[uint]float64)
+					for _, t := range trigrams(word) {
+						ix.trigrams[t] = append(ix.trigrams[t], word)
+					}
+				}
+				ix.postings[word][doc.ID] += field.Weight
+			}
+		}
+	}
+	return ix
+}
+
+// Words splits text into lower-case words of letters and digits.
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigrams returns the distinct trigrams of word, padded the way pg_trgm
+// pads it.
+func trigrams(word string) []string {
+	runes := []rune("  " + word + " ")
+	var out []string
+	for i := 0; i+3 <= len(runes); i++ {
+		t := string(runes[i : i+3])
+		if !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Similarity returns the share of trigrams a and b have in common.
+func Similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	shared := 0
+	for _, t := range ta {
+		if slices.Contains(tb, t) {
+			shared++
+		}
+	}
+	union := len(ta) + len(tb) - shared
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
+
+// expand returns the indexed words a query word matches and how well each
+// matches it.
+func (ix *Index) expand(word string) map[string]float64 {
+	matches := make(map[string]float64)
+	if _, ok := ix.postings[word]; ok {
+		matches[word] = 1
+	}
+	candidates := make(map[string]bool)
+	for _, t := range trigrams(word) {
+		for _, w := range ix.trigrams[t] {
+			candidates[w] = true
+		}
+	}
+	for w := range candidates {
+		if w == word {
+			continue
+		}
+		if utf8.RuneCountInString(word) >= minPrefix && strings.HasPrefix(w, word) {
+			matches[w] = prefixWeight
+		} else if sim := Similarity(word, w); sim >= SimilarityThreshold {
+			matches[w] = fuzzyWeight * sim
+		}
+	}
+	return matches
+}
+
+// Search returns up to limit documents matching query, best first. Every
+// query word that matches anything in the index must match in a document;
+// words that match nothing at all are ignored, like stop words.
+func (ix *Index) Search(query string, limit int) []Hit {
+	scores := make(map[uint]float64)
+	matched := make(map[uint]map[string]bool)
+	first := true
+	for _, word := range Words(query) {
+		expanded := ix.expand(word)
+		if len(expanded) == 0 {
+			continue
+		}
+		best := make(map[uint]float64)
+		for w, quality := range expanded {
+			for id, weight := range ix.postings[w] {
+				best[id] = max(best[id], quality*weight)
+				if matched[id] == nil {
+					matched[id] = make(map[string]bool)
+				}
+				matched[id][w] = true
+			}
+		}
+		if first {
+			scores = best
+			first = false
+			continue
+		}
+		for id := range scores {
+			if s, ok := best[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hit := Hit{ID: id, Score: score, Highlights: make(map[string]string)}
+		for _, field := range ix.docs[id].Fields {
+			hit.Highlights[field.Name] = Highlight(field.Text, matched[id])
+		}
+		hits = append(hits, hit)
+	}
+	slices.SortFunc(hits, func(a, b Hit) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// Highlight escapes text for HTML and wraps the words in it that are in
+// words, compared in lower case, in <mark> tags.
+func Highlight(text string, words map[string]bool) string {
+	var b strings.Builder
+	start := -1
+	flush := func(end int) {
+		word := text[start:end]
+		if words[strings.ToLower(word)] {
+			b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+		start = -1
+	}
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			flush(i)
+		}
+		if !inWord {
+			b.WriteString(html.EscapeString(string(r)))
+		}
+	}
+	if start >= 0 {
+		flush(len(text))
+	}
+	return b.String()
+}